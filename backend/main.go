@@ -8,7 +8,9 @@ import (
 
 	"github.com/aarhunt/spootify/docs"
 	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/catalog"
 	"github.com/aarhunt/spootify/src/controllers"
+	"github.com/aarhunt/spootify/src/services"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -37,6 +39,19 @@ func main() {
 	_ = godotenv.Load()
 	_ = src.GetSpotifyConn;
 
+	// Run against an in-memory catalog instead of a Spotify account
+	if os.Getenv("SPOTIFY_FAKE") == "true" {
+		fake := catalog.NewFake()
+		if dir := os.Getenv("SPOTIFY_FAKE_FIXTURES"); dir != "" {
+			if err := fake.LoadFixtures(os.DirFS(dir)); err != nil {
+				panic(err)
+			}
+		}
+		src.UseCatalog(fake, "local")
+	} else if err := src.CheckTokenKey(); err != nil {
+		panic(err)
+	}
+
 	apiHost := os.Getenv("API_HOST")
     if apiHost == "" {
         apiHost = "localhost:8080"
@@ -69,13 +84,14 @@ func main() {
 
 	{
 		v1 := router.Group("/api/v1")
-		v1.POST("/search", controllers.Search)
 		v1.GET("/callback", src.CompleteAuthGin)
 		v1.GET("/auth/url", src.GetAuthURLController)
 		v1.GET("/auth/status", controllers.GetAuthStatus)
+		v1.POST("/auth/logout", src.LogoutController)
+		v1.POST("/search", src.RequireSession, controllers.Search)
 
 		{
-			play := v1.Group("/playlist")
+			play := v1.Group("/playlist", src.RequireSession)
 			play.GET("", controllers.GetPlaylists)
 			play.POST("", controllers.PostPlaylist)
 			play.DELETE("/:id", controllers.DeletePlaylist)
@@ -84,23 +100,70 @@ func main() {
 			play.POST("/item/undo", controllers.UndoIncludeExcludeItem)
 			play.POST("/include", controllers.IncludePlaylist)
 			play.POST("/include/undo", controllers.UndoIncludePlaylist)
+			play.POST("/exclude", controllers.ExcludePlaylist)
+			play.POST("/exclude/undo", controllers.UndoExcludePlaylist)
 			play.POST("/publish", controllers.PublishPlaylist)
 			play.POST("/publishall", controllers.PublishAllPlaylists)
 			play.GET("/:id/inclusions", controllers.GetPlaylistInclusions)
 			play.GET("/:id/exclusions", controllers.GetPlaylistExclusions)
 			play.GET("/:id/playlists", controllers.GetPlaylistsById)
 			play.PUT("/:id/rename", controllers.RenamePlaylist)
+			play.PUT("/:id/order", controllers.SetPlaylistOrder)
+			play.PUT("/:id/duplicates", controllers.SetDuplicatePolicy)
+			play.PUT("/:id/filters", controllers.SetPlaylistFilters)
+			play.PUT("/:id/expression", controllers.SetPlaylistExpression)
+			play.GET("/:id/explain/:trackId", controllers.ExplainTrack)
+			play.GET("/:id/preview", controllers.PreviewPlaylist)
+			play.GET("/:id/rulesets", controllers.GetPlaylistRuleSets)
+			play.POST("/:id/rulesets/:ruleSetId", controllers.AttachRuleSet)
+			play.DELETE("/:id/rulesets/:ruleSetId", controllers.DetachRuleSet)
+			play.PUT("/:id/schedule", controllers.SetSchedule)
+			play.DELETE("/:id/schedule", controllers.DeleteSchedule)
+			play.POST("/:id/schedule/pause", controllers.PauseSchedule)
+			play.POST("/:id/schedule/resume", controllers.ResumeSchedule)
+			play.POST("/:id/schedule/run", controllers.RunSchedule)
+		}
+
+		{
+			schedules := v1.Group("/schedules", src.RequireSession)
+			schedules.GET("", controllers.GetSchedules)
+		}
+
+		{
+			rules := v1.Group("/rulesets", src.RequireSession)
+			rules.GET("", controllers.GetRuleSets)
+			rules.POST("", controllers.CreateRuleSet)
+			rules.POST("/test", controllers.TestRuleSet)
+			rules.GET("/:id", controllers.GetRuleSet)
+			rules.PUT("/:id", controllers.UpdateRuleSet)
+			rules.DELETE("/:id", controllers.DeleteRuleSet)
 		}
 
 		{
-			spot := v1.Group("/spotify")
+			spot := v1.Group("/spotify", src.RequireSession)
 			spot.POST("/artist/albums", controllers.GetAlbumsFromArtist)
 			spot.POST("/album/tracks", controllers.GetTracksFromAlbum)
 		}
+
+		{
+			cache := v1.Group("/cache", src.RequireSession)
+			cache.DELETE("", controllers.ClearCache)
+			cache.DELETE("/:id", controllers.InvalidateCache)
+		}
 	}
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	if err := src.RestoreSpotifyConns(); err != nil {
+		panic(err)
+	}
+	if err := services.StartCachePruning(); err != nil {
+		panic(err)
+	}
+	if err := services.StartScheduler(); err != nil {
+		panic(err)
+	}
+
 	router.Run("0.0.0.0:8080")
 }
 
@@ -0,0 +1,114 @@
+// Package autoexclude matches albums and tracks against the exclusion rules
+// of rule sets, to find what to exclude along with an included artist or
+// album.
+package autoexclude
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/zmb3/spotify/v2"
+)
+
+// Matcher holds compiled exclusion rules.
+type Matcher struct {
+	rules []rule
+}
+
+type rule struct {
+	model.ExclusionRule
+	re *regexp.Regexp
+}
+
+// Compile checks and compiles rules. A rule with an unknown field or match,
+// an invalid regular expression, or an unknown keyword or language, is an
+// errs.ErrInvalid.
+func Compile(rules []model.ExclusionRule) (*Matcher, error) {
+	m := &Matcher{}
+	for _, r := range rules {
+		if !slices.Contains(model.RuleFields, r.Field) {
+			return nil, errs.Invalid("unknown rule field %q", r.Field)
+		}
+		if !slices.Contains(model.PatternMatches, r.Match) {
+			return nil, errs.Invalid("unknown rule match %q", r.Match)
+		}
+		if r.Pattern == "" {
+			return nil, errs.Invalid("rule on %s has no pattern", r.Field)
+		}
+		if len(r.Languages) > 0 && r.Match != model.MatchKeyword {
+			return nil, errs.Invalid("only keyword rules have languages, not %s rules", r.Match)
+		}
+
+		compiled := rule{ExclusionRule: r}
+		switch r.Match {
+		case model.MatchRegex:
+			re, err := regexp.Compile("(?i)" + r.Pattern)
+			if err != nil {
+				return nil, errs.Invalid("rule pattern %q: %v", r.Pattern, err)
+			}
+			compiled.re = re
+		case model.MatchKeyword:
+			re, err := keywordRegexp(r.Pattern, r.Languages)
+			if err != nil {
+				return nil, err
+			}
+			compiled.re = re
+		}
+		m.rules = append(m.rules, compiled)
+	}
+	return m, nil
+}
+
+// Empty tells whether there are no rules, so nothing is ever excluded.
+func (m *Matcher) Empty() bool {
+	return len(m.rules) == 0
+}
+
+// Album returns the first album rule matching the album.
+func (m *Matcher) Album(album spotify.SimpleAlbum) (model.ExclusionRule, bool) {
+	albumType := album.AlbumGroup
+	if albumType == "" {
+		albumType = album.AlbumType
+	}
+
+	return m.first(func(r rule) bool {
+		switch r.Field {
+		case model.FieldAlbumName:
+			return r.matches(album.Name)
+		case model.FieldAlbumType:
+			return r.matches(albumType)
+		}
+		return false
+	})
+}
+
+// Track returns the first track rule matching the track.
+func (m *Matcher) Track(track spotify.SimpleTrack) (model.ExclusionRule, bool) {
+	return m.first(func(r rule) bool {
+		return r.Field == model.FieldTrackName && r.matches(track.Name)
+	})
+}
+
+func (m *Matcher) first(match func(rule) bool) (model.ExclusionRule, bool) {
+	for _, r := range m.rules {
+		if match(r) {
+			return r.ExclusionRule, true
+		}
+	}
+	return model.ExclusionRule{}, false
+}
+
+func (r rule) matches(value string) bool {
+	switch r.Match {
+	case model.MatchContains:
+		return strings.Contains(strings.ToLower(value), strings.ToLower(r.Pattern))
+	case model.MatchEquals:
+		return strings.EqualFold(value, r.Pattern)
+	case model.MatchRegex, model.MatchKeyword:
+		return r.re.MatchString(value)
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package autoexclude
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/zmb3/spotify/v2"
+)
+
+func TestDefaultRuleSet(t *testing.T) {
+	m, err := Compile(model.DefaultRuleSet().Rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	albums := map[string]bool{"Live at Home": true, "Unplugged (Acoustic)": true, "First Album": false, "Delivery": true}
+	for name, want := range albums {
+		if _, got := m.Album(spotify.SimpleAlbum{Name: name}); got != want {
+			t.Errorf("album %q excluded: %v, want %v", name, got, want)
+		}
+	}
+
+	tracks := map[string]bool{"Second Song - Live": true, "Song - Single Version": true, "Live Forever": false, "Opening": false}
+	for name, want := range tracks {
+		if _, got := m.Track(spotify.SimpleTrack{Name: name}); got != want {
+			t.Errorf("track %q excluded: %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestKeywordRules(t *testing.T) {
+	tests := []struct {
+		keyword   string
+		languages []string
+		name      string
+		want      bool
+	}{
+		{"remaster", nil, "Song - Remastered 2011", true},
+		{"remaster", nil, "Canción - Remasterizado", true},
+		{"remaster", []string{"en"}, "Canción - Remasterizado", false},
+		{"remaster", []string{"es", "pt"}, "Canción (Remasterizada)", true},
+		{"demo", nil, "Song - Démo", true},
+		{"demo", nil, "Song (Provino)", true},
+		{"demo", nil, "Demolition", false},
+		{"karaoke", []string{"fr"}, "Chanson (Version Karaoké)", true},
+		{"live", nil, "Ao Vivo no Rio", true},
+		{"live", []string{"en"}, "Olive Tree", false},
+	}
+	for _, tt := range tests {
+		m, err := Compile([]model.ExclusionRule{{Field: model.FieldTrackName, Match: model.MatchKeyword, Pattern: tt.keyword, Languages: tt.languages}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, got := m.Track(spotify.SimpleTrack{Name: tt.name}); got != tt.want {
+			t.Errorf("%s in %v: %q excluded: %v, want %v", tt.keyword, tt.languages, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuiltinRuleSets(t *testing.T) {
+	for _, ruleSet := range model.BuiltinRuleSets() {
+		if _, err := Compile(ruleSet.Rules); err != nil {
+			t.Errorf("rule set %s: %v", ruleSet.Name, err)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	m, err := Compile([]model.ExclusionRule{
+		{Field: model.FieldAlbumType, Match: model.MatchEquals, Pattern: "compilation"},
+		{Field: model.FieldTrackName, Match: model.MatchRegex, Pattern: `remaster(ed)? \d{4}`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m.Album(spotify.SimpleAlbum{Name: "Hits", AlbumType: "compilation"}); !ok {
+		t.Errorf("compilation not excluded")
+	}
+	if _, ok := m.Album(spotify.SimpleAlbum{Name: "Hits", AlbumType: "compilation", AlbumGroup: "appears_on"}); ok {
+		t.Errorf("album group should win over album type")
+	}
+	if rule, ok := m.Track(spotify.SimpleTrack{Name: "Song - Remastered 2011"}); !ok || rule.Match != model.MatchRegex {
+		t.Errorf("remaster not excluded by the regex")
+	}
+
+	invalid := [][]model.ExclusionRule{
+		{{Field: "artist_name", Match: model.MatchContains, Pattern: "x"}},
+		{{Field: model.FieldTrackName, Match: "fuzzy", Pattern: "x"}},
+		{{Field: model.FieldTrackName, Match: model.MatchRegex, Pattern: "("}},
+		{{Field: model.FieldTrackName, Match: model.MatchContains}},
+		{{Field: model.FieldTrackName, Match: model.MatchKeyword, Pattern: "bootleg"}},
+		{{Field: model.FieldTrackName, Match: model.MatchKeyword, Pattern: "demo", Languages: []string{"xx"}}},
+		{{Field: model.FieldTrackName, Match: model.MatchContains, Pattern: "demo", Languages: []string{"en"}}},
+	}
+	for _, rules := range invalid {
+		if _, err := Compile(rules); !errors.Is(err, errs.ErrInvalid) {
+			t.Errorf("Compile(%+v) = %v, want an invalid request", rules, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package autoexclude
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/aarhunt/spootify/src/errs"
+)
+
+// keywords holds the words each keyword is written as, by language.
+// Spotify names releases in the language of the artist, so a rule for
+// "remaster" should also catch "Remasterizado".
+var keywords = map[string]map[string][]string{
+	"remaster": {
+		"en": {"remaster", "remastered", "remastering"},
+		"es": {"remasterizado", "remasterizada", "remasterización"},
+		"pt": {"remasterizado", "remasterizada", "remasterização"},
+		"fr": {"remasterisé", "remasterisée", "remasterisation"},
+		"de": {"remastert", "remasterung", "remastered"},
+		"it": {"rimasterizzato", "rimasterizzata", "rimasterizzazione"},
+	},
+	"demo": {
+		"en": {"demo", "demos"},
+		"es": {"demo", "maqueta"},
+		"pt": {"demo", "maquete"},
+		"fr": {"démo", "maquette"},
+		"de": {"demo", "demoaufnahme"},
+		"it": {"demo", "provino"},
+	},
+	"karaoke": {
+		"en": {"karaoke"},
+		"es": {"karaoke"},
+		"pt": {"karaokê", "karaoke"},
+		"fr": {"karaoké", "karaoke"},
+		"de": {"karaoke"},
+		"it": {"karaoke"},
+	},
+	"live": {
+		"en": {"live"},
+		"es": {"en vivo", "en directo"},
+		"pt": {"ao vivo"},
+		"fr": {"en concert", "en direct"},
+		"de": {"live"},
+		"it": {"dal vivo"},
+	},
+	"instrumental": {
+		"en": {"instrumental"},
+		"es": {"instrumental"},
+		"pt": {"instrumental"},
+		"fr": {"instrumental", "instrumentale"},
+		"de": {"instrumental"},
+		"it": {"strumentale"},
+	},
+	"acoustic": {
+		"en": {"acoustic"},
+		"es": {"acústico", "acústica"},
+		"pt": {"acústico", "acústica"},
+		"fr": {"acoustique"},
+		"de": {"akustisch", "akustik"},
+		"it": {"acustico", "acustica"},
+	},
+}
+
+// Keywords returns the keywords a keyword rule can match, sorted.
+func Keywords() []string {
+	return slices.Sorted(maps.Keys(keywords))
+}
+
+// keywordRegexp matches the words of keyword in languages, or in every
+// language if there are none, as whole words.
+func keywordRegexp(keyword string, languages []string) (*regexp.Regexp, error) {
+	byLanguage, ok := keywords[strings.ToLower(keyword)]
+	if !ok {
+		return nil, errs.Invalid("unknown keyword %q, want one of %s", keyword, strings.Join(Keywords(), ", "))
+	}
+	if len(languages) == 0 {
+		languages = slices.Sorted(maps.Keys(byLanguage))
+	}
+
+	words := []string{}
+	for _, language := range languages {
+		translations, ok := byLanguage[language]
+		if !ok {
+			return nil, errs.Invalid("keyword %q has no words in language %q", keyword, language)
+		}
+		for _, word := range translations {
+			if word := regexp.QuoteMeta(word); !slices.Contains(words, word) {
+				words = append(words, word)
+			}
+		}
+	}
+	// \b only knows ASCII letters, which would split words like "démo"
+	return regexp.Compile(`(?i)(?:^|[^\pL\pN])(?:` + strings.Join(words, "|") + `)(?:$|[^\pL\pN])`)
+}
@@ -0,0 +1,243 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/zmb3/spotify/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	kindArtist       = "artist"
+	kindAlbum        = "album"
+	kindTrack        = "track"
+	kindArtistAlbums = "artist_albums"
+	kindAlbumTracks  = "album_tracks"
+	kindTopTracks    = "artist_top_tracks"
+)
+
+// CacheTTL is how long cached entries are used before they are fetched
+// from Spotify again.
+type CacheTTL struct {
+	// Metadata covers artists, albums and tracks.
+	Metadata time.Duration
+	// Discography covers the album list of an artist, which changes with
+	// every new release.
+	Discography time.Duration
+	// Tracklist covers the tracks of an album.
+	Tracklist time.Duration
+}
+
+func DefaultCacheTTL() CacheTTL {
+	return CacheTTL{
+		Metadata:    7 * 24 * time.Hour,
+		Discography: 24 * time.Hour,
+		Tracklist:   30 * 24 * time.Hour,
+	}
+}
+
+// CacheTTLFromEnv returns DefaultCacheTTL with the TTLs overridden by
+// CATALOG_CACHE_TTL and CATALOG_DISCOGRAPHY_TTL when set, e.g. "12h".
+// CATALOG_CACHE_TTL applies to both metadata and tracklists.
+func CacheTTLFromEnv() CacheTTL {
+	ttl := DefaultCacheTTL()
+	if d, err := time.ParseDuration(os.Getenv("CATALOG_CACHE_TTL")); err == nil {
+		ttl.Metadata, ttl.Tracklist = d, d
+	}
+	if d, err := time.ParseDuration(os.Getenv("CATALOG_DISCOGRAPHY_TTL")); err == nil {
+		ttl.Discography = d
+	}
+	return ttl
+}
+
+// Cached is a Catalog that keeps artists, albums, tracks, discographies and
+// tracklists fetched from another Catalog in the database. Searches and
+// playlist writes always go to the wrapped Catalog. Failing to read or
+// write the cache is logged and falls back to the wrapped Catalog.
+type Cached struct {
+	Catalog
+	db  *gorm.DB
+	ttl CacheTTL
+}
+
+func NewCached(inner Catalog, db *gorm.DB, ttl CacheTTL) *Cached {
+	return &Cached{Catalog: inner, db: db, ttl: ttl}
+}
+
+func (c *Cached) GetArtists(ctx context.Context, ids []spotify.ID) ([]*spotify.FullArtist, error) {
+	return cachedBatch(c, ctx, kindArtist, c.ttl.Metadata, ids, c.Catalog.GetArtists,
+		func(a *spotify.FullArtist) spotify.ID { return a.ID })
+}
+
+func (c *Cached) GetAlbums(ctx context.Context, ids []spotify.ID) ([]*spotify.FullAlbum, error) {
+	return cachedBatch(c, ctx, kindAlbum, c.ttl.Metadata, ids, c.Catalog.GetAlbums,
+		func(a *spotify.FullAlbum) spotify.ID { return a.ID })
+}
+
+func (c *Cached) GetTracks(ctx context.Context, ids []spotify.ID) ([]*spotify.FullTrack, error) {
+	return cachedBatch(c, ctx, kindTrack, c.ttl.Metadata, ids, c.Catalog.GetTracks,
+		func(t *spotify.FullTrack) spotify.ID { return t.ID })
+}
+
+func (c *Cached) GetArtistAlbums(ctx context.Context, id spotify.ID, types []spotify.AlbumType) ([]spotify.SimpleAlbum, error) {
+	// Every combination of album types is cached on its own
+	kind := kindArtistAlbums
+	for _, t := range types {
+		kind += fmt.Sprintf(":%d", t)
+	}
+
+	return cachedOne(c, ctx, kind, c.ttl.Discography, id, func() ([]spotify.SimpleAlbum, error) {
+		return c.Catalog.GetArtistAlbums(ctx, id, types)
+	})
+}
+
+// GetArtistTopTracks caches top tracks as long as discographies, since
+// they change about as often.
+func (c *Cached) GetArtistTopTracks(ctx context.Context, id spotify.ID) ([]spotify.FullTrack, error) {
+	return cachedOne(c, ctx, kindTopTracks, c.ttl.Discography, id, func() ([]spotify.FullTrack, error) {
+		return c.Catalog.GetArtistTopTracks(ctx, id)
+	})
+}
+
+func (c *Cached) GetAlbumTracks(ctx context.Context, id spotify.ID) ([]spotify.SimpleTrack, error) {
+	return cachedOne(c, ctx, kindAlbumTracks, c.ttl.Tracklist, id, func() ([]spotify.SimpleTrack, error) {
+		return c.Catalog.GetAlbumTracks(ctx, id)
+	})
+}
+
+// cachedBatch looks ids up in the cache and fetches the missing ones in a
+// single call. Results keep the order of ids; unknown IDs are skipped.
+func cachedBatch[T any](c *Cached, ctx context.Context, kind string, ttl time.Duration, ids []spotify.ID,
+	fetch func(context.Context, []spotify.ID) ([]*T, error), idOf func(*T) spotify.ID) ([]*T, error) {
+
+	found := map[spotify.ID]*T{}
+	for id, payload := range c.load(ctx, kind, ttl, ids) {
+		var v T
+		if err := json.Unmarshal(payload, &v); err == nil {
+			found[id] = &v
+		}
+	}
+
+	missing := []spotify.ID{}
+	for _, id := range ids {
+		if _, ok := found[id]; !ok && !slices.Contains(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 {
+		fetched, err := fetch(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+
+		entries := []model.CatalogEntry{}
+		for _, v := range fetched {
+			if v == nil {
+				continue
+			}
+			found[idOf(v)] = v
+			entries = append(entries, c.entry(kind, idOf(v), v))
+		}
+		c.store(ctx, entries)
+	}
+
+	results := []*T{}
+	for _, id := range ids {
+		if v, ok := found[id]; ok {
+			results = append(results, v)
+		}
+	}
+	return results, nil
+}
+
+func cachedOne[T any](c *Cached, ctx context.Context, kind string, ttl time.Duration, id spotify.ID, fetch func() (T, error)) (T, error) {
+	if payload, ok := c.load(ctx, kind, ttl, []spotify.ID{id})[id]; ok {
+		var v T
+		if err := json.Unmarshal(payload, &v); err == nil {
+			return v, nil
+		}
+	}
+
+	v, err := fetch()
+	if err != nil {
+		return v, err
+	}
+	c.store(ctx, []model.CatalogEntry{c.entry(kind, id, v)})
+	return v, nil
+}
+
+// load returns the payloads of the entries of ids that are younger than ttl.
+func (c *Cached) load(ctx context.Context, kind string, ttl time.Duration, ids []spotify.ID) map[spotify.ID][]byte {
+	payloads := map[spotify.ID][]byte{}
+	if len(ids) == 0 {
+		return payloads
+	}
+
+	var entries []model.CatalogEntry
+	err := c.db.WithContext(ctx).
+		Where("kind = ? AND spotify_id IN ? AND fetched_at > ?", kind, ids, time.Now().Add(-ttl)).
+		Find(&entries).Error
+	if err != nil {
+		log.Println("Failed to read catalog cache:", err)
+		return payloads
+	}
+
+	for _, e := range entries {
+		payloads[e.SpotifyID] = e.Payload
+	}
+	return payloads
+}
+
+func (c *Cached) entry(kind string, id spotify.ID, v any) model.CatalogEntry {
+	payload, _ := json.Marshal(v)
+	return model.CatalogEntry{Kind: kind, SpotifyID: id, Payload: payload, FetchedAt: time.Now()}
+}
+
+func (c *Cached) store(ctx context.Context, entries []model.CatalogEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	err := c.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "kind"}, {Name: "spotify_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"payload", "fetched_at"}),
+	}).Create(&entries).Error
+	if err != nil {
+		log.Println("Failed to write catalog cache:", err)
+	}
+}
+
+// InvalidateCache drops everything cached about the given IDs, whatever
+// kind of object they are.
+func InvalidateCache(ctx context.Context, db *gorm.DB, ids ...spotify.ID) (int64, error) {
+	result := db.WithContext(ctx).Where("spotify_id IN ?", ids).Delete(&model.CatalogEntry{})
+	return result.RowsAffected, result.Error
+}
+
+// PruneCache drops the entries that are older than their TTL. Expired
+// entries are only replaced when they are looked up again, so without it
+// the cache keeps everything that was ever fetched.
+func PruneCache(ctx context.Context, db *gorm.DB, ttl CacheTTL) (int64, error) {
+	now := time.Now()
+	result := db.WithContext(ctx).
+		Where("kind IN ? AND fetched_at < ?", []string{kindArtist, kindAlbum, kindTrack}, now.Add(-ttl.Metadata)).
+		Or("(kind = ? OR kind LIKE ?) AND fetched_at < ?", kindTopTracks, kindArtistAlbums+"%", now.Add(-ttl.Discography)).
+		Or("kind = ? AND fetched_at < ?", kindAlbumTracks, now.Add(-ttl.Tracklist)).
+		Delete(&model.CatalogEntry{})
+	return result.RowsAffected, result.Error
+}
+
+// ClearCache drops the whole catalog cache.
+func ClearCache(ctx context.Context, db *gorm.DB) (int64, error) {
+	result := db.WithContext(ctx).Where("1 = 1").Delete(&model.CatalogEntry{})
+	return result.RowsAffected, result.Error
+}
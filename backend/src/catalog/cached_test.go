@@ -0,0 +1,143 @@
+package catalog_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aarhunt/spootify/src/catalog"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/spotifytest"
+	"github.com/zmb3/spotify/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// counting records which IDs are looked up in the wrapped catalog.
+type counting struct {
+	catalog.Catalog
+	lookups []spotify.ID
+}
+
+func (c *counting) GetArtists(ctx context.Context, ids []spotify.ID) ([]*spotify.FullArtist, error) {
+	c.lookups = append(c.lookups, ids...)
+	return c.Catalog.GetArtists(ctx, ids)
+}
+
+func (c *counting) GetAlbumTracks(ctx context.Context, id spotify.ID) ([]spotify.SimpleTrack, error) {
+	c.lookups = append(c.lookups, id)
+	return c.Catalog.GetAlbumTracks(ctx, id)
+}
+
+func newCached(t *testing.T) (*catalog.Cached, *counting, *gorm.DB) {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&model.CatalogEntry{}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := spotifytest.NewServer()
+	t.Cleanup(server.Close)
+	inner := &counting{Catalog: catalog.NewSpotify(server.Client())}
+	return catalog.NewCached(inner, db, catalog.DefaultCacheTTL()), inner, db
+}
+
+func TestCachedServesRepeatedLookupsLocally(t *testing.T) {
+	cached, inner, _ := newCached(t)
+	ctx := context.Background()
+
+	artists, err := cached.GetArtists(ctx, []spotify.ID{"artist1"})
+	if err != nil || len(artists) != 1 {
+		t.Fatalf("got %v, %v", artists, err)
+	}
+
+	// Only artists missing from the cache are fetched, results keep the
+	// requested order
+	artists, err = cached.GetArtists(ctx, []spotify.ID{"artist2", "artist1", "nosuchartist"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artists) != 2 || artists[0].ID != "artist2" || artists[1].Name != "The Testers" {
+		t.Errorf("got %+v, want artist2 and artist1", artists)
+	}
+	if want := []spotify.ID{"artist1", "artist2", "nosuchartist"}; !slices.Equal(inner.lookups, want) {
+		t.Errorf("looked up %v, want %v", inner.lookups, want)
+	}
+
+	for range 2 {
+		tracks, err := cached.GetAlbumTracks(ctx, "album1")
+		if err != nil || len(tracks) != 3 {
+			t.Fatalf("got %v, %v", tracks, err)
+		}
+	}
+	if len(inner.lookups) != 4 {
+		t.Errorf("album1's tracklist was fetched %d times, want once", len(inner.lookups)-3)
+	}
+}
+
+func TestCachedRefetchesExpiredAndInvalidatedEntries(t *testing.T) {
+	cached, inner, db := newCached(t)
+	ctx := context.Background()
+
+	if _, err := cached.GetAlbumTracks(ctx, "album1"); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Model(&model.CatalogEntry{}).Where("spotify_id = ?", "album1").
+		Update("fetched_at", time.Now().Add(-catalog.DefaultCacheTTL().Tracklist-time.Hour))
+	if _, err := cached.GetAlbumTracks(ctx, "album1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(inner.lookups) != 2 {
+		t.Errorf("expired tracklist was fetched %d times in total, want 2", len(inner.lookups))
+	}
+
+	removed, err := catalog.InvalidateCache(ctx, db, "album1")
+	if err != nil || removed != 1 {
+		t.Fatalf("invalidate removed %d entries, %v", removed, err)
+	}
+	if _, err := cached.GetAlbumTracks(ctx, "album1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(inner.lookups) != 3 {
+		t.Errorf("invalidated tracklist was fetched %d times in total, want 3", len(inner.lookups))
+	}
+}
+
+func TestPruneCacheDropsOnlyExpiredEntries(t *testing.T) {
+	cached, _, db := newCached(t)
+	ctx := context.Background()
+	ttl := catalog.DefaultCacheTTL()
+
+	if _, err := cached.GetArtists(ctx, []spotify.ID{"artist1", "artist2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.GetArtistAlbums(ctx, "artist1", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two days old is past the discography TTL, but not the metadata one
+	db.Model(&model.CatalogEntry{}).Where("spotify_id = ?", "artist1").
+		Update("fetched_at", time.Now().Add(-2*ttl.Discography))
+	db.Model(&model.CatalogEntry{}).Where("spotify_id = ?", "artist2").
+		Update("fetched_at", time.Now().Add(-ttl.Metadata-time.Hour))
+
+	removed, err := catalog.PruneCache(ctx, db, ttl)
+	if err != nil || removed != 2 {
+		t.Fatalf("prune removed %d entries, %v, want 2", removed, err)
+	}
+
+	var left []model.CatalogEntry
+	db.Find(&left)
+	if len(left) != 1 || left[0].SpotifyID != "artist1" || left[0].Kind != "artist" {
+		t.Errorf("left %+v, want only artist1's metadata", left)
+	}
+}
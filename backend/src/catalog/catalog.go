@@ -0,0 +1,48 @@
+package catalog
+
+import (
+	"context"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// Catalog is everything the services need from Spotify: catalog lookups for
+// browsing and expanding inclusions, and the playlist writes used when
+// publishing. The zmb3 client is one implementation, Fake is another.
+type Catalog interface {
+	SearchArtists(ctx context.Context, query string, limit int) ([]spotify.FullArtist, error)
+	SearchAlbums(ctx context.Context, query string, limit int) ([]spotify.SimpleAlbum, error)
+	SearchTracks(ctx context.Context, query string, limit int) ([]spotify.FullTrack, error)
+
+	GetArtists(ctx context.Context, ids []spotify.ID) ([]*spotify.FullArtist, error)
+	GetAlbums(ctx context.Context, ids []spotify.ID) ([]*spotify.FullAlbum, error)
+	GetTracks(ctx context.Context, ids []spotify.ID) ([]*spotify.FullTrack, error)
+
+	GetArtistAlbums(ctx context.Context, id spotify.ID, types []spotify.AlbumType) ([]spotify.SimpleAlbum, error)
+	// GetArtistTopTracks returns up to 10 of the artist's most popular
+	// tracks, the most popular first.
+	GetArtistTopTracks(ctx context.Context, id spotify.ID) ([]spotify.FullTrack, error)
+	GetAlbumTracks(ctx context.Context, id spotify.ID) ([]spotify.SimpleTrack, error)
+
+	CreatePlaylist(ctx context.Context, userID string, name string) (spotify.ID, error)
+	RenamePlaylist(ctx context.Context, id spotify.ID, name string) error
+	UnfollowPlaylist(ctx context.Context, id spotify.ID) error
+	ReplacePlaylistTracks(ctx context.Context, id spotify.ID, trackIDs ...spotify.ID) error
+
+	// The playlist edits below return the snapshot ID of the playlist after
+	// the edit. Edits taking a snapshot ID fail with errs.ErrConflict if the
+	// playlist was changed in a way that conflicts with them since.
+	GetPlaylistItems(ctx context.Context, id spotify.ID) (*PlaylistItems, error)
+	AddTracksToPlaylist(ctx context.Context, id spotify.ID, trackIDs ...spotify.ID) (string, error)
+	RemovePlaylistItems(ctx context.Context, id spotify.ID, snapshotID string, items ...spotify.TrackToRemove) (string, error)
+	ReorderPlaylistItems(ctx context.Context, id spotify.ID, opt spotify.PlaylistReorderOptions) (string, error)
+}
+
+// PlaylistItems is the contents of a playlist at one snapshot. Items are
+// identified by URI, since a playlist can also hold local files and
+// episodes. An item Spotify no longer has a track for has an empty URI, so
+// the positions of the others stay right.
+type PlaylistItems struct {
+	SnapshotID string
+	URIs       []spotify.URI
+}
@@ -0,0 +1,86 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+	"golang.org/x/sync/singleflight"
+)
+
+// lookupTimeout bounds a shared lookup, which no longer ends with the
+// request of the caller that started it.
+const lookupTimeout = 2 * time.Minute
+
+// Coalesced is a Catalog that shares the result of identical lookups in
+// flight at the same time, e.g. two inclusions of one publish expanding the
+// same album. The shared lookup doesn't stop when a caller gives up, only
+// that caller stops waiting for it.
+type Coalesced struct {
+	Catalog
+	group singleflight.Group
+}
+
+func NewCoalesced(inner Catalog) *Coalesced {
+	return &Coalesced{Catalog: inner}
+}
+
+func (c *Coalesced) GetArtists(ctx context.Context, ids []spotify.ID) ([]*spotify.FullArtist, error) {
+	return coalesce(c, ctx, fmt.Sprint("artists", ids), func(ctx context.Context) ([]*spotify.FullArtist, error) {
+		return c.Catalog.GetArtists(ctx, ids)
+	})
+}
+
+func (c *Coalesced) GetAlbums(ctx context.Context, ids []spotify.ID) ([]*spotify.FullAlbum, error) {
+	return coalesce(c, ctx, fmt.Sprint("albums", ids), func(ctx context.Context) ([]*spotify.FullAlbum, error) {
+		return c.Catalog.GetAlbums(ctx, ids)
+	})
+}
+
+func (c *Coalesced) GetTracks(ctx context.Context, ids []spotify.ID) ([]*spotify.FullTrack, error) {
+	return coalesce(c, ctx, fmt.Sprint("tracks", ids), func(ctx context.Context) ([]*spotify.FullTrack, error) {
+		return c.Catalog.GetTracks(ctx, ids)
+	})
+}
+
+func (c *Coalesced) GetArtistAlbums(ctx context.Context, id spotify.ID, types []spotify.AlbumType) ([]spotify.SimpleAlbum, error) {
+	return coalesce(c, ctx, fmt.Sprint("artist_albums", id, types), func(ctx context.Context) ([]spotify.SimpleAlbum, error) {
+		return c.Catalog.GetArtistAlbums(ctx, id, types)
+	})
+}
+
+func (c *Coalesced) GetArtistTopTracks(ctx context.Context, id spotify.ID) ([]spotify.FullTrack, error) {
+	return coalesce(c, ctx, fmt.Sprint("artist_top_tracks", id), func(ctx context.Context) ([]spotify.FullTrack, error) {
+		return c.Catalog.GetArtistTopTracks(ctx, id)
+	})
+}
+
+func (c *Coalesced) GetAlbumTracks(ctx context.Context, id spotify.ID) ([]spotify.SimpleTrack, error) {
+	return coalesce(c, ctx, fmt.Sprint("album_tracks", id), func(ctx context.Context) ([]spotify.SimpleTrack, error) {
+		return c.Catalog.GetAlbumTracks(ctx, id)
+	})
+}
+
+// coalesce runs fn once for all callers of the same key at the same time.
+// fn gets the context of the first caller without its cancellation, bounded
+// by lookupTimeout, so that caller leaving doesn't fail the others. Every
+// caller gets its own copy of the slice.
+func coalesce[E any](c *Coalesced, ctx context.Context, key string, fn func(context.Context) ([]E, error)) ([]E, error) {
+	ch := c.group.DoChan(key, func() (any, error) {
+		shared, cancel := context.WithTimeout(context.WithoutCancel(ctx), lookupTimeout)
+		defer cancel()
+		return fn(shared)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return slices.Clone(res.Val.([]E)), nil
+	}
+}
@@ -0,0 +1,113 @@
+package catalog_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aarhunt/spootify/src/catalog"
+	"github.com/zmb3/spotify/v2"
+)
+
+// blocking holds every tracklist lookup until release is closed.
+type blocking struct {
+	catalog.Catalog
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (b *blocking) GetAlbumTracks(ctx context.Context, id spotify.ID) ([]spotify.SimpleTrack, error) {
+	b.calls.Add(1)
+	<-b.release
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.Catalog.GetAlbumTracks(ctx, id)
+}
+
+func TestCoalescedSharesLookupsInFlight(t *testing.T) {
+	fake := catalog.NewFake()
+	fake.AddAlbum(spotify.FullAlbum{SimpleAlbum: spotify.SimpleAlbum{ID: "album"}},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "track"}})
+	inner := &blocking{Catalog: fake, release: make(chan struct{})}
+	coalesced := catalog.NewCoalesced(inner)
+
+	var wg sync.WaitGroup
+	results := make([][]spotify.SimpleTrack, 5)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tracks, err := coalesced.GetAlbumTracks(context.Background(), "album")
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = tracks
+		}()
+	}
+
+	// Give every caller time to join the lookup in flight
+	time.Sleep(50 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+
+	if calls := inner.calls.Load(); calls != 1 {
+		t.Errorf("album was looked up %d times, want once", calls)
+	}
+	for _, tracks := range results {
+		if len(tracks) != 1 || tracks[0].ID != "track" {
+			t.Errorf("got %+v, want the album's track", tracks)
+		}
+	}
+
+	// Once done, the next lookup goes to the wrapped catalog again
+	if _, err := coalesced.GetAlbumTracks(context.Background(), "album"); err != nil {
+		t.Fatal(err)
+	}
+	if calls := inner.calls.Load(); calls != 2 {
+		t.Errorf("album was looked up %d times, want twice", calls)
+	}
+}
+
+func TestCoalescedLookupOutlivesCancelledCaller(t *testing.T) {
+	fake := catalog.NewFake()
+	fake.AddAlbum(spotify.FullAlbum{SimpleAlbum: spotify.SimpleAlbum{ID: "album"}},
+		spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{ID: "track"}})
+	inner := &blocking{Catalog: fake, release: make(chan struct{})}
+	coalesced := catalog.NewCoalesced(inner)
+
+	// The first caller starts the lookup, then gives up on it
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := coalesced.GetAlbumTracks(ctx, "album")
+		first <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	second := make(chan []spotify.SimpleTrack, 1)
+	go func() {
+		tracks, err := coalesced.GetAlbumTracks(context.Background(), "album")
+		if err != nil {
+			t.Error(err)
+		}
+		second <- tracks
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled caller got %v, want %v", err, context.Canceled)
+	}
+
+	close(inner.release)
+	if tracks := <-second; len(tracks) != 1 || tracks[0].ID != "track" {
+		t.Errorf("got %+v, want the album's track", tracks)
+	}
+	if calls := inner.calls.Load(); calls != 1 {
+		t.Errorf("album was looked up %d times, want once", calls)
+	}
+}
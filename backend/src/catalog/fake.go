@@ -0,0 +1,481 @@
+package catalog
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/zmb3/spotify/v2"
+)
+
+// Fake is an in-memory Catalog. Artists, albums and tracks are registered up
+// front; playlists are created and filled through the Catalog methods just
+// like they would be on Spotify, and can be inspected with PlaylistTracks.
+type Fake struct {
+	mu sync.Mutex
+
+	artists      map[spotify.ID]*spotify.FullArtist
+	albums       map[spotify.ID]*spotify.FullAlbum
+	tracks       map[spotify.ID]*spotify.FullTrack
+	artistAlbums map[spotify.ID][]spotify.ID
+	albumTracks  map[spotify.ID][]spotify.ID
+
+	playlists map[spotify.ID]*FakePlaylist
+	nextID    int
+	snapshots int
+}
+
+type FakePlaylist struct {
+	Name  string
+	Owner string
+	// Tracks holds an empty ID for an item whose track was taken down,
+	// which Spotify returns as null
+	Tracks     []spotify.ID
+	SnapshotID string
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		artists:      map[spotify.ID]*spotify.FullArtist{},
+		albums:       map[spotify.ID]*spotify.FullAlbum{},
+		tracks:       map[spotify.ID]*spotify.FullTrack{},
+		artistAlbums: map[spotify.ID][]spotify.ID{},
+		albumTracks:  map[spotify.ID][]spotify.ID{},
+		playlists:    map[spotify.ID]*FakePlaylist{},
+	}
+}
+
+// notFound is the error Spotify answers unknown IDs with, classified like
+// SpotifyCatalog does.
+func notFound(id spotify.ID) error {
+	return errs.FromSpotify(spotify.Error{Status: http.StatusNotFound, Message: fmt.Sprintf("non existing id: '%s'", id)})
+}
+
+func badRequest(format string, args ...any) error {
+	return errs.FromSpotify(spotify.Error{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)})
+}
+
+// staleSnapshot is stricter than Spotify, which applies edits against an
+// older snapshot as long as the items are still where the snapshot had them.
+// Rejecting them makes concurrent edits easy to provoke in tests.
+func staleSnapshot(p *FakePlaylist, snapshotID string) error {
+	if snapshotID == "" || snapshotID == p.SnapshotID {
+		return nil
+	}
+	return errs.FromSpotify(spotify.Error{Status: http.StatusConflict, Message: fmt.Sprintf("snapshot %s is not current", snapshotID)})
+}
+
+// edited gives p a new snapshot ID.
+func (f *Fake) edited(p *FakePlaylist) string {
+	f.snapshots++
+	p.SnapshotID = fmt.Sprintf("fakesnapshot%04d", f.snapshots)
+	return p.SnapshotID
+}
+
+func trackURI(id spotify.ID) spotify.URI {
+	if id == "" {
+		return ""
+	}
+	return spotify.URI("spotify:track:" + id)
+}
+
+// AddArtist registers an artist.
+func (f *Fake) AddArtist(artist spotify.FullArtist) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.artists[artist.ID] = &artist
+}
+
+// AddAlbum registers an album with its tracks. The album is linked to every
+// artist in album.Artists, and as one they appear on to the other artists
+// of its tracks. Each track gets the album filled in.
+func (f *Fake) AddAlbum(album spotify.FullAlbum, tracks ...spotify.FullTrack) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	album.Tracks = spotify.SimpleTrackPage{}
+	f.albums[album.ID] = &album
+
+	for _, artist := range album.Artists {
+		if !slices.Contains(f.artistAlbums[artist.ID], album.ID) {
+			f.artistAlbums[artist.ID] = append(f.artistAlbums[artist.ID], album.ID)
+		}
+	}
+
+	ids := []spotify.ID{}
+	for _, t := range tracks {
+		for _, artist := range t.Artists {
+			if !slices.Contains(f.artistAlbums[artist.ID], album.ID) {
+				f.artistAlbums[artist.ID] = append(f.artistAlbums[artist.ID], album.ID)
+			}
+		}
+		t.Album = album.SimpleAlbum
+		t.SimpleTrack.Album = album.SimpleAlbum
+		f.tracks[t.ID] = &t
+		ids = append(ids, t.ID)
+	}
+	f.albumTracks[album.ID] = ids
+}
+
+// AddPlaylist registers a playlist under id, as if it had been created and
+// filled on Spotify.
+func (f *Fake) AddPlaylist(id spotify.ID, playlist FakePlaylist) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p := &playlist
+	p.Tracks = slices.Clone(playlist.Tracks)
+	f.edited(p)
+	f.playlists[id] = p
+}
+
+// PlaylistTracks returns the current contents of a playlist created through
+// the fake.
+func (f *Fake) PlaylistTracks(id spotify.ID) ([]spotify.ID, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.playlists[id]
+	if !ok {
+		return nil, false
+	}
+	return slices.Clone(p.Tracks), true
+}
+
+// Playlist returns a copy of a playlist created through the fake.
+func (f *Fake) Playlist(id spotify.ID) (FakePlaylist, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.playlists[id]
+	if !ok {
+		return FakePlaylist{}, false
+	}
+	playlist := *p
+	playlist.Tracks = slices.Clone(p.Tracks)
+	return playlist, true
+}
+
+func matches(name string, query string) bool {
+	return strings.Contains(strings.ToLower(name), strings.ToLower(query))
+}
+
+func (f *Fake) SearchArtists(ctx context.Context, query string, limit int) ([]spotify.FullArtist, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := []spotify.FullArtist{}
+	for _, a := range f.artists {
+		if matches(a.Name, query) {
+			results = append(results, *a)
+		}
+	}
+	slices.SortFunc(results, func(a, b spotify.FullArtist) int { return strings.Compare(a.Name, b.Name) })
+	return results[:min(limit, len(results))], nil
+}
+
+func (f *Fake) SearchAlbums(ctx context.Context, query string, limit int) ([]spotify.SimpleAlbum, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := []spotify.SimpleAlbum{}
+	for _, a := range f.albums {
+		if matches(a.Name, query) {
+			results = append(results, a.SimpleAlbum)
+		}
+	}
+	slices.SortFunc(results, func(a, b spotify.SimpleAlbum) int { return strings.Compare(a.Name, b.Name) })
+	return results[:min(limit, len(results))], nil
+}
+
+func (f *Fake) SearchTracks(ctx context.Context, query string, limit int) ([]spotify.FullTrack, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := []spotify.FullTrack{}
+	for _, t := range f.tracks {
+		if matches(t.Name, query) {
+			results = append(results, *t)
+		}
+	}
+	slices.SortFunc(results, func(a, b spotify.FullTrack) int { return strings.Compare(a.Name, b.Name) })
+	return results[:min(limit, len(results))], nil
+}
+
+// The batch lookups skip unknown IDs instead of returning nil entries.
+func (f *Fake) GetArtists(ctx context.Context, ids []spotify.ID) ([]*spotify.FullArtist, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := []*spotify.FullArtist{}
+	for _, id := range ids {
+		if a, ok := f.artists[id]; ok {
+			a := *a
+			results = append(results, &a)
+		}
+	}
+	return results, nil
+}
+
+func (f *Fake) GetAlbums(ctx context.Context, ids []spotify.ID) ([]*spotify.FullAlbum, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := []*spotify.FullAlbum{}
+	for _, id := range ids {
+		if a, ok := f.albums[id]; ok {
+			a := *a
+			a.Tracks = spotify.SimpleTrackPage{Tracks: f.simpleTracks(id)}
+			results = append(results, &a)
+		}
+	}
+	return results, nil
+}
+
+func (f *Fake) GetTracks(ctx context.Context, ids []spotify.ID) ([]*spotify.FullTrack, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := []*spotify.FullTrack{}
+	for _, id := range ids {
+		if t, ok := f.tracks[id]; ok {
+			t := *t
+			results = append(results, &t)
+		}
+	}
+	return results, nil
+}
+
+func (f *Fake) GetArtistAlbums(ctx context.Context, id spotify.ID, types []spotify.AlbumType) ([]spotify.SimpleAlbum, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.artists[id]; !ok {
+		return nil, notFound(id)
+	}
+
+	results := []spotify.SimpleAlbum{}
+	for _, albumID := range f.artistAlbums[id] {
+		album := f.albums[albumID].SimpleAlbum
+		if !slices.ContainsFunc(album.Artists, func(a spotify.SimpleArtist) bool { return a.ID == id }) {
+			album.AlbumGroup = "appears_on"
+		}
+		if hasAlbumType(types, album) {
+			results = append(results, album)
+		}
+	}
+	return results, nil
+}
+
+// GetArtistTopTracks returns the 10 most popular tracks the artist plays on.
+func (f *Fake) GetArtistTopTracks(ctx context.Context, id spotify.ID) ([]spotify.FullTrack, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.artists[id]; !ok {
+		return nil, notFound(id)
+	}
+
+	results := []spotify.FullTrack{}
+	for _, albumID := range f.artistAlbums[id] {
+		for _, trackID := range f.albumTracks[albumID] {
+			t := f.tracks[trackID]
+			if slices.ContainsFunc(t.Artists, func(a spotify.SimpleArtist) bool { return a.ID == id }) {
+				results = append(results, *t)
+			}
+		}
+	}
+	slices.SortStableFunc(results, func(a, b spotify.FullTrack) int {
+		return cmp.Compare(b.Popularity, a.Popularity)
+	})
+	return results[:min(len(results), 10)], nil
+}
+
+func hasAlbumType(types []spotify.AlbumType, album spotify.SimpleAlbum) bool {
+	if types == nil {
+		return true
+	}
+
+	group := album.AlbumGroup
+	if group == "" {
+		group = album.AlbumType
+	}
+
+	for _, t := range types {
+		switch {
+		case t&spotify.AlbumTypeAlbum != 0 && group == "album":
+			return true
+		case t&spotify.AlbumTypeSingle != 0 && group == "single":
+			return true
+		case t&spotify.AlbumTypeCompilation != 0 && group == "compilation":
+			return true
+		case t&spotify.AlbumTypeAppearsOn != 0 && group == "appears_on":
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Fake) GetAlbumTracks(ctx context.Context, id spotify.ID) ([]spotify.SimpleTrack, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.albums[id]; !ok {
+		return nil, notFound(id)
+	}
+	return f.simpleTracks(id), nil
+}
+
+func (f *Fake) simpleTracks(albumID spotify.ID) []spotify.SimpleTrack {
+	results := []spotify.SimpleTrack{}
+	for _, trackID := range f.albumTracks[albumID] {
+		results = append(results, f.tracks[trackID].SimpleTrack)
+	}
+	return results
+}
+
+func (f *Fake) CreatePlaylist(ctx context.Context, userID string, name string) (spotify.ID, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+	id := spotify.ID(fmt.Sprintf("fakeplaylist%04d", f.nextID))
+	p := &FakePlaylist{Name: name, Owner: userID, Tracks: []spotify.ID{}}
+	f.edited(p)
+	f.playlists[id] = p
+	return id, nil
+}
+
+func (f *Fake) RenamePlaylist(ctx context.Context, id spotify.ID, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.playlists[id]
+	if !ok {
+		return notFound(id)
+	}
+	p.Name = name
+	f.edited(p)
+	return nil
+}
+
+func (f *Fake) UnfollowPlaylist(ctx context.Context, id spotify.ID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.playlists, id)
+	return nil
+}
+
+func (f *Fake) ReplacePlaylistTracks(ctx context.Context, id spotify.ID, trackIDs ...spotify.ID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.playlists[id]
+	if !ok {
+		return notFound(id)
+	}
+	p.Tracks = slices.Clone(trackIDs)
+	f.edited(p)
+	return nil
+}
+
+func (f *Fake) GetPlaylistItems(ctx context.Context, id spotify.ID) (*PlaylistItems, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.playlists[id]
+	if !ok {
+		return nil, notFound(id)
+	}
+	items := &PlaylistItems{SnapshotID: p.SnapshotID, URIs: []spotify.URI{}}
+	for _, t := range p.Tracks {
+		items.URIs = append(items.URIs, trackURI(t))
+	}
+	return items, nil
+}
+
+func (f *Fake) AddTracksToPlaylist(ctx context.Context, id spotify.ID, trackIDs ...spotify.ID) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.playlists[id]
+	if !ok {
+		return "", notFound(id)
+	}
+	p.Tracks = append(p.Tracks, trackIDs...)
+	return f.edited(p), nil
+}
+
+// RemovePlaylistItems removes the items at their positions, or every
+// occurrence of items given without positions.
+func (f *Fake) RemovePlaylistItems(ctx context.Context, id spotify.ID, snapshotID string, items ...spotify.TrackToRemove) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.playlists[id]
+	if !ok {
+		return "", notFound(id)
+	}
+	if err := staleSnapshot(p, snapshotID); err != nil {
+		return "", err
+	}
+
+	remove := map[int]bool{}
+	for _, item := range items {
+		if len(item.Positions) == 0 {
+			for i, t := range p.Tracks {
+				if trackURI(t) == spotify.URI(item.URI) {
+					remove[i] = true
+				}
+			}
+		}
+		for _, i := range item.Positions {
+			if i < 0 || i >= len(p.Tracks) || trackURI(p.Tracks[i]) != spotify.URI(item.URI) {
+				return "", badRequest("could not remove %s at position %d", item.URI, i)
+			}
+			remove[i] = true
+		}
+	}
+
+	kept := []spotify.ID{}
+	for i, t := range p.Tracks {
+		if !remove[i] {
+			kept = append(kept, t)
+		}
+	}
+	p.Tracks = kept
+	return f.edited(p), nil
+}
+
+func (f *Fake) ReorderPlaylistItems(ctx context.Context, id spotify.ID, opt spotify.PlaylistReorderOptions) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, ok := f.playlists[id]
+	if !ok {
+		return "", notFound(id)
+	}
+	if err := staleSnapshot(p, opt.SnapshotID); err != nil {
+		return "", err
+	}
+
+	start, length, before := int(opt.RangeStart), max(int(opt.RangeLength), 1), int(opt.InsertBefore)
+	if start < 0 || start+length > len(p.Tracks) || before < 0 || before > len(p.Tracks) {
+		return "", badRequest("range %d+%d or insert_before %d out of bounds", start, length, before)
+	}
+
+	moved := slices.Clone(p.Tracks[start : start+length])
+	rest := slices.Delete(slices.Clone(p.Tracks), start, start+length)
+	if before > start {
+		before = max(before-length, start)
+	}
+	p.Tracks = slices.Insert(rest, before, moved...)
+	return f.edited(p), nil
+}
@@ -0,0 +1,66 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// FixtureAlbum is one entry of albums.json: an album and its tracklist.
+type FixtureAlbum struct {
+	Album  spotify.FullAlbum   `json:"album"`
+	Tracks []spotify.FullTrack `json:"tracks"`
+}
+
+// FixturePlaylist is one entry of playlists.json. A null track stands for an
+// item whose track was taken down.
+type FixturePlaylist struct {
+	ID     spotify.ID   `json:"id"`
+	Name   string       `json:"name"`
+	Owner  string       `json:"owner"`
+	Tracks []spotify.ID `json:"tracks"`
+}
+
+// LoadFixtures registers the artists in artists.json, the albums in
+// albums.json and the playlists in playlists.json found in fsys. Missing
+// files are skipped.
+func (f *Fake) LoadFixtures(fsys fs.FS) error {
+	var artists []spotify.FullArtist
+	if err := readFixture(fsys, "artists.json", &artists); err != nil {
+		return err
+	}
+	for _, a := range artists {
+		f.AddArtist(a)
+	}
+
+	var albums []FixtureAlbum
+	if err := readFixture(fsys, "albums.json", &albums); err != nil {
+		return err
+	}
+	for _, a := range albums {
+		f.AddAlbum(a.Album, a.Tracks...)
+	}
+
+	var playlists []FixturePlaylist
+	if err := readFixture(fsys, "playlists.json", &playlists); err != nil {
+		return err
+	}
+	for _, p := range playlists {
+		f.AddPlaylist(p.ID, FakePlaylist{Name: p.Name, Owner: p.Owner, Tracks: p.Tracks})
+	}
+
+	return nil
+}
+
+func readFixture(fsys fs.FS, name string, v any) error {
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
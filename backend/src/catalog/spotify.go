@@ -0,0 +1,176 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/zmb3/spotify/v2"
+)
+
+// SpotifyCatalog is the Catalog backed by the real Spotify Web API. Errors
+// are classified with errs.FromSpotify.
+type SpotifyCatalog struct {
+	client *spotify.Client
+}
+
+func NewSpotify(client *spotify.Client) *SpotifyCatalog {
+	return &SpotifyCatalog{client: client}
+}
+
+func (s *SpotifyCatalog) SearchArtists(ctx context.Context, query string, limit int) ([]spotify.FullArtist, error) {
+	results, err := s.client.Search(ctx, query, spotify.SearchTypeArtist, spotify.Limit(limit))
+	if err != nil {
+		return nil, errs.FromSpotify(err)
+	}
+	return results.Artists.Artists, nil
+}
+
+func (s *SpotifyCatalog) SearchAlbums(ctx context.Context, query string, limit int) ([]spotify.SimpleAlbum, error) {
+	results, err := s.client.Search(ctx, query, spotify.SearchTypeAlbum, spotify.Limit(limit))
+	if err != nil {
+		return nil, errs.FromSpotify(err)
+	}
+	return results.Albums.Albums, nil
+}
+
+func (s *SpotifyCatalog) SearchTracks(ctx context.Context, query string, limit int) ([]spotify.FullTrack, error) {
+	results, err := s.client.Search(ctx, query, spotify.SearchTypeTrack, spotify.Limit(limit))
+	if err != nil {
+		return nil, errs.FromSpotify(err)
+	}
+	return results.Tracks.Tracks, nil
+}
+
+func (s *SpotifyCatalog) GetArtists(ctx context.Context, ids []spotify.ID) ([]*spotify.FullArtist, error) {
+	artists, err := s.client.GetArtists(ctx, ids...)
+	return artists, errs.FromSpotify(err)
+}
+
+func (s *SpotifyCatalog) GetAlbums(ctx context.Context, ids []spotify.ID) ([]*spotify.FullAlbum, error) {
+	albums, err := s.client.GetAlbums(ctx, ids)
+	return albums, errs.FromSpotify(err)
+}
+
+func (s *SpotifyCatalog) GetTracks(ctx context.Context, ids []spotify.ID) ([]*spotify.FullTrack, error) {
+	tracks, err := s.client.GetTracks(ctx, ids)
+	return tracks, errs.FromSpotify(err)
+}
+
+// GetArtistAlbums pages through the artist's whole discography.
+func (s *SpotifyCatalog) GetArtistAlbums(ctx context.Context, id spotify.ID, types []spotify.AlbumType) ([]spotify.SimpleAlbum, error) {
+	page, err := s.client.GetArtistAlbums(ctx, id, types, spotify.Limit(50))
+	if err != nil {
+		return nil, errs.FromSpotify(err)
+	}
+
+	albums := page.Albums
+	for {
+		err := s.client.NextPage(ctx, page)
+		if errors.Is(err, spotify.ErrNoMorePages) {
+			return albums, nil
+		}
+		if err != nil {
+			return nil, errs.FromSpotify(err)
+		}
+		albums = append(albums, page.Albums...)
+	}
+}
+
+// topTracksMarket is sent along for top tracks. Spotify uses the market of
+// the user's account instead when it knows it.
+const topTracksMarket = "US"
+
+func (s *SpotifyCatalog) GetArtistTopTracks(ctx context.Context, id spotify.ID) ([]spotify.FullTrack, error) {
+	tracks, err := s.client.GetArtistsTopTracks(ctx, id, topTracksMarket)
+	return tracks, errs.FromSpotify(err)
+}
+
+// GetAlbumTracks pages through the album's whole tracklist.
+func (s *SpotifyCatalog) GetAlbumTracks(ctx context.Context, id spotify.ID) ([]spotify.SimpleTrack, error) {
+	page, err := s.client.GetAlbumTracks(ctx, id, spotify.Limit(50))
+	if err != nil {
+		return nil, errs.FromSpotify(err)
+	}
+
+	tracks := page.Tracks
+	for {
+		err := s.client.NextPage(ctx, page)
+		if errors.Is(err, spotify.ErrNoMorePages) {
+			return tracks, nil
+		}
+		if err != nil {
+			return nil, errs.FromSpotify(err)
+		}
+		tracks = append(tracks, page.Tracks...)
+	}
+}
+
+func (s *SpotifyCatalog) CreatePlaylist(ctx context.Context, userID string, name string) (spotify.ID, error) {
+	playlist, err := s.client.CreatePlaylistForUser(ctx, userID, name, "", false, false)
+	if err != nil {
+		return "", errs.FromSpotify(err)
+	}
+	return playlist.ID, nil
+}
+
+func (s *SpotifyCatalog) RenamePlaylist(ctx context.Context, id spotify.ID, name string) error {
+	return errs.FromSpotify(s.client.ChangePlaylistName(ctx, id, name))
+}
+
+func (s *SpotifyCatalog) UnfollowPlaylist(ctx context.Context, id spotify.ID) error {
+	return errs.FromSpotify(s.client.UnfollowPlaylist(ctx, id))
+}
+
+func (s *SpotifyCatalog) ReplacePlaylistTracks(ctx context.Context, id spotify.ID, trackIDs ...spotify.ID) error {
+	return errs.FromSpotify(s.client.ReplacePlaylistTracks(ctx, id, trackIDs...))
+}
+
+// GetPlaylistItems pages through the whole playlist. The first page comes
+// with the snapshot ID, so the two match unless the playlist is edited while
+// the later pages are read. Spotify returns a null track for an item whose
+// track was taken down, which leaves its URI empty.
+func (s *SpotifyCatalog) GetPlaylistItems(ctx context.Context, id spotify.ID) (*PlaylistItems, error) {
+	playlist, err := s.client.GetPlaylist(ctx, id)
+	if err != nil {
+		return nil, errs.FromSpotify(err)
+	}
+
+	items := &PlaylistItems{SnapshotID: playlist.SnapshotID, URIs: []spotify.URI{}}
+	page := &playlist.Tracks
+	for {
+		for _, t := range page.Tracks {
+			items.URIs = append(items.URIs, t.Track.URI)
+		}
+
+		err := s.client.NextPage(ctx, page)
+		if errors.Is(err, spotify.ErrNoMorePages) {
+			return items, nil
+		}
+		if err != nil {
+			return nil, errs.FromSpotify(err)
+		}
+	}
+}
+
+func (s *SpotifyCatalog) AddTracksToPlaylist(ctx context.Context, id spotify.ID, trackIDs ...spotify.ID) (string, error) {
+	snapshotID, err := s.client.AddTracksToPlaylist(ctx, id, trackIDs...)
+	return snapshotID, errs.FromSpotify(err)
+}
+
+// RemovePlaylistItems removes items at the given positions of the snapshot.
+// Spotify rejects the removal as a bad request if an item is no longer at
+// its position, which means someone else edited the playlist meanwhile.
+func (s *SpotifyCatalog) RemovePlaylistItems(ctx context.Context, id spotify.ID, snapshotID string, items ...spotify.TrackToRemove) (string, error) {
+	newSnapshotID, err := s.client.RemoveTracksFromPlaylistOpt(ctx, id, items, snapshotID)
+	err = errs.FromSpotify(err)
+	if snapshotID != "" && errors.Is(err, errs.ErrInvalid) {
+		return "", errs.Conflict("playlist %s changed since snapshot %s: %v", id, snapshotID, err)
+	}
+	return newSnapshotID, err
+}
+
+func (s *SpotifyCatalog) ReorderPlaylistItems(ctx context.Context, id spotify.ID, opt spotify.PlaylistReorderOptions) (string, error) {
+	snapshotID, err := s.client.ReorderPlaylistTracks(ctx, id, opt)
+	return snapshotID, errs.FromSpotify(err)
+}
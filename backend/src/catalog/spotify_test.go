@@ -0,0 +1,155 @@
+package catalog_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/aarhunt/spootify/src/catalog"
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/spotifytest"
+	"github.com/zmb3/spotify/v2"
+)
+
+func TestSpotifyCatalogPagesThroughResults(t *testing.T) {
+	fake := catalog.NewFake()
+	artist := spotify.SimpleArtist{ID: "prolific", Name: "Prolific"}
+	fake.AddArtist(spotify.FullArtist{SimpleArtist: artist})
+
+	for i := range 120 {
+		fake.AddAlbum(spotify.FullAlbum{SimpleAlbum: spotify.SimpleAlbum{
+			ID:        spotify.ID(fmt.Sprintf("album%d", i)),
+			Name:      fmt.Sprintf("Album %d", i),
+			AlbumType: "album",
+			Artists:   []spotify.SimpleArtist{artist},
+		}})
+	}
+
+	tracks := []spotify.FullTrack{}
+	for i := range 130 {
+		tracks = append(tracks, spotify.FullTrack{SimpleTrack: spotify.SimpleTrack{
+			ID:   spotify.ID(fmt.Sprintf("track%d", i)),
+			Name: fmt.Sprintf("Track %d", i),
+		}})
+	}
+	fake.AddAlbum(spotify.FullAlbum{SimpleAlbum: spotify.SimpleAlbum{
+		ID:        "compilation",
+		Name:      "Everything",
+		AlbumType: "compilation",
+		Artists:   []spotify.SimpleArtist{artist},
+	}}, tracks...)
+
+	server := spotifytest.NewServerWithCatalog(fake)
+	defer server.Close()
+	cat := catalog.NewSpotify(server.Client())
+	ctx := context.Background()
+
+	albums, err := cat.GetArtistAlbums(ctx, "prolific", []spotify.AlbumType{spotify.AlbumTypeAlbum})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 120 {
+		t.Errorf("got %d albums, want 120", len(albums))
+	}
+
+	got, err := cat.GetAlbumTracks(ctx, "compilation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 130 || got[129].ID != "track129" {
+		t.Errorf("got %d tracks, want all 130 in order", len(got))
+	}
+}
+
+func TestSpotifyCatalogEditsPlaylists(t *testing.T) {
+	server := spotifytest.NewServer()
+	defer server.Close()
+	cat := catalog.NewSpotify(server.Client())
+	ctx := context.Background()
+
+	id, err := cat.CreatePlaylist(ctx, server.UserID, "Edits")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracks := []spotify.ID{}
+	for i := range 150 {
+		tracks = append(tracks, spotify.ID(fmt.Sprintf("track%d", i)))
+	}
+	if _, err := cat.AddTracksToPlaylist(ctx, id, tracks[:100]...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cat.AddTracksToPlaylist(ctx, id, tracks[100:]...); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := cat.GetPlaylistItems(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items.URIs) != 150 || items.URIs[149] != "spotify:track:track149" {
+		t.Fatalf("got %d items, want all 150 in order", len(items.URIs))
+	}
+
+	snapshotID, err := cat.RemovePlaylistItems(ctx, id, items.SnapshotID, spotify.NewTrackToRemove("track0", []int{0}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cat.ReorderPlaylistItems(ctx, id, spotify.PlaylistReorderOptions{RangeStart: 148, InsertBefore: 0, SnapshotID: snapshotID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := server.Catalog.PlaylistTracks(id)
+	if len(got) != 149 || got[0] != "track149" || got[1] != "track1" {
+		t.Errorf("got %v..., want track149 moved in front of track1", got[:2])
+	}
+
+	// Both snapshots are outdated by now
+	_, err = cat.RemovePlaylistItems(ctx, id, snapshotID, spotify.NewTrackToRemove("track1", []int{1}))
+	if !errors.Is(err, errs.ErrConflict) {
+		t.Errorf("removing against an old snapshot: got %v, want a conflict", err)
+	}
+	_, err = cat.ReorderPlaylistItems(ctx, id, spotify.PlaylistReorderOptions{RangeStart: 0, InsertBefore: 2, SnapshotID: items.SnapshotID})
+	if !errors.Is(err, errs.ErrConflict) {
+		t.Errorf("reordering against an old snapshot: got %v, want a conflict", err)
+	}
+}
+
+func TestSpotifyCatalogKeepsTakenDownItems(t *testing.T) {
+	server := spotifytest.NewServer()
+	defer server.Close()
+	cat := catalog.NewSpotify(server.Client())
+
+	items, err := cat.GetPlaylistItems(context.Background(), "takendown1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []spotify.URI{"spotify:track:track1", "", "spotify:track:track2"}
+	if !slices.Equal(items.URIs, want) {
+		t.Errorf("got %v, want %v", items.URIs, want)
+	}
+}
+
+func TestSpotifyCatalogTopTracks(t *testing.T) {
+	server := spotifytest.NewServer()
+	defer server.Close()
+	cat := catalog.NewSpotify(server.Client())
+
+	tracks, err := cat.GetArtistTopTracks(context.Background(), "artist1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) == 0 || tracks[0].ID != "track2" || tracks[0].Popularity != 70 {
+		t.Errorf("got %v, want track2 as the most popular", tracks)
+	}
+	for i := 1; i < len(tracks); i++ {
+		if tracks[i].Popularity > tracks[i-1].Popularity {
+			t.Errorf("%s is more popular than %s before it", tracks[i].ID, tracks[i-1].ID)
+		}
+	}
+
+	if _, err := cat.GetArtistTopTracks(context.Background(), "unknown"); !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("unknown artist: got %v, want not found", err)
+	}
+}
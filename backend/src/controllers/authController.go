@@ -4,20 +4,38 @@ import (
 	"net/http"
 
 	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/model"
 	"github.com/gin-gonic/gin"
 )
 
 // GetAuthStatusController godoc
 // @Summary      Check authentication status
-// @Description  Returns true if the backend has a valid Spotify connection.
+// @Description  Returns whether the backend has a valid Spotify connection, and if so for which user, until when and with which scopes. An expired token is refreshed first.
 // @Tags         auth
 // @Produce      json
-// @Success      200  {object}  map[string]bool "authenticated: true"
+// @Success      200  {object}  model.AuthStatusResponse
 // @Router       /auth/status [get]
 func GetAuthStatus(c *gin.Context) {
-    isLoggedIn := (src.GetSpotifyConn() != nil)
-    
-    c.JSON(http.StatusOK, gin.H{
-        "authenticated": isLoggedIn,
-    })
+    conn := src.ConnFromRequest(c)
+    if conn == nil {
+        c.JSON(http.StatusOK, model.AuthStatusResponse{Authenticated: false})
+        return
+    }
+
+    status := model.AuthStatusResponse{
+        Authenticated: true,
+        UserID:        conn.UserID,
+        Scopes:        conn.Scopes,
+    }
+
+    if conn.Token != nil {
+        token, err := conn.Token.Token()
+        if err != nil {
+            status.Authenticated = false
+        } else {
+            status.Expiry = &token.Expiry
+        }
+    }
+
+    c.JSON(http.StatusOK, status)
 }
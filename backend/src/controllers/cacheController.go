@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/services"
+	"github.com/gin-gonic/gin"
+	"github.com/zmb3/spotify/v2"
+)
+
+// InvalidateCache godoc
+// @Summary      Invalidate cached Spotify data
+// @Description  Drops the cached data of an artist, album or track, including an artist's album list and an album's tracklist. It is fetched from Spotify again on next use.
+// @Tags         cache
+// @Produce      json
+// @Param        id   path      string  true  "Spotify ID of the artist, album or track"
+// @Success      200  {object}  map[string]interface{} "removed: number of entries dropped"
+// @Failure      500  {object}  model.ErrorResponse
+// @Router       /cache/{id} [delete]
+func InvalidateCache(c *gin.Context) {
+	removed, err := services.InvalidateCache(spotify.ID(c.Param("id")))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"removed": removed})
+}
+
+// ClearCache godoc
+// @Summary      Clear cached Spotify data
+// @Description  Drops all cached artists, albums, tracks, album lists and tracklists. Only users listed in CACHE_ADMINS may clear the cache.
+// @Tags         cache
+// @Produce      json
+// @Success      200  {object}  map[string]interface{} "removed: number of entries dropped"
+// @Failure      403  {object}  model.ErrorResponse
+// @Failure      500  {object}  model.ErrorResponse
+// @Router       /cache [delete]
+func ClearCache(c *gin.Context) {
+	removed, err := services.ClearCache(src.Conn(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"removed": removed})
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/aarhunt/spootify/src/model"
+)
+
+func TestOnlyCacheAdminsClearTheCache(t *testing.T) {
+	router, server := setup(t)
+
+	w := do(t, router, http.MethodDelete, "/cache", nil)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("clear without being an admin: %d %s", w.Code, w.Body.String())
+	}
+	if res := decode[model.ErrorResponse](t, w); res.Code != model.CodeForbidden {
+		t.Errorf("got code %q, want %q", res.Code, model.CodeForbidden)
+	}
+
+	t.Setenv("CACHE_ADMINS", "someone, "+server.UserID)
+	if w := do(t, router, http.MethodDelete, "/cache", nil); w.Code != http.StatusOK {
+		t.Errorf("clear as an admin: %d %s", w.Code, w.Body.String())
+	}
+
+	// Dropping a single entry only costs a refetch, so anyone may
+	if w := do(t, router, http.MethodDelete, "/cache/artist1", nil); w.Code != http.StatusOK {
+		t.Errorf("invalidate: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/gin-gonic/gin"
+)
+
+// respondError aborts the request with the status and code err maps to.
+// Errors of an unknown kind are logged and answered with a 500.
+func respondError(c *gin.Context, err error) {
+	status, code := http.StatusInternalServerError, model.CodeInternal
+
+	switch {
+	case errors.Is(err, errs.ErrInvalid):
+		status, code = http.StatusBadRequest, model.CodeInvalid
+	case errors.Is(err, errs.ErrUnauthorized):
+		status, code = http.StatusUnauthorized, model.CodeUnauthorized
+	case errors.Is(err, errs.ErrForbidden):
+		status, code = http.StatusForbidden, model.CodeForbidden
+	case errors.Is(err, errs.ErrNotFound):
+		status, code = http.StatusNotFound, model.CodeNotFound
+	case errors.Is(err, errs.ErrRateLimited):
+		status, code = http.StatusTooManyRequests, model.CodeRateLimited
+	case errors.Is(err, errs.ErrUnavailable):
+		status, code = http.StatusServiceUnavailable, model.CodeUnavailable
+	case errors.Is(err, errs.ErrConflict):
+		status, code = http.StatusConflict, model.CodeConflict
+	default:
+		log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	}
+
+	c.AbortWithStatusJSON(status, model.ErrorResponse{Error: err.Error(), Code: code})
+}
+
+// badRequest aborts the request with a 400 and the given message.
+func badRequest(c *gin.Context, message string) {
+	c.AbortWithStatusJSON(http.StatusBadRequest, model.ErrorResponse{Error: message, Code: model.CodeInvalid})
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/catalog"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/zmb3/spotify/v2"
+)
+
+func TestUnknownItemsAreNotFound(t *testing.T) {
+	router, _ := setup(t)
+	playlist := createPlaylist(t, router, "Missing")
+
+	w := do(t, router, http.MethodGet, "/playlist/nosuchplaylist/inclusions", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown playlist: %d %s", w.Code, w.Body.String())
+	}
+	if res := decode[model.ErrorResponse](t, w); res.Code != model.CodeNotFound {
+		t.Errorf("unknown playlist got code %q, want %q", res.Code, model.CodeNotFound)
+	}
+
+	include := true
+	w = do(t, router, http.MethodPost, "/playlist/item", model.ItemInclusionRequest{
+		ItemSpotifyID: "nosuchartist",
+		ItemType:      model.Artist,
+		PlaylistID:    playlist,
+		Include:       &include,
+	})
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("unknown artist: %d %s", w.Code, w.Body.String())
+	}
+	if res := decode[model.ErrorResponse](t, w); res.Code != model.CodeNotFound {
+		t.Errorf("unknown artist got code %q, want %q", res.Code, model.CodeNotFound)
+	}
+}
+
+func TestSpotifyFailuresAreReported(t *testing.T) {
+	tests := []struct {
+		upstream int
+		status   int
+		code     string
+	}{
+		{http.StatusTooManyRequests, http.StatusTooManyRequests, model.CodeRateLimited},
+		{http.StatusBadGateway, http.StatusServiceUnavailable, model.CodeUnavailable},
+		{http.StatusUnauthorized, http.StatusUnauthorized, model.CodeUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.upstream), func(t *testing.T) {
+			router, server := setup(t)
+			playlist := createPlaylist(t, router, "Failing")
+
+			failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.upstream)
+				json.NewEncoder(w).Encode(map[string]any{
+					"error": spotify.Error{Status: tt.upstream, Message: "failing"},
+				})
+			}))
+			t.Cleanup(failing.Close)
+			client := spotify.New(failing.Client(), spotify.WithBaseURL(failing.URL+"/v1/"))
+			src.UseCatalog(catalog.NewSpotify(client), server.UserID)
+
+			w := do(t, router, http.MethodPost, "/search", model.SearchRequest{Query: "test", PlaylistID: playlist, ItemType: model.Artist})
+			if w.Code != tt.status {
+				t.Fatalf("search: %d %s, want %d", w.Code, w.Body.String(), tt.status)
+			}
+			if res := decode[model.ErrorResponse](t, w); res.Code != tt.code {
+				t.Errorf("search got code %q, want %q", res.Code, tt.code)
+			}
+		})
+	}
+}
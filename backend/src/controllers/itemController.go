@@ -3,6 +3,7 @@ package controllers
 import (
 	"net/http"
 
+	"github.com/aarhunt/spootify/src"
 	"github.com/aarhunt/spootify/src/model"
 	"github.com/aarhunt/spootify/src/services"
 	"github.com/gin-gonic/gin"
@@ -11,24 +12,25 @@ import (
 
 // IncludeExcludeItem godoc
 // @Summary      Include or Exclude an Item
-// @Description  Adds an IdItem to either the inclusions or exclusions of a playlist
+// @Description  Adds an IdItem to either the inclusions or exclusions of a playlist. An included artist can bring in only its top tracks, its latest releases or its releases since a date, out of the release types picked for it
 // @Tags         items
 // @Accept       json
 // @Produce      json
 // @Param        request  body      model.ItemInclusionRequest  true  "Inclusion/Exclusion Details"
 // @Success      200      {object}  model.InclusionResponse
-// @Failure      500      {object}  map[string]string
+// @Failure      400      {object}  model.ErrorResponse
+// @Failure      500      {object}  model.ErrorResponse
 // @Router       /playlist/item [post]
 func IncludeExcludeItem(c *gin.Context) {
 	var req model.ItemInclusionRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err.Error())
 		return
 	}
 
-	res, err := services.IncludeExcludeItem(req, true, true)
+	res, err := services.IncludeExcludeItem(src.Conn(c), req, true, true)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -43,18 +45,18 @@ func IncludeExcludeItem(c *gin.Context) {
 // @Produce      json
 // @Param        request  body      model.ItemInclusionRequest  true  "Item to remove"
 // @Success      200      {object}  model.InclusionResponse
-// @Failure      500      {object}  map[string]string
+// @Failure      500      {object}  model.ErrorResponse
 // @Router       /playlist/item/undo [post]
 func UndoIncludeExcludeItem(c *gin.Context) {
     var req model.ItemInclusionRequest
     if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        badRequest(c, err.Error())
         return
     }
 
-    res, err := services.UndoIncludeExcludeItem(req)
+    res, err := services.UndoIncludeExcludeItem(src.Conn(c), req)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(c, err)
         return
     }
 
@@ -64,24 +66,24 @@ func UndoIncludeExcludeItem(c *gin.Context) {
 
 // GetAlbumFromArtist godoc
 // @Summary      Get Albums by Artist
-// @Description  Fetches albums and singles from Spotify for a specific artist
+// @Description  Fetches albums and singles from Spotify for a specific artist, along with any other release types the artist is included with
 // @Tags         spotify
 // @Accept       json
 // @Produce      json
 // @Param        request  body      model.ItemRequest  true  "Artist and Playlist Context"
 // @Success      200      {array}   model.ItemResponse
-// @Failure      500      {object}  map[string]string
+// @Failure      500      {object}  model.ErrorResponse
 // @Router       /spotify/artist/albums [post]
 func GetAlbumsFromArtist(c *gin.Context) {
 	var req model.ItemRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err.Error())
 		return
 	}
 
-	res, err := services.GetAlbumFromArtist(req)
+	res, err := services.GetAlbumFromArtist(src.Conn(c), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -96,18 +98,18 @@ func GetAlbumsFromArtist(c *gin.Context) {
 // @Produce      json
 // @Param        request  body      model.ItemRequest  true  "Album and Playlist Context"
 // @Success      200      {array}   model.ItemResponse
-// @Failure      500      {object}  map[string]string
+// @Failure      500      {object}  model.ErrorResponse
 // @Router       /spotify/album/tracks [post]
 func GetTracksFromAlbum(c *gin.Context) {
 	var req model.ItemRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err.Error())
 		return
 	}
 
-	res, err := services.GetTracksFromAlbum(req)
+	res, err := services.GetTracksFromAlbum(src.Conn(c), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -122,29 +124,38 @@ func GetTracksFromAlbum(c *gin.Context) {
 // @Produce      json
 // @Param        request  body      model.SearchRequest  true  "Search Query and Item Type"
 // @Success      200      {array}   model.ItemResponse
-// @Failure      400      {object}  map[string]string "Invalid Item Type"
+// @Failure      400      {object}  model.ErrorResponse "Invalid Item Type"
+// @Failure      404      {object}  model.ErrorResponse "code: not_found"
+// @Failure      429      {object}  model.ErrorResponse "code: rate_limited"
+// @Failure      503      {object}  model.ErrorResponse "code: upstream_unavailable"
 // @Router       /search [post]
 func Search(c *gin.Context) {
     var req model.SearchRequest
     if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        badRequest(c, err.Error())
         return
     }
 
+    conn := src.Conn(c)
     var results []model.ItemResponse
+    var err error
 
     // Route to the specific service based on ItemType
     switch req.ItemType {
 	case model.PlaylistItem:
-		results = services.SearchPlaylist(req)
+		results, err = services.SearchPlaylist(conn, req)
     case model.Artist:
-        results = services.SearchArtist(req)
+        results, err = services.SearchArtist(conn, req)
     case model.Album:
-        results = services.SearchAlbum(req)
+        results, err = services.SearchAlbum(conn, req)
     case model.Track:
-        results = services.SearchTrack(req)
+        results, err = services.SearchTrack(conn, req)
     default:
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported search item type"})
+        badRequest(c, "Unsupported search item type")
+        return
+    }
+    if err != nil {
+        respondError(c, err)
         return
     }
 
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/zmb3/spotify/v2"
+)
+
+func TestSearchReportsInclusionState(t *testing.T) {
+	router, _ := setup(t)
+	playlist := createPlaylist(t, router, "Search")
+
+	includeItem(t, router, playlist, "artist1", model.Artist, true)
+
+	w := do(t, router, http.MethodPost, "/search", model.SearchRequest{Query: "test", PlaylistID: playlist, ItemType: model.Artist})
+	if w.Code != http.StatusOK {
+		t.Fatalf("search: %d %s", w.Code, w.Body.String())
+	}
+
+	results := decode[[]model.ItemResponse](t, w)
+	if len(results) != 1 || results[0].SpotifyID != "artist1" {
+		t.Fatalf("got %+v, want only artist1", results)
+	}
+	if results[0].Included != model.Included {
+		t.Errorf("artist1 is %v, want %v", results[0].Included, model.Included)
+	}
+}
+
+func TestInclusionsAndExclusions(t *testing.T) {
+	router, _ := setup(t)
+	playlist := createPlaylist(t, router, "Lists")
+
+	includeItem(t, router, playlist, "artist1", model.Artist, true)
+
+	inclusions := decode[[]model.ItemResponse](t, do(t, router, http.MethodGet, "/playlist/"+string(playlist)+"/inclusions", nil))
+	if len(inclusions) != 1 || inclusions[0].SpotifyID != "artist1" {
+		t.Errorf("inclusions are %+v, want only artist1", inclusions)
+	}
+
+	// The auto exclusions for the artist: the live album and the live track
+	exclusions := decode[[]model.ItemResponse](t, do(t, router, http.MethodGet, "/playlist/"+string(playlist)+"/exclusions", nil))
+	excluded := map[spotify.ID]bool{}
+	for _, e := range exclusions {
+		excluded[e.SpotifyID] = true
+	}
+	if len(excluded) != 2 || !excluded["album2"] || !excluded["track3"] {
+		t.Errorf("exclusions are %v, want album2 and track3", excluded)
+	}
+}
+
+func TestArtistReleaseTypes(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Releases")
+	browse := model.ItemRequest{ParentID: "artist1", PlaylistID: playlist, ItemType: model.Album}
+
+	includeItem(t, router, playlist, "artist1", model.Artist, true)
+
+	proxied := func() map[spotify.ID]model.InclusionType {
+		t.Helper()
+		w := do(t, router, http.MethodPost, "/spotify/artist/albums", browse)
+		if w.Code != http.StatusOK {
+			t.Fatalf("browse: %d %s", w.Code, w.Body.String())
+		}
+		included := map[spotify.ID]model.InclusionType{}
+		for _, album := range decode[[]model.ItemResponse](t, w) {
+			included[album.SpotifyID] = album.Included
+		}
+		return included
+	}
+	if got := proxied(); got["album1"] != model.IncludedByProxy || got["album3"] != model.Nothing {
+		t.Errorf("browsing shows %v, want album1 but not the single included by proxy", got)
+	}
+
+	include := true
+	w := do(t, router, http.MethodPost, "/playlist/item", model.ItemInclusionRequest{
+		ItemSpotifyID: "artist1",
+		ItemType:      model.Artist,
+		PlaylistID:    playlist,
+		Include:       &include,
+		Artist:        &model.ArtistInclusion{ReleaseTypes: []model.ReleaseType{model.ReleaseSingle, model.ReleaseAlbum}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("include artist: %d %s", w.Code, w.Body.String())
+	}
+	if got := proxied(); got["album1"] != model.IncludedByProxy || got["album3"] != model.IncludedByProxy {
+		t.Errorf("browsing shows %v, want album1 and the single included by proxy", got)
+	}
+
+	// The single brings in its own version of track2
+	got := publish(t, router, server, playlist)
+	want := []spotify.ID{"track1", "track2", "track6"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+
+	inclusions := decode[[]model.ItemResponse](t, do(t, router, http.MethodGet, "/playlist/"+string(playlist)+"/inclusions", nil))
+	if len(inclusions) != 1 || inclusions[0].Artist == nil || len(inclusions[0].Artist.ReleaseTypes) != 2 {
+		t.Errorf("inclusions are %+v, want artist1 with albums and singles", inclusions)
+	}
+
+	// Of a compilation the artist appears on, only their own tracks count
+	w = do(t, router, http.MethodPost, "/playlist/item", model.ItemInclusionRequest{
+		ItemSpotifyID: "artist1",
+		ItemType:      model.Artist,
+		PlaylistID:    playlist,
+		Include:       &include,
+		Artist:        &model.ArtistInclusion{ReleaseTypes: []model.ReleaseType{model.ReleaseAlbum, model.ReleaseAppearsOn}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("include artist: %d %s", w.Code, w.Body.String())
+	}
+	got = publish(t, router, server, playlist)
+	want = []spotify.ID{"track1", "track10", "track2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+
+	w = do(t, router, http.MethodPost, "/playlist/item", model.ItemInclusionRequest{
+		ItemSpotifyID: "artist1",
+		ItemType:      model.Artist,
+		PlaylistID:    playlist,
+		Include:       &include,
+		Artist:        &model.ArtistInclusion{ReleaseTypes: []model.ReleaseType{"bootleg"}},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown release type: got %d, want 400", w.Code)
+	}
+}
+
+func TestProxyStatusFollowsArtistMode(t *testing.T) {
+	router, _ := setup(t)
+	playlist := createPlaylist(t, router, "Modes")
+	browse := model.ItemRequest{ParentID: "artist1", PlaylistID: playlist, ItemType: model.Album}
+	include := true
+
+	proxied := func(mode model.ArtistInclusion) map[spotify.ID]model.InclusionType {
+		t.Helper()
+		w := do(t, router, http.MethodPost, "/playlist/item", model.ItemInclusionRequest{
+			ItemSpotifyID: "artist1",
+			ItemType:      model.Artist,
+			PlaylistID:    playlist,
+			Include:       &include,
+			Artist:        &mode,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("include artist: %d %s", w.Code, w.Body.String())
+		}
+		w = do(t, router, http.MethodPost, "/spotify/artist/albums", browse)
+		if w.Code != http.StatusOK {
+			t.Fatalf("browse: %d %s", w.Code, w.Body.String())
+		}
+		included := map[spotify.ID]model.InclusionType{}
+		for _, album := range decode[[]model.ItemResponse](t, w) {
+			included[album.SpotifyID] = album.Included
+		}
+		return included
+	}
+
+	releases := []model.ReleaseType{model.ReleaseAlbum, model.ReleaseSingle}
+	latest := model.ArtistInclusion{Mode: model.ArtistLatest, Count: 2, ReleaseTypes: releases}
+	if got := proxied(latest); got["album1"] != model.IncludedByProxy || got["album3"] != model.Nothing {
+		t.Errorf("latest two releases show %v, want album1 but not the older single included by proxy", got)
+	}
+	since := model.ArtistInclusion{Mode: model.ArtistSince, Since: "2019-01-01", ReleaseTypes: releases}
+	if got := proxied(since); got["album1"] != model.IncludedByProxy || got["album3"] != model.Nothing {
+		t.Errorf("releases since 2019 show %v, want album1 but not the 2018 single included by proxy", got)
+	}
+	top := model.ArtistInclusion{Mode: model.ArtistTopTracks, Count: 1, ReleaseTypes: releases}
+	if got := proxied(top); got["album1"] != model.Nothing || got["album3"] != model.Nothing {
+		t.Errorf("top tracks show %v, want no album included by proxy", got)
+	}
+}
@@ -1,8 +1,12 @@
 package controllers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/errs"
 	"github.com/aarhunt/spootify/src/model"
 	"github.com/aarhunt/spootify/src/services"
 	"github.com/gin-gonic/gin"
@@ -15,13 +19,13 @@ import (
 // @Tags         playlist
 // @Produce      json
 // @Success      200  {array}   model.PlaylistResponse
-// @Failure      500  {object}  map[string]string
+// @Failure      500  {object}  model.ErrorResponse
 // @Router       /playlist [get]
 func GetPlaylists(c *gin.Context) {
-	playlists, err := services.GetPlaylists()
-
+	playlists, err := services.GetPlaylists(src.Conn(c))
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        respondError(c, err)
+        return
     }
 
 	c.IndentedJSON(http.StatusOK, playlists)
@@ -34,12 +38,16 @@ func GetPlaylists(c *gin.Context) {
 // @Param        id   path      string  true  "Playlist ID"
 // @Produce      json
 // @Success      200  {array}   model.ItemResponse
-// @Failure      500  {object}  map[string]string
+// @Failure      500  {object}  model.ErrorResponse
 // @Router       /playlist/{id}/playlists [get]
 func GetPlaylistsById(c *gin.Context) {
     id := c.Param("id")
 
-	playlists := services.SearchPlaylist(model.SearchRequest{Query: "", PlaylistID: spotify.ID(id), ItemType: model.PlaylistItem})
+	playlists, err := services.SearchPlaylist(src.Conn(c), model.SearchRequest{Query: "", PlaylistID: spotify.ID(id), ItemType: model.PlaylistItem})
+    if err != nil {
+        respondError(c, err)
+        return
+    }
 
 	c.IndentedJSON(http.StatusOK, playlists)
 }
@@ -50,20 +58,20 @@ func GetPlaylistsById(c *gin.Context) {
 // @Tags         playlist
 // @Param        id   path      string  true  "Playlist ID"
 // @Success      204  {object}  nil
-// @Failure      500  {object}  map[string]string
+// @Failure      500  {object}  model.ErrorResponse
 // @Router       /playlist/{id} [delete]
 func DeletePlaylist(c *gin.Context) {
     id := c.Param("id")
 
-    result := services.DeletePlaylist(spotify.ID(id))
+    rowsAffected, err := services.DeletePlaylist(src.Conn(c), spotify.ID(id))
     
-    if result.Error != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+    if err != nil {
+        respondError(c, err)
         return
     }
 
-    if result.RowsAffected == 0 {
-        c.JSON(http.StatusNotFound, gin.H{"message": "Playlist not found"})
+    if rowsAffected == 0 {
+        respondError(c, errs.NotFound("playlist %s", id))
         return
     }
 
@@ -79,27 +87,27 @@ func DeletePlaylist(c *gin.Context) {
 // @Param        id    path      string         true  "Spotify Playlist ID"
 // @Param        body  body      model.PlaylistCreateRequest  true  "New name for the playlist"
 // @Success      200   {object}  map[string]interface{} "message: Success"
-// @Failure      400   {object}  map[string]string "error: Invalid input"
-// @Failure      404   {object}  map[string]string "error: Playlist not found"
-// @Failure      500   {object}  map[string]string "error: Database error"
+// @Failure      400   {object}  model.ErrorResponse "error: Invalid input"
+// @Failure      404   {object}  model.ErrorResponse "error: Playlist not found"
+// @Failure      500   {object}  model.ErrorResponse "error: Database error"
 // @Router       /playlist/{id}/rename [put]
 func RenamePlaylist(c *gin.Context) {
     playlistID := c.Param("id")
 	var req model.PlaylistCreateRequest
 
     if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "New name is required"})
+        badRequest(c, "New name is required")
         return
     }
 
-    rowsAffected, err := services.RenamePlaylist(spotify.ID(playlistID), req.Name)
+    rowsAffected, err := services.RenamePlaylist(src.Conn(c), spotify.ID(playlistID), req.Name)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update database", "details": err.Error()})
+        respondError(c, err)
         return
     }
 
     if rowsAffected == 0 {
-        c.JSON(http.StatusNotFound, gin.H{"error": "No playlist found with that ID"})
+        respondError(c, errs.NotFound("playlist %s", playlistID))
         return
     }
 
@@ -109,28 +117,144 @@ func RenamePlaylist(c *gin.Context) {
     })
 }
 
+// SetPlaylistOrder godoc
+// @Summary      Set the track order of a playlist
+// @Description  Chooses how the tracks are ordered when the playlist is published: resolved (rule order), release_date, album (album then disc and track number), artist, duration, date_added (when the including rule was added) or shuffle. A shuffle is seeded, so it keeps its order across publishes; a random seed is picked if none is given.
+// @Tags         playlist
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string                      true  "Spotify Playlist ID"
+// @Param        body  body      model.PlaylistOrderRequest  true  "Track order"
+// @Success      200   {object}  model.PlaylistResponse
+// @Failure      400   {object}  model.ErrorResponse "code: invalid_request"
+// @Failure      404   {object}  model.ErrorResponse "error: Playlist not found"
+// @Failure      500   {object}  model.ErrorResponse
+// @Router       /playlist/{id}/order [put]
+func SetPlaylistOrder(c *gin.Context) {
+    var req model.PlaylistOrderRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        badRequest(c, "Order is required")
+        return
+    }
+
+    res, err := services.SetPlaylistOrder(src.Conn(c), spotify.ID(c.Param("id")), req)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, res)
+}
+
+// SetDuplicatePolicy godoc
+// @Summary      Choose which duplicate versions a playlist keeps
+// @Description  A recording released more than once, on an album, a single or a compilation, shares its ISRC across releases; tracks without one are matched by name and duration. The playlist keeps one version of each: earliest_release, album_version or most_popular. keep_all, the default, publishes every version.
+// @Tags         playlist
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string                           true  "Spotify Playlist ID"
+// @Param        body  body      model.PlaylistDuplicatesRequest  true  "Duplicate policy"
+// @Success      200   {object}  model.PlaylistResponse
+// @Failure      400   {object}  model.ErrorResponse "code: invalid_request"
+// @Failure      404   {object}  model.ErrorResponse "error: Playlist not found"
+// @Failure      500   {object}  model.ErrorResponse
+// @Router       /playlist/{id}/duplicates [put]
+func SetDuplicatePolicy(c *gin.Context) {
+    var req model.PlaylistDuplicatesRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        badRequest(c, "Policy is required")
+        return
+    }
+
+    res, err := services.SetDuplicatePolicy(src.Conn(c), spotify.ID(c.Param("id")), req)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, res)
+}
+
+// SetPlaylistFilters godoc
+// @Summary      Set the metadata filters of a playlist
+// @Description  Narrows the tracks the playlist's rules resolve to down by release year, duration, explicitness, popularity and album type. Bounds are inclusive and unset filters let every track through, so {} removes them all. The preview lists the tracks the filters leave out.
+// @Tags         playlist
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string                 true  "Spotify Playlist ID"
+// @Param        body  body      model.MetadataFilters  true  "Filters"
+// @Success      200   {object}  model.PlaylistResponse
+// @Failure      400   {object}  model.ErrorResponse "code: invalid_request"
+// @Failure      404   {object}  model.ErrorResponse "error: Playlist not found"
+// @Failure      500   {object}  model.ErrorResponse
+// @Router       /playlist/{id}/filters [put]
+func SetPlaylistFilters(c *gin.Context) {
+    var req model.MetadataFilters
+    if err := c.ShouldBindJSON(&req); err != nil {
+        badRequest(c, "Invalid filters")
+        return
+    }
+
+    res, err := services.SetPlaylistFilters(src.Conn(c), spotify.ID(c.Param("id")), req)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, res)
+}
+
+// SetPlaylistExpression godoc
+// @Summary      Define a playlist by set operations over other playlists
+// @Description  Gives the playlist the tracks of a set expression over other playlists: union, intersection or difference (the first operand minus the others), nested as deep as needed. The playlist's own rules still add and remove tracks. An expression making the playlist depend on itself, directly or through nesting, is refused. A null expression removes it.
+// @Tags         playlist
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string                           true  "Spotify Playlist ID"
+// @Param        body  body      model.PlaylistExpressionRequest  true  "Set expression"
+// @Success      200   {object}  model.PlaylistResponse
+// @Failure      400   {object}  model.ErrorResponse "code: invalid_request"
+// @Failure      404   {object}  model.ErrorResponse "error: Playlist not found"
+// @Failure      500   {object}  model.ErrorResponse
+// @Router       /playlist/{id}/expression [put]
+func SetPlaylistExpression(c *gin.Context) {
+    var req model.PlaylistExpressionRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        badRequest(c, "Invalid expression")
+        return
+    }
+
+    res, err := services.SetPlaylistExpression(src.Conn(c), spotify.ID(c.Param("id")), req)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, res)
+}
+
 // PostPlaylist godoc
 // @Summary      Create new playlist
-// @Description  Create a new playlist locally and on Spotify
+// @Description  Create a new playlist locally and on Spotify. It keeps every version of a recording released more than once unless duplicates picks another policy.
 // @Tags         playlist
 // @Accept       json
 // @Produce      json
 // @Param        playlist body model.PlaylistCreateRequest true "Playlist name"
 // @Success      201 {object} model.PlaylistResponse
-// @Failure      400 {object} gin.H
+// @Failure      400 {object} model.ErrorResponse
 // @Router       /playlist [post]
 func PostPlaylist(c *gin.Context) {
 
 	var req model.PlaylistCreateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err.Error())
 		return
 	}
 
-	result, err := services.PostPlaylist(req)
+	result, err := services.PostPlaylist(src.Conn(c), req)
 
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": result})
+        respondError(c, err)
         return
     }
 
@@ -142,13 +266,13 @@ func PostPlaylist(c *gin.Context) {
 // @Description  Deletes every playlist record in the database
 // @Tags         playlist
 // @Success      200  {object}  map[string]interface{}
-// @Failure      500  {object}  map[string]string
+// @Failure      500  {object}  model.ErrorResponse
 // @Router       /playlist [delete]
 func ClearPlaylists(c *gin.Context) {
-    result, err := services.ClearPlaylists()
+    result, err := services.ClearPlaylists(src.Conn(c))
 
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(c, err)
         return
     }
 
@@ -157,34 +281,46 @@ func ClearPlaylists(c *gin.Context) {
 
 // PublishPlaylist handles the synchronization of the local playlist state to Spotify.
 // @Summary      Publish a playlist to Spotify
-// @Description  Calculates the current tracklist based on inclusions/exclusions and replaces the Spotify playlist content.
+// @Description  Calculates the current tracklist based on inclusions/exclusions and brings the Spotify playlist in line with it, removing, adding and moving only the tracks that differ. Tracks that stay keep their date added. The playlists depending on it are published too. With dryRun set, nothing is written to Spotify and a report of the changes is returned instead.
 // @Tags         playlist
 // @Accept       json
 // @Produce      json
 // @Param        request  body      model.PlaylistPublishRequest  true  "Playlist Publish Request"
-// @Success      200      {object}  map[string]string "message: Success"
-// @Failure      400      {object}  map[string]string "error: Bad Request"
-// @Failure      500      {object}  map[string]string "error: Internal Server Error"
+// @Success      200      {object}  model.ErrorResponse "message: Success"
+// @Success      200      {object}  model.PublishReport "with dryRun"
+// @Failure      400      {object}  model.ErrorResponse "error: Bad Request"
+// @Failure      404      {object}  model.ErrorResponse "code: not_found"
+// @Failure      409      {object}  model.ErrorResponse "code: conflict, the playlist kept being edited on Spotify"
+// @Failure      429      {object}  model.ErrorResponse "code: rate_limited"
+// @Failure      500      {object}  model.ErrorResponse "error: Internal Server Error"
+// @Failure      503      {object}  model.ErrorResponse "code: upstream_unavailable"
 // @Router       /playlist/publish [post]
 func PublishPlaylist(c *gin.Context) {
     var req model.PlaylistPublishRequest
 
     if err := c.ShouldBindJSON(&req); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+        badRequest(c, "Invalid request payload")
         return
     }
 
     if req.SpotifyID == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Playlist Spotify ID is required"})
+        badRequest(c, "Playlist Spotify ID is required")
+        return
+    }
+
+    if req.DryRun {
+        report, err := services.PlanPublish(src.Conn(c), req)
+        if err != nil {
+            respondError(c, err)
+            return
+        }
+        c.JSON(http.StatusOK, report)
         return
     }
 
-    err := services.PublishPlaylist(req)
+    err := services.PublishPlaylist(src.Conn(c), req)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "error":   "Failed to sync with Spotify",
-            "details": err.Error(),
-        })
+        respondError(c, err)
         return
     }
 
@@ -196,27 +332,44 @@ func PublishPlaylist(c *gin.Context) {
 
 // PublishPlaylist handles the synchronization of the local playlists to Spotify.
 // @Summary      Publish all playlists to Spotify
-// @Description  Calculates the current tracklist based on inclusions/exclusions and replaces the Spotify playlist content.
+// @Description  Calculates the current tracklist based on inclusions/exclusions and replaces the Spotify playlist content. With dryRun set, nothing is written to Spotify and a report of the changes is returned instead.
 // @Tags         playlist
 // @Accept       json
 // @Produce      json
-// @Success      200      {object}  map[string]string "message: Success"
-// @Failure      400      {object}  map[string]string "error: Bad Request"
+// @Param        request  body      model.PublishAllRequest  false  "Publish Options"
+// @Success      200      {object}  model.ErrorResponse "message: Success"
+// @Success      200      {object}  model.PublishReport "with dryRun"
+// @Failure      400      {object}  model.ErrorResponse "error: Bad Request"
 // @Router       /playlist/publishall [post]
 func PublishAllPlaylists(c *gin.Context) {
-	playlists, err := services.GetPlaylists()
+	conn := src.Conn(c)
+
+	// The body is optional
+	var req model.PublishAllRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		badRequest(c, "Invalid request payload")
+		return
+	}
+	if req.DryRun {
+		report, err := services.PlanPublishAll(conn)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+		return
+	}
 
+	playlists, err := services.GetPlaylists(conn)
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        respondError(c, err)
+        return
     }
 
 	for _, p := range playlists {
-		err := services.PublishPlaylist(model.PlaylistPublishRequest{SpotifyID: p.SpotifyID})
+		err := services.PublishPlaylist(conn, model.PlaylistPublishRequest{SpotifyID: p.SpotifyID})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to sync with Spotify",
-				"details": err.Error(),
-			})
+			respondError(c, err)
 			return
 		}
 	}
@@ -234,18 +387,22 @@ func PublishAllPlaylists(c *gin.Context) {
 // @Produce      json
 // @Param        id   path      string  true  "Spotify Playlist ID"
 // @Success      200  {array}   model.ItemResponse
-// @Failure      400  {object}  map[string]string "error: Invalid ID"
-// @Failure      500  {object}  map[string]string "error: Database error"
+// @Failure      400  {object}  model.ErrorResponse "error: Invalid ID"
+// @Failure      500  {object}  model.ErrorResponse "error: Database error"
 // @Router       /playlist/{id}/inclusions [get]
 func GetPlaylistInclusions(c *gin.Context) {
     id := c.Param("id")
     
     if id == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Playlist ID is required"})
+        badRequest(c, "Playlist ID is required")
         return
     }
 
-    inclusions := services.GetAllInclusions(spotify.ID(id))
+    inclusions, err := services.GetAllInclusions(src.Conn(c), spotify.ID(id))
+    if err != nil {
+        respondError(c, err)
+        return
+    }
 
     c.JSON(http.StatusOK, inclusions)
 }
@@ -258,47 +415,53 @@ func GetPlaylistInclusions(c *gin.Context) {
 // @Produce      json
 // @Param        id   path      string  true  "Spotify Playlist ID"
 // @Success      200  {array}   model.ItemResponse
-// @Failure      400  {object}  map[string]string "error: Invalid ID"
-// @Failure      500  {object}  map[string]string "error: Database error"
+// @Failure      400  {object}  model.ErrorResponse "error: Invalid ID"
+// @Failure      500  {object}  model.ErrorResponse "error: Database error"
 // @Router       /playlist/{id}/exclusions [get]
 func GetPlaylistExclusions(c *gin.Context) {
     id := c.Param("id")
     
     if id == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Playlist ID is required"})
+        badRequest(c, "Playlist ID is required")
         return
     }
 
-    exclusions := services.GetAllExclusions(spotify.ID(id))
+    exclusions, err := services.GetAllExclusions(src.Conn(c), spotify.ID(id))
+    if err != nil {
+        respondError(c, err)
+        return
+    }
 
     c.JSON(http.StatusOK, exclusions)
 }
 
 // IncludePlaylist godoc
 // @Summary      Nest a Playlist
-// @Description  Includes one playlist inside another parent playlist
+// @Description  Includes one playlist inside another parent playlist. Nesting that would make a loop is refused with the loop in the error, as is nesting deeper than PLAYLIST_MAX_NESTING_DEPTH levels.
 // @Tags         playlist
 // @Accept       json
 // @Produce      json
 // @Param        request  body      model.ItemPlaylistRequest  true  "Playlist Linking Details"
 // @Success      200      {object}  model.PlaylistResponse
-// @Failure      500      {object}  map[string]string
+// @Failure      400      {object}  model.ErrorResponse
+// @Failure      404      {object}  model.ErrorResponse
+// @Failure      500      {object}  model.ErrorResponse
 // @Router       /playlist/include [post]
 func IncludePlaylist(c *gin.Context) {
 	var req model.ItemPlaylistRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err.Error())
 		return
 	}
 
 	if req.ChildSpotifyID == req.ParentSpotifyID {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot include playlist in itself"})
+		badRequest(c, "Cannot include playlist in itself")
 		return
 	}
 
-	res, err := services.IncludePlaylist(req)
+	res, err := services.IncludePlaylist(src.Conn(c), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -313,22 +476,119 @@ func IncludePlaylist(c *gin.Context) {
 // @Produce      json
 // @Param        request  body      model.ItemPlaylistRequest  true  "Playlist Linking Details"
 // @Success      200      {object}  model.PlaylistResponse
-// @Failure      500      {object}  map[string]string
+// @Failure      500      {object}  model.ErrorResponse
 // @Router       /playlist/include/undo [post]
 func UndoIncludePlaylist(c *gin.Context) { //TODO
 	var req model.ItemPlaylistRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		badRequest(c, err.Error())
 		return
 	}
 
-	res, err := services.UndoIncludePlaylist(req)
+	res, err := services.UndoIncludePlaylist(src.Conn(c), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, res)
 }
 
+// ExcludePlaylist godoc
+// @Summary      Exclude a nested Playlist
+// @Description  Subtracts every track the child playlist resolves to from the parent playlist. The parent's own track and album inclusions still win. Like inclusions, exclusions can't make a loop or nest past the depth limit.
+// @Tags         playlist
+// @Accept       json
+// @Produce      json
+// @Param        request  body      model.ItemPlaylistRequest  true  "Playlist Linking Details"
+// @Success      200      {object}  model.PlaylistResponse
+// @Failure      400      {object}  model.ErrorResponse
+// @Failure      404      {object}  model.ErrorResponse
+// @Router       /playlist/exclude [post]
+func ExcludePlaylist(c *gin.Context) {
+	var req model.ItemPlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	if req.ChildSpotifyID == req.ParentSpotifyID {
+		badRequest(c, "Cannot exclude playlist from itself")
+		return
+	}
 
+	res, err := services.ExcludePlaylist(src.Conn(c), req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// UndoExcludePlaylist godoc
+// @Summary      Undo an excluded nested Playlist
+// @Description  Undoes the exclusion of one playlist from another parent playlist
+// @Tags         playlist
+// @Accept       json
+// @Produce      json
+// @Param        request  body      model.ItemPlaylistRequest  true  "Playlist Linking Details"
+// @Success      200      {object}  model.PlaylistResponse
+// @Failure      404      {object}  model.ErrorResponse
+// @Router       /playlist/exclude/undo [post]
+func UndoExcludePlaylist(c *gin.Context) {
+	var req model.ItemPlaylistRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, err.Error())
+		return
+	}
+
+	res, err := services.UndoExcludePlaylist(src.Conn(c), req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// ExplainTrack godoc
+// @Summary      Explain a track's membership
+// @Description  Tells why a track is in or out of a playlist: every artist, album and track rule reaching it, at which nesting depth and through which nested playlists, and which rule won. The most specific rule wins, an exclusion wins a tie.
+// @Tags         playlist
+// @Produce      json
+// @Param        id       path      string  true  "Spotify Playlist ID"
+// @Param        trackId  path      string  true  "Spotify Track ID"
+// @Success      200      {object}  model.ExplainResponse
+// @Failure      404      {object}  model.ErrorResponse "error: Playlist not found"
+// @Failure      500      {object}  model.ErrorResponse
+// @Router       /playlist/{id}/explain/{trackId} [get]
+func ExplainTrack(c *gin.Context) {
+    res, err := services.ExplainTrack(src.Conn(c), spotify.ID(c.Param("id")), spotify.ID(c.Param("trackId")))
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, res)
+}
+
+// PreviewPlaylist godoc
+// @Summary      Preview a playlist
+// @Description  Resolves the playlist without publishing it. Returns the tracks it would get, in order, with their artists, album and duration, the total runtime, and the rule that put each track there.
+// @Tags         playlist
+// @Produce      json
+// @Param        id   path      string  true  "Spotify Playlist ID"
+// @Success      200  {object}  model.PreviewResponse
+// @Failure      404  {object}  model.ErrorResponse "error: Playlist not found"
+// @Failure      500  {object}  model.ErrorResponse
+// @Router       /playlist/{id}/preview [get]
+func PreviewPlaylist(c *gin.Context) {
+    res, err := services.PreviewPlaylist(src.Conn(c), spotify.ID(c.Param("id")))
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, res)
+}
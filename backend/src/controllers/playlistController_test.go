@@ -0,0 +1,894 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/catalog"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/spotifytest"
+	"github.com/gin-gonic/gin"
+	"github.com/zmb3/spotify/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setup points the backend at a fresh in-memory database and a fake Spotify
+// Web API loaded with the spotifytest fixtures.
+func setup(t *testing.T) (*gin.Engine, *spotifytest.Server) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src.UseDb(db)
+
+	server := spotifytest.NewServer()
+	t.Cleanup(server.Close)
+	src.UseCatalog(catalog.NewSpotify(server.Client()), server.UserID)
+
+	router := gin.New()
+	v1 := router.Group("/api/v1")
+	v1.GET("/auth/status", GetAuthStatus)
+	v1.POST("/search", src.RequireSession, Search)
+	play := v1.Group("/playlist", src.RequireSession)
+	play.GET("", GetPlaylists)
+	play.POST("", PostPlaylist)
+	play.DELETE("", ClearPlaylists)
+	play.DELETE("/:id", DeletePlaylist)
+	play.POST("/item", IncludeExcludeItem)
+	play.POST("/item/undo", UndoIncludeExcludeItem)
+	play.POST("/include", IncludePlaylist)
+	play.POST("/include/undo", UndoIncludePlaylist)
+	play.POST("/exclude", ExcludePlaylist)
+	play.POST("/exclude/undo", UndoExcludePlaylist)
+	play.POST("/publish", PublishPlaylist)
+	play.POST("/publishall", PublishAllPlaylists)
+	play.GET("/:id/inclusions", GetPlaylistInclusions)
+	play.GET("/:id/exclusions", GetPlaylistExclusions)
+	play.PUT("/:id/rename", RenamePlaylist)
+	play.PUT("/:id/order", SetPlaylistOrder)
+	play.PUT("/:id/duplicates", SetDuplicatePolicy)
+	play.PUT("/:id/filters", SetPlaylistFilters)
+	play.PUT("/:id/expression", SetPlaylistExpression)
+	play.GET("/:id/explain/:trackId", ExplainTrack)
+	play.GET("/:id/preview", PreviewPlaylist)
+	play.GET("/:id/rulesets", GetPlaylistRuleSets)
+	play.POST("/:id/rulesets/:ruleSetId", AttachRuleSet)
+	play.DELETE("/:id/rulesets/:ruleSetId", DetachRuleSet)
+	play.PUT("/:id/schedule", SetSchedule)
+	play.DELETE("/:id/schedule", DeleteSchedule)
+	play.POST("/:id/schedule/pause", PauseSchedule)
+	play.POST("/:id/schedule/resume", ResumeSchedule)
+	play.POST("/:id/schedule/run", RunSchedule)
+
+	schedules := v1.Group("/schedules", src.RequireSession)
+	schedules.GET("", GetSchedules)
+
+	spot := v1.Group("/spotify", src.RequireSession)
+	spot.POST("/artist/albums", GetAlbumsFromArtist)
+
+	cache := v1.Group("/cache", src.RequireSession)
+	cache.DELETE("", ClearCache)
+	cache.DELETE("/:id", InvalidateCache)
+
+	rules := v1.Group("/rulesets", src.RequireSession)
+	rules.GET("", GetRuleSets)
+	rules.POST("", CreateRuleSet)
+	rules.POST("/test", TestRuleSet)
+	rules.GET("/:id", GetRuleSet)
+	rules.PUT("/:id", UpdateRuleSet)
+	rules.DELETE("/:id", DeleteRuleSet)
+
+	return router, server
+}
+
+func do(t *testing.T, router *gin.Engine, method string, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	return doAs(t, router, "", method, path, body)
+}
+
+// doAs sends the request with the given session token as bearer token.
+func doAs(t *testing.T, router *gin.Engine, session string, method string, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, "/api/v1"+path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if session != "" {
+		req.Header.Set("Authorization", "Bearer "+session)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+	return v
+}
+
+func createPlaylist(t *testing.T, router *gin.Engine, name string) spotify.ID {
+	t.Helper()
+
+	w := do(t, router, http.MethodPost, "/playlist", model.PlaylistCreateRequest{Name: name})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create playlist: %d %s", w.Code, w.Body.String())
+	}
+	return decode[model.PlaylistResponse](t, w).SpotifyID
+}
+
+func includeItem(t *testing.T, router *gin.Engine, playlist spotify.ID, id spotify.ID, itemType model.ItemType, include bool) {
+	t.Helper()
+
+	w := do(t, router, http.MethodPost, "/playlist/item", model.ItemInclusionRequest{
+		ItemSpotifyID: id,
+		ItemType:      itemType,
+		PlaylistID:    playlist,
+		Include:       &include,
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("include %s: %d %s", id, w.Code, w.Body.String())
+	}
+}
+
+func publish(t *testing.T, router *gin.Engine, server *spotifytest.Server, playlist spotify.ID) []spotify.ID {
+	t.Helper()
+
+	w := do(t, router, http.MethodPost, "/playlist/publish", model.PlaylistPublishRequest{SpotifyID: playlist})
+	if w.Code != http.StatusOK {
+		t.Fatalf("publish: %d %s", w.Code, w.Body.String())
+	}
+
+	tracks, ok := server.Catalog.PlaylistTracks(playlist)
+	if !ok {
+		t.Fatalf("playlist %s does not exist on Spotify", playlist)
+	}
+	slices.Sort(tracks)
+	return tracks
+}
+
+func TestPublishArtistAppliesAutoExclusions(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Testers")
+
+	includeItem(t, router, playlist, "artist1", model.Artist, true)
+
+	got := publish(t, router, server, playlist)
+	want := []spotify.ID{"track1", "track2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
+
+func TestPublishExcludedTrack(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Other")
+
+	includeItem(t, router, playlist, "album4", model.Album, true)
+	includeItem(t, router, playlist, "track8", model.Track, false)
+
+	got := publish(t, router, server, playlist)
+	want := []spotify.ID{"track7"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+
+	w := do(t, router, http.MethodPost, "/playlist/item/undo", model.ItemInclusionRequest{
+		ItemSpotifyID: "track8",
+		ItemType:      model.Track,
+		PlaylistID:    playlist,
+		Include:       new(bool),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("undo: %d %s", w.Code, w.Body.String())
+	}
+
+	got = publish(t, router, server, playlist)
+	want = []spotify.ID{"track7", "track8"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v after undo, want %v", got, want)
+	}
+}
+
+func TestPublishNestedPlaylistUpdatesParent(t *testing.T) {
+	router, server := setup(t)
+	child := createPlaylist(t, router, "Child")
+	parent := createPlaylist(t, router, "Parent")
+
+	includeItem(t, router, child, "album4", model.Album, true)
+	includeItem(t, router, parent, "track1", model.Track, true)
+
+	w := do(t, router, http.MethodPost, "/playlist/include", model.ItemPlaylistRequest{ParentSpotifyID: parent, ChildSpotifyID: child})
+	if w.Code != http.StatusOK {
+		t.Fatalf("include playlist: %d %s", w.Code, w.Body.String())
+	}
+
+	publish(t, router, server, child)
+
+	got, _ := server.Catalog.PlaylistTracks(parent)
+	slices.Sort(got)
+	want := []spotify.ID{"track1", "track7", "track8"}
+	if !slices.Equal(got, want) {
+		t.Errorf("parent has %v, want %v", got, want)
+	}
+}
+
+func TestPublishOnlyAppliesTheDifference(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Picks")
+
+	includeItem(t, router, playlist, "track1", model.Track, true)
+	includeItem(t, router, playlist, "track2", model.Track, true)
+	publish(t, router, server, playlist)
+
+	before, _ := server.Catalog.Playlist(playlist)
+	publish(t, router, server, playlist)
+	if after, _ := server.Catalog.Playlist(playlist); after.SnapshotID != before.SnapshotID {
+		t.Errorf("republishing an unchanged playlist edited it: snapshot %s, was %s", after.SnapshotID, before.SnapshotID)
+	}
+
+	// Someone shuffles the playlist and adds a track of their own on Spotify
+	ctx := context.Background()
+	if err := server.Catalog.ReplacePlaylistTracks(ctx, playlist, "track2", "track7", "track1"); err != nil {
+		t.Fatal(err)
+	}
+	includeItem(t, router, playlist, "track8", model.Track, true)
+	publish(t, router, server, playlist)
+
+	got, _ := server.Catalog.PlaylistTracks(playlist)
+	want := []spotify.ID{"track1", "track2", "track8"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v, want %v in order", got, want)
+	}
+}
+
+func TestPublishKeepsTakenDownItems(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Picks")
+
+	// The empty ID is an item whose track was taken down
+	ctx := context.Background()
+	if err := server.Catalog.ReplacePlaylistTracks(ctx, playlist, "track2", "", "track7", "track1"); err != nil {
+		t.Fatal(err)
+	}
+	includeItem(t, router, playlist, "track1", model.Track, true)
+	includeItem(t, router, playlist, "track2", model.Track, true)
+	includeItem(t, router, playlist, "track8", model.Track, true)
+	publish(t, router, server, playlist)
+
+	got, _ := server.Catalog.PlaylistTracks(playlist)
+	tracks := slices.DeleteFunc(slices.Clone(got), func(id spotify.ID) bool { return id == "" })
+	want := []spotify.ID{"track1", "track2", "track8"}
+	if !slices.Equal(tracks, want) || len(got) != len(want)+1 {
+		t.Errorf("published %v, want %v in order and the taken down item left in place", got, want)
+	}
+
+	w := do(t, router, http.MethodPost, "/playlist/publish", model.PlaylistPublishRequest{SpotifyID: playlist, DryRun: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run: %d %s", w.Code, w.Body.String())
+	}
+	dry := decode[model.PublishReport](t, w).Playlists[0]
+	if dry.TrackCount != len(got) || len(dry.Warnings) != 1 || !strings.Contains(dry.Warnings[0], "1 items") {
+		t.Errorf("dry run counts %d tracks with warnings %v, want %d and the taken down item", dry.TrackCount, dry.Warnings, len(got))
+	}
+}
+
+func TestPlaylistTrackOrder(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Ordered")
+
+	includeItem(t, router, playlist, "track5", model.Track, true)
+	includeItem(t, router, playlist, "track7", model.Track, true)
+	includeItem(t, router, playlist, "track1", model.Track, true)
+
+	tests := []struct {
+		order model.TrackOrder
+		want  []spotify.ID
+	}{
+		{model.OrderResolved, []spotify.ID{"track1", "track5", "track7"}},
+		{model.OrderDuration, []spotify.ID{"track7", "track1", "track5"}},
+		{model.OrderDateAdded, []spotify.ID{"track5", "track7", "track1"}},
+	}
+	for _, tt := range tests {
+		w := do(t, router, http.MethodPut, "/playlist/"+string(playlist)+"/order", model.PlaylistOrderRequest{Order: tt.order})
+		if w.Code != http.StatusOK {
+			t.Fatalf("set order %s: %d %s", tt.order, w.Code, w.Body.String())
+		}
+		publish(t, router, server, playlist)
+
+		if got, _ := server.Catalog.PlaylistTracks(playlist); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: published %v, want %v", tt.order, got, tt.want)
+		}
+	}
+
+	w := do(t, router, http.MethodPut, "/playlist/"+string(playlist)+"/order", model.PlaylistOrderRequest{Order: model.OrderShuffle})
+	if res := decode[model.PlaylistResponse](t, w); res.TrackOrder != model.OrderShuffle || res.ShuffleSeed == 0 {
+		t.Errorf("shuffle without a seed got %+v, want a random seed", res)
+	}
+
+	w = do(t, router, http.MethodPut, "/playlist/"+string(playlist)+"/order", model.PlaylistOrderRequest{Order: "loudness"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown order: got %d, want 400", w.Code)
+	}
+}
+
+func TestPublishDropsDuplicateReleases(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Singles")
+
+	// track2 on First Album and track6 on the earlier single share an ISRC
+	includeItem(t, router, playlist, "track2", model.Track, true)
+	includeItem(t, router, playlist, "track6", model.Track, true)
+	includeItem(t, router, playlist, "track7", model.Track, true)
+
+	tests := []struct {
+		policy model.DuplicatePolicy
+		want   []spotify.ID
+	}{
+		{model.KeepEarliestRelease, []spotify.ID{"track6", "track7"}},
+		{model.KeepAlbumVersion, []spotify.ID{"track2", "track7"}},
+		{model.KeepAllVersions, []spotify.ID{"track2", "track6", "track7"}},
+	}
+	for _, tt := range tests {
+		w := do(t, router, http.MethodPut, "/playlist/"+string(playlist)+"/duplicates", model.PlaylistDuplicatesRequest{Policy: tt.policy})
+		if w.Code != http.StatusOK {
+			t.Fatalf("set policy %s: %d %s", tt.policy, w.Code, w.Body.String())
+		}
+
+		if got := publish(t, router, server, playlist); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: published %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestRenameAndDeletePlaylist(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Before")
+
+	w := do(t, router, http.MethodPut, "/playlist/"+string(playlist)+"/rename", model.PlaylistCreateRequest{Name: "After"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("rename: %d %s", w.Code, w.Body.String())
+	}
+	if p, _ := server.Catalog.Playlist(playlist); p.Name != "After" {
+		t.Errorf("Spotify name is %q, want %q", p.Name, "After")
+	}
+
+	w = do(t, router, http.MethodDelete, "/playlist/"+string(playlist), nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+	if _, ok := server.Catalog.Playlist(playlist); ok {
+		t.Error("playlist still exists on Spotify")
+	}
+
+	playlists := decode[[]model.PlaylistResponse](t, do(t, router, http.MethodGet, "/playlist", nil))
+	if len(playlists) != 0 {
+		t.Errorf("got %d local playlists after delete, want 0", len(playlists))
+	}
+}
+
+func TestPlaylistsAreScopedByOwner(t *testing.T) {
+	router, server := setup(t)
+
+	sessions := map[string]string{}
+	for _, user := range []string{"alice", "bob"} {
+		src.UseCatalog(catalog.NewSpotify(server.Client()), user)
+		session, err := src.CreateSession(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions[user] = session
+	}
+
+	w := doAs(t, router, sessions["alice"], http.MethodPost, "/playlist", model.PlaylistCreateRequest{Name: "Alice's"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create playlist: %d %s", w.Code, w.Body.String())
+	}
+	playlist := decode[model.PlaylistResponse](t, w).SpotifyID
+
+	if p, _ := server.Catalog.Playlist(playlist); p.Owner != "alice" {
+		t.Errorf("Spotify playlist is owned by %q, want alice", p.Owner)
+	}
+
+	own := decode[[]model.PlaylistResponse](t, doAs(t, router, sessions["alice"], http.MethodGet, "/playlist", nil))
+	if len(own) != 1 {
+		t.Errorf("alice sees %d playlists, want 1", len(own))
+	}
+	other := decode[[]model.PlaylistResponse](t, doAs(t, router, sessions["bob"], http.MethodGet, "/playlist", nil))
+	if len(other) != 0 {
+		t.Errorf("bob sees %d playlists, want 0", len(other))
+	}
+
+	include := true
+	w = doAs(t, router, sessions["bob"], http.MethodPost, "/playlist/item", model.ItemInclusionRequest{
+		ItemSpotifyID: "artist1",
+		ItemType:      model.Artist,
+		PlaylistID:    playlist,
+		Include:       &include,
+	})
+	if w.Code == http.StatusOK {
+		t.Error("bob could change alice's playlist")
+	}
+
+	w = doAs(t, router, "not-a-session", http.MethodGet, "/playlist", nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown session got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestExplainTrack(t *testing.T) {
+	router, _ := setup(t)
+	child := createPlaylist(t, router, "Child")
+	parent := createPlaylist(t, router, "Parent")
+
+	includeItem(t, router, child, "album1", model.Album, true)
+	includeItem(t, router, parent, "track2", model.Track, false)
+
+	w := do(t, router, http.MethodPost, "/playlist/include", model.ItemPlaylistRequest{ParentSpotifyID: parent, ChildSpotifyID: child})
+	if w.Code != http.StatusOK {
+		t.Fatalf("include playlist: %d %s", w.Code, w.Body.String())
+	}
+
+	w = do(t, router, http.MethodGet, "/playlist/"+string(parent)+"/explain/track2", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("explain: %d %s", w.Code, w.Body.String())
+	}
+	res := decode[model.ExplainResponse](t, w)
+
+	if res.Included || res.TrackName != "Second Song" {
+		t.Errorf("got %+v, want Second Song excluded", res)
+	}
+	if res.Winner == nil || res.Winner.ItemID != "track2" || res.Winner.Include || res.Winner.Depth != 0 {
+		t.Fatalf("winner is %+v, want the exclusion of track2 in the parent", res.Winner)
+	}
+	if len(res.Matches) != 2 {
+		t.Fatalf("got %d matches, want 2", len(res.Matches))
+	}
+
+	nested := res.Matches[1]
+	if nested.ItemID != "album1" || nested.ItemName != "First Album" || !nested.Include || nested.Depth != 1 {
+		t.Errorf("second match is %+v, want the inclusion of album1 one level down", nested)
+	}
+	if len(nested.Via) != 2 || nested.Via[0].SpotifyID != parent || nested.Via[1].Name != "Child" {
+		t.Errorf("album1 arrived via %+v, want Parent then Child", nested.Via)
+	}
+
+	w = do(t, router, http.MethodGet, "/playlist/"+string(child)+"/explain/track1", nil)
+	if res := decode[model.ExplainResponse](t, w); !res.Included || res.Winner.ItemID != "album1" {
+		t.Errorf("track1 in child got %+v, want it included by album1", res)
+	}
+}
+
+func TestPreviewPlaylist(t *testing.T) {
+	router, _ := setup(t)
+	child := createPlaylist(t, router, "Child")
+	parent := createPlaylist(t, router, "Parent")
+
+	includeItem(t, router, child, "album1", model.Album, true)
+	includeItem(t, router, parent, "track3", model.Track, false)
+
+	w := do(t, router, http.MethodPost, "/playlist/include", model.ItemPlaylistRequest{ParentSpotifyID: parent, ChildSpotifyID: child})
+	if w.Code != http.StatusOK {
+		t.Fatalf("include playlist: %d %s", w.Code, w.Body.String())
+	}
+
+	w = do(t, router, http.MethodGet, "/playlist/"+string(parent)+"/preview", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("preview: %d %s", w.Code, w.Body.String())
+	}
+	res := decode[model.PreviewResponse](t, w)
+
+	if res.TrackCount != 2 || len(res.Tracks) != 2 || res.TotalDurationMs != 201000+185000 {
+		t.Fatalf("got %+v, want track1 and track2 running 386000ms", res)
+	}
+	first := res.Tracks[0]
+	if first.SpotifyID != "track1" || first.Name != "Opening" || first.Album != "First Album" ||
+		!slices.Equal(first.Artists, []string{"The Testers"}) || first.DurationMs != 201000 {
+		t.Errorf("first track is %+v, want Opening by The Testers", first)
+	}
+	if first.Source.ItemID != "album1" || first.Source.ItemName != "First Album" || first.Source.Playlist.Name != "Child" {
+		t.Errorf("track1 comes from %+v, want album1 in Child", first.Source)
+	}
+
+	w = do(t, router, http.MethodGet, "/playlist/unknown/preview", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown playlist: got %d, want 404", w.Code)
+	}
+}
+
+func TestPlaylistMetadataFilters(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Filtered")
+	path := "/playlist/" + string(playlist) + "/filters"
+
+	includeItem(t, router, playlist, "album1", model.Album, true)
+	includeItem(t, router, playlist, "album2", model.Album, true)
+	includeItem(t, router, playlist, "album4", model.Album, true)
+	includeItem(t, router, playlist, "album5", model.Album, true)
+
+	minYear, maxDuration := 2016, 230000
+	w := do(t, router, http.MethodPut, path, model.MetadataFilters{MinYear: &minYear, MaxDurationMs: &maxDuration})
+	if w.Code != http.StatusOK {
+		t.Fatalf("set filters: %d %s", w.Code, w.Body.String())
+	}
+	if res := decode[model.PlaylistResponse](t, w); res.Filters == nil || *res.Filters.MinYear != minYear {
+		t.Errorf("got %+v, want the filters back", res)
+	}
+
+	got := publish(t, router, server, playlist)
+	want := []spotify.ID{"track1", "track2", "track4", "track9"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+
+	preview := decode[model.PreviewResponse](t, do(t, router, http.MethodGet, "/playlist/"+string(playlist)+"/preview", nil))
+	reasons := map[spotify.ID]string{}
+	for _, f := range preview.FilteredOut {
+		reasons[f.SpotifyID] = f.Reason
+	}
+	if len(reasons) != 3 || reasons["track5"] != "240000 ms long, longer than 230000 ms" || reasons["track8"] != "released in 2015, before 2016" {
+		t.Errorf("filtered out %v, want track5 as too long and track7 and track8 as too old", reasons)
+	}
+	if preview.Filters == nil || preview.TrackCount != 4 {
+		t.Errorf("preview has filters %v and %d tracks, want the filters and 4 tracks", preview.Filters, preview.TrackCount)
+	}
+
+	clean := false
+	w = do(t, router, http.MethodPut, path, model.MetadataFilters{Explicit: &clean})
+	if w.Code != http.StatusOK {
+		t.Fatalf("set filters: %d %s", w.Code, w.Body.String())
+	}
+	got = publish(t, router, server, playlist)
+	want = []spotify.ID{"track1", "track2", "track4", "track5", "track7", "track8"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v with clean tracks only, want %v", got, want)
+	}
+
+	maxYear := 2010
+	w = do(t, router, http.MethodPut, path, model.MetadataFilters{MinYear: &minYear, MaxYear: &maxYear})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("min year after max year: got %d, want 400", w.Code)
+	}
+}
+
+func TestExcludeNestedPlaylist(t *testing.T) {
+	router, server := setup(t)
+	workout := createPlaylist(t, router, "Workout")
+	overplayed := createPlaylist(t, router, "Overplayed")
+	mix := createPlaylist(t, router, "Mix")
+
+	includeItem(t, router, workout, "album1", model.Album, true)
+	includeItem(t, router, workout, "album4", model.Album, true)
+	includeItem(t, router, overplayed, "track2", model.Track, true)
+	includeItem(t, router, overplayed, "track7", model.Track, true)
+
+	link := model.ItemPlaylistRequest{ParentSpotifyID: mix, ChildSpotifyID: workout}
+	if w := do(t, router, http.MethodPost, "/playlist/include", link); w.Code != http.StatusOK {
+		t.Fatalf("include playlist: %d %s", w.Code, w.Body.String())
+	}
+	link.ChildSpotifyID = overplayed
+	if w := do(t, router, http.MethodPost, "/playlist/exclude", link); w.Code != http.StatusOK {
+		t.Fatalf("exclude playlist: %d %s", w.Code, w.Body.String())
+	}
+
+	// Publishing the excluded playlist updates the playlist excluding it
+	publish(t, router, server, overplayed)
+	got, _ := server.Catalog.PlaylistTracks(mix)
+	slices.Sort(got)
+	want := []spotify.ID{"track1", "track8"}
+	if !slices.Equal(got, want) {
+		t.Errorf("mix has %v, want %v", got, want)
+	}
+
+	explain := decode[model.ExplainResponse](t, do(t, router, http.MethodGet, "/playlist/"+string(mix)+"/explain/track7", nil))
+	if explain.Included || explain.Winner == nil || explain.Winner.ItemType != model.PlaylistItem || explain.Winner.ItemName != "Overplayed" {
+		t.Errorf("track7 explained as %+v, want it excluded by Overplayed", explain.Winner)
+	}
+
+	if w := do(t, router, http.MethodPost, "/playlist/exclude/undo", link); w.Code != http.StatusOK {
+		t.Fatalf("undo exclude playlist: %d %s", w.Code, w.Body.String())
+	}
+	got = publish(t, router, server, mix)
+	want = []spotify.ID{"track1", "track2", "track7", "track8"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v after undo, want %v", got, want)
+	}
+
+	link.ChildSpotifyID = mix
+	if w := do(t, router, http.MethodPost, "/playlist/exclude", link); w.Code != http.StatusBadRequest {
+		t.Errorf("excluding a playlist from itself: got %d, want 400", w.Code)
+	}
+}
+
+func TestNestedPlaylistsApplyTheirOwnFilters(t *testing.T) {
+	router, server := setup(t)
+	clean := createPlaylist(t, router, "Clean")
+	mix := createPlaylist(t, router, "Mix")
+	everything := createPlaylist(t, router, "Everything")
+	explicitOnly := createPlaylist(t, router, "Explicit only")
+
+	includeItem(t, router, clean, "album1", model.Album, true)
+	includeItem(t, router, clean, "album5", model.Album, true)
+	explicit := false
+	w := do(t, router, http.MethodPut, "/playlist/"+string(clean)+"/filters", model.MetadataFilters{Explicit: &explicit})
+	if w.Code != http.StatusOK {
+		t.Fatalf("set filters: %d %s", w.Code, w.Body.String())
+	}
+
+	link := model.ItemPlaylistRequest{ParentSpotifyID: mix, ChildSpotifyID: clean}
+	if w := do(t, router, http.MethodPost, "/playlist/include", link); w.Code != http.StatusOK {
+		t.Fatalf("include playlist: %d %s", w.Code, w.Body.String())
+	}
+	want := publish(t, router, server, clean)
+	if slices.Contains(want, "track9") {
+		t.Fatalf("clean playlist has the explicit track9: %v", want)
+	}
+	if got := publish(t, router, server, mix); !slices.Equal(got, want) {
+		t.Errorf("mix has %v, want the tracks of the clean playlist %v", got, want)
+	}
+
+	// Excluding it only subtracts the tracks it keeps
+	includeItem(t, router, everything, "album1", model.Album, true)
+	includeItem(t, router, everything, "album5", model.Album, true)
+	link = model.ItemPlaylistRequest{ParentSpotifyID: explicitOnly, ChildSpotifyID: everything}
+	if w := do(t, router, http.MethodPost, "/playlist/include", link); w.Code != http.StatusOK {
+		t.Fatalf("include playlist: %d %s", w.Code, w.Body.String())
+	}
+	link.ChildSpotifyID = clean
+	if w := do(t, router, http.MethodPost, "/playlist/exclude", link); w.Code != http.StatusOK {
+		t.Fatalf("exclude playlist: %d %s", w.Code, w.Body.String())
+	}
+	if got := publish(t, router, server, explicitOnly); !slices.Equal(got, []spotify.ID{"track9"}) {
+		t.Errorf("explicit only has %v, want [track9]", got)
+	}
+}
+
+func TestSetExpressionPlaylist(t *testing.T) {
+	router, server := setup(t)
+	mine := createPlaylist(t, router, "Mine")
+	partner := createPlaylist(t, router, "Partner")
+	skip := createPlaylist(t, router, "Skip")
+	both := createPlaylist(t, router, "Both")
+
+	includeItem(t, router, mine, "album1", model.Album, true)
+	includeItem(t, router, mine, "track7", model.Track, true)
+	includeItem(t, router, partner, "track1", model.Track, true)
+	includeItem(t, router, partner, "track2", model.Track, true)
+	includeItem(t, router, partner, "track7", model.Track, true)
+	includeItem(t, router, skip, "track7", model.Track, true)
+
+	// (Mine ∩ Partner) − Skip
+	expression := &model.SetExpression{Op: model.OpDifference, Operands: []model.SetExpression{
+		{Op: model.OpIntersection, Operands: []model.SetExpression{{Playlist: mine}, {Playlist: partner}}},
+		{Playlist: skip},
+	}}
+	path := "/playlist/" + string(both) + "/expression"
+	w := do(t, router, http.MethodPut, path, model.PlaylistExpressionRequest{Expression: expression})
+	if w.Code != http.StatusOK {
+		t.Fatalf("set expression: %d %s", w.Code, w.Body.String())
+	}
+	if res := decode[model.PlaylistResponse](t, w); res.Expression == nil || res.Expression.Op != model.OpDifference {
+		t.Errorf("got %+v, want the expression back", res)
+	}
+
+	got := publish(t, router, server, both)
+	want := []spotify.ID{"track1", "track2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+
+	// Publishing an operand updates the playlists defined over it
+	includeItem(t, router, skip, "track2", model.Track, true)
+	publish(t, router, server, skip)
+	got, _ = server.Catalog.PlaylistTracks(both)
+	if want := []spotify.ID{"track1"}; !slices.Equal(got, want) {
+		t.Errorf("both has %v after skipping track2, want %v", got, want)
+	}
+
+	// Mine can't be defined over Both, which is defined over Mine
+	w = do(t, router, http.MethodPut, "/playlist/"+string(mine)+"/expression", model.PlaylistExpressionRequest{
+		Expression: &model.SetExpression{Op: model.OpUnion, Operands: []model.SetExpression{{Playlist: both}, {Playlist: partner}}},
+	})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Mine → Both → Mine") {
+		t.Errorf("cycle: got %d %s, want 400 naming the loop", w.Code, w.Body.String())
+	}
+
+	w = do(t, router, http.MethodPut, path, model.PlaylistExpressionRequest{
+		Expression: &model.SetExpression{Op: model.OpUnion, Operands: []model.SetExpression{{Playlist: mine}}},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("single operand: got %d, want 400", w.Code)
+	}
+
+	w = do(t, router, http.MethodPut, path, model.PlaylistExpressionRequest{})
+	if w.Code != http.StatusOK {
+		t.Fatalf("remove expression: %d %s", w.Code, w.Body.String())
+	}
+	if got := publish(t, router, server, both); len(got) != 0 {
+		t.Errorf("published %v without an expression, want nothing", got)
+	}
+}
+
+func TestArtistInclusionModes(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Artist Modes")
+	include := true
+
+	// Without the builtin rule set, the latest release is the live album
+	rulesets := "/playlist/" + string(playlist) + "/rulesets"
+	attached := decode[[]model.RuleSet](t, do(t, router, http.MethodGet, rulesets, nil))
+	if w := do(t, router, http.MethodDelete, fmt.Sprintf("%s/%d", rulesets, attached[0].ID), nil); w.Code != http.StatusNoContent {
+		t.Fatalf("detach: %d %s", w.Code, w.Body.String())
+	}
+
+	w := do(t, router, http.MethodPost, "/playlist/item", model.ItemInclusionRequest{
+		ItemSpotifyID: "artist1",
+		ItemType:      model.Artist,
+		PlaylistID:    playlist,
+		Include:       &include,
+		Artist:        &model.ArtistInclusion{Mode: model.ArtistTopTracks, Count: 1},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("include artist: %d %s", w.Code, w.Body.String())
+	}
+
+	got := publish(t, router, server, playlist)
+	want := []spotify.ID{"track2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v with the top track, want %v", got, want)
+	}
+
+	inclusions := decode[[]model.ItemResponse](t, do(t, router, http.MethodGet, "/playlist/"+string(playlist)+"/inclusions", nil))
+	if len(inclusions) != 1 || inclusions[0].Badge != "Top 1" || inclusions[0].Artist == nil {
+		t.Errorf("inclusions are %+v, want artist1 badged Top 1", inclusions)
+	}
+
+	w = do(t, router, http.MethodPost, "/playlist/item", model.ItemInclusionRequest{
+		ItemSpotifyID: "artist1",
+		ItemType:      model.Artist,
+		PlaylistID:    playlist,
+		Include:       &include,
+		Artist:        &model.ArtistInclusion{Mode: model.ArtistLatest, Count: 1},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("include artist: %d %s", w.Code, w.Body.String())
+	}
+	got = publish(t, router, server, playlist)
+	want = []spotify.ID{"track4", "track5"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v with the latest release, want %v", got, want)
+	}
+
+	w = do(t, router, http.MethodPost, "/playlist/item", model.ItemInclusionRequest{
+		ItemSpotifyID: "artist1",
+		ItemType:      model.Artist,
+		PlaylistID:    playlist,
+		Include:       &include,
+		Artist:        &model.ArtistInclusion{Mode: model.ArtistSince, Since: "last year"},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("since without a date: got %d, want 400", w.Code)
+	}
+}
+
+func TestNestedPlaylistLoopsAndDepth(t *testing.T) {
+	t.Setenv("PLAYLIST_MAX_NESTING_DEPTH", "2")
+	router, _ := setup(t)
+	top := createPlaylist(t, router, "Top")
+	middle := createPlaylist(t, router, "Middle")
+	bottom := createPlaylist(t, router, "Bottom")
+	extra := createPlaylist(t, router, "Extra")
+
+	nest := func(path string, parent spotify.ID, child spotify.ID) *httptest.ResponseRecorder {
+		t.Helper()
+		return do(t, router, http.MethodPost, path, model.ItemPlaylistRequest{ParentSpotifyID: parent, ChildSpotifyID: child})
+	}
+	if w := nest("/playlist/include", top, middle); w.Code != http.StatusOK {
+		t.Fatalf("include: %d %s", w.Code, w.Body.String())
+	}
+	if w := nest("/playlist/include", middle, bottom); w.Code != http.StatusOK {
+		t.Fatalf("include: %d %s", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{"/playlist/include", "/playlist/exclude"} {
+		w := nest(path, bottom, top)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Bottom → Top → Middle → Bottom") {
+			t.Errorf("%s closing a loop: got %d %s, want 400 naming the loop", path, w.Code, w.Body.String())
+		}
+	}
+
+	// Extra above Top, or below Bottom, would be a third level
+	if w := nest("/playlist/include", extra, top); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "limit of 2") {
+		t.Errorf("nesting too deep above: got %d %s, want 400", w.Code, w.Body.String())
+	}
+	if w := nest("/playlist/exclude", bottom, extra); w.Code != http.StatusBadRequest {
+		t.Errorf("nesting too deep below: got %d %s, want 400", w.Code, w.Body.String())
+	}
+	if w := nest("/playlist/include", extra, middle); w.Code != http.StatusOK {
+		t.Errorf("nesting within the limit: got %d %s, want 200", w.Code, w.Body.String())
+	}
+}
+
+func TestDryRunPublish(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Dry")
+	mix := createPlaylist(t, router, "Mix")
+	empty := createPlaylist(t, router, "Empty")
+
+	includeItem(t, router, playlist, "album1", model.Album, true)
+	link := model.ItemPlaylistRequest{ParentSpotifyID: mix, ChildSpotifyID: playlist}
+	if w := do(t, router, http.MethodPost, "/playlist/include", link); w.Code != http.StatusOK {
+		t.Fatalf("include playlist: %d %s", w.Code, w.Body.String())
+	}
+	publish(t, router, server, playlist)
+
+	includeItem(t, router, playlist, "track1", model.Track, false)
+	includeItem(t, router, playlist, "gone", model.Track, true)
+
+	w := do(t, router, http.MethodPost, "/playlist/publish", model.PlaylistPublishRequest{SpotifyID: playlist, DryRun: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run: %d %s", w.Code, w.Body.String())
+	}
+	report := decode[model.PublishReport](t, w)
+	if len(report.Playlists) != 2 || report.Playlists[0].SpotifyID != playlist || report.Playlists[1].SpotifyID != mix {
+		t.Fatalf("report covers %+v, want the playlist and then its parent", report.Playlists)
+	}
+	dry := report.Playlists[0]
+	wantAdd := []model.ReportTrack{{SpotifyID: "gone"}}
+	wantRemove := []model.ReportTrack{{SpotifyID: "track1", Name: "Opening"}}
+	if !slices.Equal(dry.Add, wantAdd) || !slices.Equal(dry.Remove, wantRemove) || dry.TrackCount != 2 {
+		t.Errorf("changes are %+v, want gone added, track1 removed and 2 tracks", dry)
+	}
+	if len(dry.Warnings) != 1 || !strings.Contains(dry.Warnings[0], "unavailable on Spotify: gone") {
+		t.Errorf("warnings are %v, want gone unavailable", dry.Warnings)
+	}
+
+	got, _ := server.Catalog.PlaylistTracks(playlist)
+	slices.Sort(got)
+	if want := []spotify.ID{"track1", "track2"}; !slices.Equal(got, want) {
+		t.Errorf("dry run left %v on Spotify, want %v", got, want)
+	}
+
+	w = do(t, router, http.MethodPost, "/playlist/publishall", model.PublishAllRequest{DryRun: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("dry run all: %d %s", w.Code, w.Body.String())
+	}
+	warnings := map[spotify.ID][]string{}
+	for _, changes := range decode[model.PublishReport](t, w).Playlists {
+		warnings[changes.SpotifyID] = changes.Warnings
+	}
+	if len(warnings) != 3 || !slices.Equal(warnings[empty], []string{"the playlist would be empty"}) {
+		t.Errorf("warnings are %v, want all three playlists and Empty warned about", warnings)
+	}
+	if got, _ := server.Catalog.PlaylistTracks(mix); len(got) != 2 {
+		t.Errorf("dry run published %v to the parent, want it left as published", got)
+	}
+}
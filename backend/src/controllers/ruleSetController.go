@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/services"
+	"github.com/gin-gonic/gin"
+	"github.com/zmb3/spotify/v2"
+)
+
+// GetRuleSets godoc
+// @Summary      List auto-exclusion rule sets
+// @Description  Responds with the builtin rule sets and those of the user. The builtin Default rule set is attached to new playlists; Remasters, Demos and Karaoke can be attached by hand.
+// @Tags         rulesets
+// @Produce      json
+// @Success      200  {array}   model.RuleSet
+// @Failure      500  {object}  model.ErrorResponse
+// @Router       /rulesets [get]
+func GetRuleSets(c *gin.Context) {
+	res, err := services.GetRuleSets(src.Conn(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// GetRuleSet godoc
+// @Summary      Get an auto-exclusion rule set
+// @Tags         rulesets
+// @Produce      json
+// @Param        id   path      int  true  "Rule set ID"
+// @Success      200  {object}  model.RuleSet
+// @Failure      400  {object}  model.ErrorResponse "code: invalid_request"
+// @Failure      404  {object}  model.ErrorResponse "code: not_found"
+// @Router       /rulesets/{id} [get]
+func GetRuleSet(c *gin.Context) {
+	id, ok := ruleSetID(c, "id")
+	if !ok {
+		return
+	}
+
+	res, err := services.GetRuleSet(src.Conn(c), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// CreateRuleSet godoc
+// @Summary      Create an auto-exclusion rule set
+// @Description  Each rule compares a field (album_name, album_type or track_name) with a pattern, ignoring case: contains, equals or regex. A keyword rule takes a keyword (remaster, demo, karaoke, live, instrumental or acoustic) as the pattern and matches it as a whole word in the given languages (en, es, pt, fr, de or it), or in all of them. Album rules exclude albums of an included artist, track rules exclude tracks of an included album or of the remaining albums of an included artist.
+// @Tags         rulesets
+// @Accept       json
+// @Produce      json
+// @Param        body  body      model.RuleSetRequest  true  "Rule set"
+// @Success      201   {object}  model.RuleSet
+// @Failure      400   {object}  model.ErrorResponse "code: invalid_request"
+// @Failure      500   {object}  model.ErrorResponse
+// @Router       /rulesets [post]
+func CreateRuleSet(c *gin.Context) {
+	var req model.RuleSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "Name is required")
+		return
+	}
+
+	res, err := services.CreateRuleSet(src.Conn(c), req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, res)
+}
+
+// UpdateRuleSet godoc
+// @Summary      Replace an auto-exclusion rule set
+// @Description  Renames the rule set and replaces its rules. Builtin rule sets can't be changed. Items the old rules excluded stay excluded.
+// @Tags         rulesets
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int                   true  "Rule set ID"
+// @Param        body  body      model.RuleSetRequest  true  "Rule set"
+// @Success      200   {object}  model.RuleSet
+// @Failure      400   {object}  model.ErrorResponse "code: invalid_request"
+// @Failure      404   {object}  model.ErrorResponse "code: not_found"
+// @Router       /rulesets/{id} [put]
+func UpdateRuleSet(c *gin.Context) {
+	id, ok := ruleSetID(c, "id")
+	if !ok {
+		return
+	}
+	var req model.RuleSetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "Name is required")
+		return
+	}
+
+	res, err := services.UpdateRuleSet(src.Conn(c), id, req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// DeleteRuleSet godoc
+// @Summary      Delete an auto-exclusion rule set
+// @Description  Deletes the rule set and detaches it from every playlist. Builtin rule sets can't be deleted.
+// @Tags         rulesets
+// @Param        id   path  int  true  "Rule set ID"
+// @Success      204
+// @Failure      400  {object}  model.ErrorResponse "code: invalid_request"
+// @Failure      404  {object}  model.ErrorResponse "code: not_found"
+// @Router       /rulesets/{id} [delete]
+func DeleteRuleSet(c *gin.Context) {
+	id, ok := ruleSetID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteRuleSet(src.Conn(c), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// TestRuleSet godoc
+// @Summary      Show what rules would exclude for an artist
+// @Description  Lists the albums and tracks that including the artist in a playlist would exclude with the given rules. Nothing is stored.
+// @Tags         rulesets
+// @Accept       json
+// @Produce      json
+// @Param        body  body      model.RuleSetTestRequest  true  "Artist and rules"
+// @Success      200   {object}  model.RuleSetTestResponse
+// @Failure      400   {object}  model.ErrorResponse "code: invalid_request"
+// @Failure      500   {object}  model.ErrorResponse
+// @Router       /rulesets/test [post]
+func TestRuleSet(c *gin.Context) {
+	var req model.RuleSetTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "ArtistID is required")
+		return
+	}
+
+	res, err := services.TestRuleSet(src.Conn(c), req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// GetPlaylistRuleSets godoc
+// @Summary      List the rule sets attached to a playlist
+// @Tags         rulesets
+// @Produce      json
+// @Param        id   path      string  true  "Spotify Playlist ID"
+// @Success      200  {array}   model.RuleSet
+// @Failure      404  {object}  model.ErrorResponse "code: not_found"
+// @Router       /playlist/{id}/rulesets [get]
+func GetPlaylistRuleSets(c *gin.Context) {
+	res, err := services.GetPlaylistRuleSets(src.Conn(c), spotify.ID(c.Param("id")))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// AttachRuleSet godoc
+// @Summary      Attach a rule set to a playlist
+// @Description  The rule set applies to artists and albums included in the playlist from then on.
+// @Tags         rulesets
+// @Param        id         path  string  true  "Spotify Playlist ID"
+// @Param        ruleSetId  path  int     true  "Rule set ID"
+// @Success      204
+// @Failure      400  {object}  model.ErrorResponse "code: invalid_request"
+// @Failure      404  {object}  model.ErrorResponse "code: not_found"
+// @Router       /playlist/{id}/rulesets/{ruleSetId} [post]
+func AttachRuleSet(c *gin.Context) {
+	ruleSet, ok := ruleSetID(c, "ruleSetId")
+	if !ok {
+		return
+	}
+
+	if err := services.AttachRuleSet(src.Conn(c), spotify.ID(c.Param("id")), ruleSet); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// DetachRuleSet godoc
+// @Summary      Detach a rule set from a playlist
+// @Description  Items the rule set already excluded stay excluded.
+// @Tags         rulesets
+// @Param        id         path  string  true  "Spotify Playlist ID"
+// @Param        ruleSetId  path  int     true  "Rule set ID"
+// @Success      204
+// @Failure      400  {object}  model.ErrorResponse "code: invalid_request"
+// @Failure      404  {object}  model.ErrorResponse "code: not_found"
+// @Router       /playlist/{id}/rulesets/{ruleSetId} [delete]
+func DetachRuleSet(c *gin.Context) {
+	ruleSet, ok := ruleSetID(c, "ruleSetId")
+	if !ok {
+		return
+	}
+
+	if err := services.DetachRuleSet(src.Conn(c), spotify.ID(c.Param("id")), ruleSet); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ruleSetID parses a rule set ID path parameter, responding with a bad
+// request when it isn't one.
+func ruleSetID(c *gin.Context, param string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 0)
+	if err != nil {
+		badRequest(c, "Invalid rule set ID")
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/zmb3/spotify/v2"
+)
+
+func excludedIDs(items []model.ExcludedItem) []spotify.ID {
+	ids := []spotify.ID{}
+	for _, item := range items {
+		ids = append(ids, item.SpotifyID)
+	}
+	return ids
+}
+
+func TestRuleSetCRUD(t *testing.T) {
+	router, _ := setup(t)
+
+	w := do(t, router, http.MethodGet, "/rulesets", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list: %d %s", w.Code, w.Body.String())
+	}
+	ruleSets := decode[[]model.RuleSet](t, w)
+	names := []string{}
+	for _, r := range ruleSets {
+		if r.Builtin {
+			names = append(names, r.Name)
+		}
+	}
+	if want := []string{"Default", "Demos", "Karaoke", "Remasters"}; !slices.Equal(names, want) {
+		t.Fatalf("got %v, want only the builtin rule sets %v", names, want)
+	}
+	builtin := ruleSets[0].ID
+
+	w = do(t, router, http.MethodPost, "/rulesets", model.RuleSetRequest{
+		Name:  "Demos",
+		Rules: []model.ExclusionRule{{Field: model.FieldTrackName, Match: model.MatchRegex, Pattern: `\b(demo|karaoke)\b`}},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	created := decode[model.RuleSet](t, w)
+	path := fmt.Sprintf("/rulesets/%d", created.ID)
+
+	w = do(t, router, http.MethodPut, path, model.RuleSetRequest{
+		Name: "Remasters",
+		Rules: []model.ExclusionRule{
+			{Field: model.FieldTrackName, Match: model.MatchContains, Pattern: "remaster"},
+			{Field: model.FieldAlbumType, Match: model.MatchEquals, Pattern: "compilation"},
+		},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+
+	got := decode[model.RuleSet](t, do(t, router, http.MethodGet, path, nil))
+	if got.Name != "Remasters" || len(got.Rules) != 2 || got.Rules[0].Pattern != "remaster" {
+		t.Errorf("got %+v after update", got)
+	}
+
+	w = do(t, router, http.MethodPost, "/rulesets", model.RuleSetRequest{
+		Name:  "Broken",
+		Rules: []model.ExclusionRule{{Field: model.FieldTrackName, Match: model.MatchRegex, Pattern: "("}},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid regex: got %d, want 400", w.Code)
+	}
+
+	w = do(t, router, http.MethodPost, "/rulesets", model.RuleSetRequest{
+		Name:  "Broken",
+		Rules: []model.ExclusionRule{{Field: model.FieldTrackName, Match: model.MatchKeyword, Pattern: "demo", Languages: []string{"xx"}}},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown language: got %d, want 400", w.Code)
+	}
+
+	w = do(t, router, http.MethodPut, fmt.Sprintf("/rulesets/%d", builtin), model.RuleSetRequest{Name: "Mine"})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("update builtin: got %d, want 400", w.Code)
+	}
+
+	w = do(t, router, http.MethodDelete, path, nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+	w = do(t, router, http.MethodGet, path, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("deleted: got %d, want 404", w.Code)
+	}
+}
+
+func TestRuleSetTest(t *testing.T) {
+	router, _ := setup(t)
+
+	builtin := decode[[]model.RuleSet](t, do(t, router, http.MethodGet, "/rulesets", nil))[0]
+	w := do(t, router, http.MethodPost, "/rulesets/test", model.RuleSetTestRequest{ArtistID: "artist1", Rules: builtin.Rules})
+	if w.Code != http.StatusOK {
+		t.Fatalf("test: %d %s", w.Code, w.Body.String())
+	}
+
+	res := decode[model.RuleSetTestResponse](t, w)
+	if got, want := excludedIDs(res.Albums), []spotify.ID{"album2"}; !slices.Equal(got, want) {
+		t.Errorf("albums %v, want %v", got, want)
+	}
+	if got, want := excludedIDs(res.Tracks), []spotify.ID{"track3"}; !slices.Equal(got, want) {
+		t.Errorf("tracks %v, want %v", got, want)
+	}
+	if res.Tracks[0].Rule.Pattern != "- live" {
+		t.Errorf("track3 excluded by %+v, want the \"- live\" rule", res.Tracks[0].Rule)
+	}
+}
+
+func TestPlaylistRuleSets(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Testers")
+	path := "/playlist/" + string(playlist) + "/rulesets"
+
+	attached := decode[[]model.RuleSet](t, do(t, router, http.MethodGet, path, nil))
+	if len(attached) != 1 || !attached[0].Builtin {
+		t.Fatalf("new playlist has %+v, want the builtin rule set", attached)
+	}
+
+	w := do(t, router, http.MethodDelete, fmt.Sprintf("%s/%d", path, attached[0].ID), nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("detach: %d %s", w.Code, w.Body.String())
+	}
+	w = do(t, router, http.MethodPost, "/rulesets", model.RuleSetRequest{
+		Name:  "Singles",
+		Rules: []model.ExclusionRule{{Field: model.FieldAlbumType, Match: model.MatchEquals, Pattern: "single"}},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	singles := decode[model.RuleSet](t, w)
+	w = do(t, router, http.MethodPost, fmt.Sprintf("%s/%d", path, singles.ID), nil)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("attach: %d %s", w.Code, w.Body.String())
+	}
+
+	includeItem(t, router, playlist, "artist1", model.Artist, true)
+
+	got := publish(t, router, server, playlist)
+	want := []spotify.ID{"track1", "track2", "track3", "track4", "track5"}
+	if !slices.Equal(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+
+	w = do(t, router, http.MethodPost, path+"/999", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown rule set: got %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/services"
+	"github.com/gin-gonic/gin"
+	"github.com/zmb3/spotify/v2"
+)
+
+// GetSchedules godoc
+// @Summary      List republishing schedules
+// @Description  Responds with the schedules of the user's playlists, when they run next and how their last run went.
+// @Tags         schedules
+// @Produce      json
+// @Success      200  {array}   model.ScheduleResponse
+// @Failure      500  {object}  model.ErrorResponse
+// @Router       /schedules [get]
+func GetSchedules(c *gin.Context) {
+	res, err := services.GetSchedules(src.Conn(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// SetSchedule godoc
+// @Summary      Schedule a playlist to be republished
+// @Description  Republishes the playlist in the background by a cron expression (like "0 6 * * 1") or an interval (like "12h"), at most every 15 minutes. A run only publishes when the tracks the playlist resolves to changed since the schedule last published it. Replaces an earlier schedule of the playlist, keeping it paused if it was.
+// @Tags         schedules
+// @Accept       json
+// @Produce      json
+// @Param        id    path      string                 true  "Spotify Playlist ID"
+// @Param        body  body      model.ScheduleRequest  true  "When to republish"
+// @Success      200   {object}  model.ScheduleResponse
+// @Failure      400   {object}  model.ErrorResponse "code: invalid_request"
+// @Failure      404   {object}  model.ErrorResponse "code: not_found"
+// @Router       /playlist/{id}/schedule [put]
+func SetSchedule(c *gin.Context) {
+	var req model.ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		badRequest(c, "Invalid schedule")
+		return
+	}
+
+	res, err := services.SetSchedule(src.Conn(c), spotify.ID(c.Param("id")), req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// DeleteSchedule godoc
+// @Summary      Stop republishing a playlist
+// @Tags         schedules
+// @Param        id   path  string  true  "Spotify Playlist ID"
+// @Success      204
+// @Failure      404  {object}  model.ErrorResponse "code: not_found"
+// @Router       /playlist/{id}/schedule [delete]
+func DeleteSchedule(c *gin.Context) {
+	if err := services.DeleteSchedule(src.Conn(c), spotify.ID(c.Param("id"))); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// PauseSchedule godoc
+// @Summary      Pause a republishing schedule
+// @Description  Stops running the schedule until it is resumed. It can still be run by hand.
+// @Tags         schedules
+// @Produce      json
+// @Param        id   path      string  true  "Spotify Playlist ID"
+// @Success      200  {object}  model.ScheduleResponse
+// @Failure      404  {object}  model.ErrorResponse "code: not_found"
+// @Router       /playlist/{id}/schedule/pause [post]
+func PauseSchedule(c *gin.Context) {
+	setSchedulePaused(c, true)
+}
+
+// ResumeSchedule godoc
+// @Summary      Resume a paused republishing schedule
+// @Tags         schedules
+// @Produce      json
+// @Param        id   path      string  true  "Spotify Playlist ID"
+// @Success      200  {object}  model.ScheduleResponse
+// @Failure      404  {object}  model.ErrorResponse "code: not_found"
+// @Router       /playlist/{id}/schedule/resume [post]
+func ResumeSchedule(c *gin.Context) {
+	setSchedulePaused(c, false)
+}
+
+func setSchedulePaused(c *gin.Context, paused bool) {
+	res, err := services.PauseSchedule(src.Conn(c), spotify.ID(c.Param("id")), paused)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// RunSchedule godoc
+// @Summary      Run a republishing schedule now
+// @Description  Runs the schedule right away, paused or not, and responds once it is done. A failed publish is reported in lastStatus and lastError, like for scheduled runs.
+// @Tags         schedules
+// @Produce      json
+// @Param        id   path      string  true  "Spotify Playlist ID"
+// @Success      200  {object}  model.ScheduleResponse
+// @Failure      404  {object}  model.ErrorResponse "code: not_found"
+// @Router       /playlist/{id}/schedule/run [post]
+func RunSchedule(c *gin.Context) {
+	res, err := services.RunSchedule(src.Conn(c), spotify.ID(c.Param("id")))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, res)
+}
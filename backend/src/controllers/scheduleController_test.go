@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/zmb3/spotify/v2"
+)
+
+func TestSchedules(t *testing.T) {
+	router, server := setup(t)
+	playlist := createPlaylist(t, router, "Scheduled")
+	path := "/playlist/" + string(playlist) + "/schedule"
+
+	includeItem(t, router, playlist, "album1", model.Album, true)
+
+	for _, req := range []model.ScheduleRequest{{Interval: "5m"}, {Cron: "* * * * *"}, {Cron: "0,5 * * * *"}, {Cron: "every monday"}, {}, {Cron: "0 6 * * 1", Interval: "12h"}} {
+		if w := do(t, router, http.MethodPut, path, req); w.Code != http.StatusBadRequest {
+			t.Errorf("schedule %+v: got %d, want 400", req, w.Code)
+		}
+	}
+	if w := do(t, router, http.MethodPost, path+"/run", nil); w.Code != http.StatusNotFound {
+		t.Errorf("running a missing schedule: got %d, want 404", w.Code)
+	}
+
+	w := do(t, router, http.MethodPut, path, model.ScheduleRequest{Interval: "12h"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("schedule: %d %s", w.Code, w.Body.String())
+	}
+	if res := decode[model.ScheduleResponse](t, w); res.Spec != "@every 12h" || res.NextRunAt == nil {
+		t.Errorf("got %+v, want an interval of 12h with a next run", res)
+	}
+
+	run := func(want model.ScheduleStatus) {
+		t.Helper()
+		w := do(t, router, http.MethodPost, path+"/run", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("run: %d %s", w.Code, w.Body.String())
+		}
+		if res := decode[model.ScheduleResponse](t, w); res.LastStatus != want || res.LastRunAt == nil {
+			t.Errorf("run went %q (%s), want %q", res.LastStatus, res.LastError, want)
+		}
+	}
+	run(model.SchedulePublished)
+	run(model.ScheduleUnchanged)
+
+	// An edit on Spotify since the last run is undone
+	if err := server.Catalog.ReplacePlaylistTracks(context.Background(), playlist, "track1"); err != nil {
+		t.Fatal(err)
+	}
+	run(model.SchedulePublished)
+
+	includeItem(t, router, playlist, "track7", model.Track, true)
+	run(model.SchedulePublished)
+	got, _ := server.Catalog.PlaylistTracks(playlist)
+	slices.Sort(got)
+	if want := []spotify.ID{"track1", "track2", "track7"}; !slices.Equal(got, want) {
+		t.Errorf("republished %v, want %v", got, want)
+	}
+
+	w = do(t, router, http.MethodPost, path+"/pause", nil)
+	if res := decode[model.ScheduleResponse](t, w); !res.Paused || res.NextRunAt != nil {
+		t.Errorf("paused schedule is %+v, want it paused without a next run", res)
+	}
+	schedules := decode[[]model.ScheduleResponse](t, do(t, router, http.MethodGet, "/schedules", nil))
+	if len(schedules) != 1 || schedules[0].PlaylistName != "Scheduled" || !schedules[0].Paused || schedules[0].LastStatus != model.SchedulePublished {
+		t.Errorf("schedules are %+v, want the paused schedule", schedules)
+	}
+	run(model.ScheduleUnchanged)
+
+	w = do(t, router, http.MethodPost, path+"/resume", nil)
+	if res := decode[model.ScheduleResponse](t, w); res.Paused || res.NextRunAt == nil {
+		t.Errorf("resumed schedule is %+v, want it running", res)
+	}
+
+	if w := do(t, router, http.MethodDelete, path, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: %d %s", w.Code, w.Body.String())
+	}
+	if schedules := decode[[]model.ScheduleResponse](t, do(t, router, http.MethodGet, "/schedules", nil)); len(schedules) != 0 {
+		t.Errorf("schedules are %+v after deleting, want none", schedules)
+	}
+
+	// Clearing the playlists takes their schedules along
+	if w := do(t, router, http.MethodPut, path, model.ScheduleRequest{Interval: "12h"}); w.Code != http.StatusOK {
+		t.Fatalf("schedule: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(t, router, http.MethodDelete, "/playlist", nil); w.Code != http.StatusOK {
+		t.Fatalf("clear: %d %s", w.Code, w.Body.String())
+	}
+	if schedules := decode[[]model.ScheduleResponse](t, do(t, router, http.MethodGet, "/schedules", nil)); len(schedules) != 0 {
+		t.Errorf("schedules are %+v after clearing the playlists, want none", schedules)
+	}
+}
@@ -3,6 +3,7 @@ package src
 import (
 	"context"
 	"fmt"
+	"log"
 	"os"
 	"sync"
 
@@ -49,11 +50,84 @@ func createDbConn() *dbConn{
 		  }
 	}
 
-	db.AutoMigrate(&model.Playlist{})
+	migrate(db)
 
 	return &dbConn{Ctx: ctx, Db: db}
 }
 
+func migrate(db *gorm.DB) {
+	db.SetupJoinTable(&model.Playlist{}, "Inclusions", &model.PlaylistInclusion{})
+	db.SetupJoinTable(&model.IdItem{}, "Playlists", &model.PlaylistInclusion{})
+	db.AutoMigrate(&model.Playlist{}, &model.SpotifyToken{}, &model.Session{}, &model.CatalogEntry{}, &model.RuleSet{}, &model.ExclusionRule{}, &model.Schedule{})
+	seedRuleSets(db)
+	claimLegacyPlaylists(db)
+}
+
+// claimLegacyPlaylists hands playlists created before playlists had owners
+// to the Spotify user in LEGACY_PLAYLIST_OWNER, the account the app was run
+// with back then. Without it they stay ownerless and out of everyone's reach.
+func claimLegacyPlaylists(db *gorm.DB) {
+	unowned := db.Model(&model.Playlist{}).Where("owner_id = ? OR owner_id IS NULL", "")
+
+	owner := os.Getenv("LEGACY_PLAYLIST_OWNER")
+	if owner == "" {
+		var count int64
+		if unowned.Count(&count); count > 0 {
+			log.Printf("%d playlists have no owner, set LEGACY_PLAYLIST_OWNER to the Spotify user they belong to", count)
+		}
+		return
+	}
+	if err := unowned.Update("owner_id", owner).Error; err != nil {
+		log.Println("Failed to claim playlists:", err)
+	}
+}
+
+// seedRuleSets creates the builtin rule sets that don't exist yet. Playlists
+// that existed before rule sets did get the default one attached, since they
+// were created with its rules always applying.
+func seedRuleSets(db *gorm.DB) {
+	for _, builtin := range model.BuiltinRuleSets() {
+		seedRuleSet(db, builtin)
+	}
+}
+
+func seedRuleSet(db *gorm.DB, builtin model.RuleSet) {
+	var count int64
+	db.Model(&model.RuleSet{}).Where("builtin = ? AND name = ?", true, builtin.Name).Count(&count)
+	if count > 0 {
+		return
+	}
+
+	db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&builtin).Error; err != nil {
+			return err
+		}
+		if builtin.Name != model.DefaultRuleSetName {
+			return nil
+		}
+
+		var playlists []model.Playlist
+		if err := tx.Find(&playlists).Error; err != nil {
+			return err
+		}
+		for _, p := range playlists {
+			if err := tx.Model(&p).Association("RuleSets").Append(&builtin); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UseDb migrates db and makes it the shared connection, e.g. to run against
+// an in-memory sqlite database in tests.
+func UseDb(db *gorm.DB) {
+	lockDbConn.Lock()
+	defer lockDbConn.Unlock()
+	migrate(db)
+	dbConnInstance = &dbConn{Ctx: context.Background(), Db: db}
+}
+
 func GetDbConn() *dbConn {
 	if dbConnInstance == nil {
 		lockDbConn.Lock()
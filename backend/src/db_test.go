@@ -0,0 +1,29 @@
+package src
+
+import (
+	"testing"
+
+	"github.com/aarhunt/spootify/src/model"
+)
+
+func TestLegacyPlaylistsGoToTheConfiguredOwner(t *testing.T) {
+	db := useTestDb(t)
+	db.Create(&model.Playlist{SpotifyID: "legacy", Name: "Legacy"})
+	db.Create(&model.Playlist{SpotifyID: "bobs", Name: "Bob's", OwnerID: "bob"})
+
+	// Without an owner configured they stay ownerless
+	UseDb(db)
+	var legacy model.Playlist
+	db.First(&legacy, "spotify_id = ?", "legacy")
+	if legacy.OwnerID != "" {
+		t.Fatalf("legacy playlist owned by %q without an owner configured", legacy.OwnerID)
+	}
+
+	t.Setenv("LEGACY_PLAYLIST_OWNER", "alice")
+	UseDb(db)
+	var playlists []model.Playlist
+	db.Order("spotify_id").Find(&playlists)
+	if playlists[0].OwnerID != "bob" || playlists[1].OwnerID != "alice" {
+		t.Errorf("owners are %q and %q, want bob to keep his and alice to get the legacy one", playlists[0].OwnerID, playlists[1].OwnerID)
+	}
+}
@@ -0,0 +1,117 @@
+// Package errs holds the errors services return for failures the caller
+// should react to differently, and classifies Spotify errors into them.
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/zmb3/spotify/v2"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrInvalid      = errors.New("invalid request")
+	ErrUnauthorized = errors.New("not authorized with Spotify")
+	ErrRateLimited  = errors.New("rate limited by Spotify")
+	ErrUnavailable  = errors.New("Spotify is unavailable")
+	// ErrConflict is a write against a playlist snapshot that is no longer
+	// current, because the playlist was edited concurrently.
+	ErrConflict = errors.New("conflicting edit")
+	// ErrForbidden is a request the signed in user may not make, whatever
+	// Spotify thinks of it.
+	ErrForbidden = errors.New("not allowed")
+)
+
+// SpotifyError is an error of the Spotify Web API or its OAuth endpoint,
+// tagged with the sentinel error it counts as. Both the sentinel and the
+// original error can be matched with errors.Is and errors.As.
+type SpotifyError struct {
+	Kind error
+	Err  error
+}
+
+func (e *SpotifyError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Kind, e.Err)
+}
+
+func (e *SpotifyError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// NotFound returns an ErrNotFound naming what wasn't found.
+func NotFound(format string, args ...any) error {
+	return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), ErrNotFound)
+}
+
+// Invalid returns an ErrInvalid explaining what is wrong with the request.
+func Invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, args...))
+}
+
+// Conflict returns an ErrConflict explaining what was edited concurrently.
+func Conflict(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrConflict, fmt.Sprintf(format, args...))
+}
+
+// FromSpotify classifies an error returned by the Spotify client. Errors
+// that are already classified, or that don't come from Spotify, are
+// returned unchanged.
+func FromSpotify(err error) error {
+	if err == nil || Kind(err) != nil {
+		return err
+	}
+
+	var kind error
+
+	var spotErr spotify.Error
+	var retrieveErr *oauth2.RetrieveError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &spotErr):
+		kind = statusKind(spotErr.Status)
+	case errors.As(err, &retrieveErr):
+		// The refresh token was revoked or expired
+		kind = ErrUnauthorized
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		kind = ErrUnavailable
+	}
+
+	if kind == nil {
+		return err
+	}
+	return &SpotifyError{Kind: kind, Err: err}
+}
+
+func statusKind(status int) error {
+	switch {
+	case status == http.StatusNotFound:
+		return ErrNotFound
+	case status == http.StatusBadRequest:
+		return ErrInvalid
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ErrUnauthorized
+	case status == http.StatusConflict:
+		return ErrConflict
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status >= 500:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// Kind returns the sentinel error err counts as, or nil if it is none of
+// them.
+func Kind(err error) error {
+	for _, kind := range []error{ErrNotFound, ErrInvalid, ErrUnauthorized, ErrRateLimited, ErrUnavailable, ErrConflict, ErrForbidden} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/zmb3/spotify/v2"
+	"golang.org/x/oauth2"
+)
+
+func TestFromSpotify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"not found", spotify.Error{Status: http.StatusNotFound}, ErrNotFound},
+		{"bad request", spotify.Error{Status: http.StatusBadRequest}, ErrInvalid},
+		{"expired token", spotify.Error{Status: http.StatusUnauthorized}, ErrUnauthorized},
+		{"missing scope", spotify.Error{Status: http.StatusForbidden}, ErrUnauthorized},
+		{"rate limited", spotify.Error{Status: http.StatusTooManyRequests}, ErrRateLimited},
+		{"stale snapshot", spotify.Error{Status: http.StatusConflict}, ErrConflict},
+		{"server error", spotify.Error{Status: http.StatusBadGateway}, ErrUnavailable},
+		{"wrapped", fmt.Errorf("get albums: %w", spotify.Error{Status: http.StatusServiceUnavailable}), ErrUnavailable},
+		{"revoked refresh token", &oauth2.RetrieveError{}, ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := FromSpotify(tt.err)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("FromSpotify(%v) = %v, want %v", tt.err, err, tt.want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("FromSpotify(%v) lost the original error", tt.err)
+			}
+		})
+	}
+}
+
+func TestFromSpotifyKeepsOtherErrors(t *testing.T) {
+	plain := errors.New("boom")
+	if err := FromSpotify(plain); err != plain {
+		t.Errorf("FromSpotify(%v) = %v, want it unchanged", plain, err)
+	}
+
+	missing := NotFound("playlist %s", "abc")
+	if err := FromSpotify(missing); err != missing {
+		t.Errorf("FromSpotify(%v) = %v, want it unchanged", missing, err)
+	}
+	if Kind(missing) != ErrNotFound {
+		t.Errorf("Kind(%v) = %v, want %v", missing, Kind(missing), ErrNotFound)
+	}
+}
@@ -0,0 +1,60 @@
+// Package fanout runs independent Spotify lookups in parallel with a bound
+// on how many run at once.
+package fanout
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultLimit = 4
+
+// Limit is the number of lookups a single fan-out runs at once, set with
+// SPOTIFY_FETCH_PARALLELISM. The transport still caps the requests in
+// flight across all fan-outs.
+func Limit() int {
+	if n, err := strconv.Atoi(os.Getenv("SPOTIFY_FETCH_PARALLELISM")); err == nil && n > 0 {
+		return n
+	}
+	return defaultLimit
+}
+
+// Map calls fn for every item with at most limit calls running at once and
+// returns the results in the order of items. The first error cancels the
+// context of the remaining calls and is returned.
+func Map[T any, R any](ctx context.Context, limit int, items []T, fn func(context.Context, T) (R, error)) ([]R, error) {
+	results := make([]R, len(items))
+
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(max(limit, 1))
+	for i, item := range items {
+		group.Go(func() error {
+			result, err := fn(ctx, item)
+			results[i] = result
+			return err
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// FlatMap is Map for calls that each return a slice, concatenated in the
+// order of items.
+func FlatMap[T any, R any](ctx context.Context, limit int, items []T, fn func(context.Context, T) ([]R, error)) ([]R, error) {
+	nested, err := Map(ctx, limit, items, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []R{}
+	for _, r := range nested {
+		results = append(results, r...)
+	}
+	return results, nil
+}
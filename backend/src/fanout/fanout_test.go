@@ -0,0 +1,67 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMapKeepsOrderAndLimit(t *testing.T) {
+	var inFlight, peak atomic.Int32
+
+	items := []int{5, 4, 3, 2, 1, 0, 6, 7}
+	results, err := Map(context.Background(), 3, items, func(ctx context.Context, n int) (int, error) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if current <= p || peak.CompareAndSwap(p, current) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(n) * time.Millisecond)
+		return n * 10, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int{50, 40, 30, 20, 10, 0, 60, 70}; !slices.Equal(results, want) {
+		t.Errorf("got %v, want %v", results, want)
+	}
+	if peak.Load() > 3 {
+		t.Errorf("%d calls ran at once, want at most 3", peak.Load())
+	}
+}
+
+func TestMapStopsOnFirstError(t *testing.T) {
+	failed := errors.New("failed")
+
+	_, err := Map(context.Background(), 1, []int{1, 2, 3, 4}, func(ctx context.Context, n int) (int, error) {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		if n == 2 {
+			return 0, failed
+		}
+		return n, nil
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("got %v, want %v", err, failed)
+	}
+}
+
+func TestFlatMapConcatenatesInOrder(t *testing.T) {
+	results, err := FlatMap(context.Background(), 2, [][]string{{"a", "b"}, {}, {"c"}}, func(ctx context.Context, chunk []string) ([]string, error) {
+		return chunk, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(results, want) {
+		t.Errorf("got %v, want %v", results, want)
+	}
+}
@@ -0,0 +1,99 @@
+// Package metafilter narrows the resolved tracks of a playlist down by
+// their metadata: release year, duration, explicitness, popularity and
+// album type.
+package metafilter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/zmb3/spotify/v2"
+)
+
+// Validate checks that every filter is in range and every lower bound is
+// below its upper bound. Failures are an errs.ErrInvalid.
+func Validate(f model.MetadataFilters) error {
+	bounds := []struct {
+		name  string
+		value *int
+	}{
+		{"minYear", f.MinYear},
+		{"maxYear", f.MaxYear},
+		{"minDurationMs", f.MinDurationMs},
+		{"maxDurationMs", f.MaxDurationMs},
+	}
+	for _, b := range bounds {
+		if b.value != nil && *b.value < 0 {
+			return errs.Invalid("%s can't be negative", b.name)
+		}
+	}
+	if f.MinPopularity != nil && (*f.MinPopularity < 0 || *f.MinPopularity > 100) {
+		return errs.Invalid("minPopularity must be between 0 and 100")
+	}
+	if f.MinYear != nil && f.MaxYear != nil && *f.MinYear > *f.MaxYear {
+		return errs.Invalid("minYear %d is after maxYear %d", *f.MinYear, *f.MaxYear)
+	}
+	if f.MinDurationMs != nil && f.MaxDurationMs != nil && *f.MinDurationMs > *f.MaxDurationMs {
+		return errs.Invalid("minDurationMs %d is above maxDurationMs %d", *f.MinDurationMs, *f.MaxDurationMs)
+	}
+	for _, albumType := range f.AlbumTypes {
+		if !slices.Contains(model.AlbumTypes, albumType) {
+			return errs.Invalid("unknown album type %q", albumType)
+		}
+	}
+	return nil
+}
+
+// Check tells whether the track passes the filters and, if it doesn't,
+// why not. A track without a known release year fails a year filter.
+func Check(f model.MetadataFilters, t *spotify.FullTrack) (string, bool) {
+	if f.MinYear != nil || f.MaxYear != nil {
+		year, ok := releaseYear(t.Album.ReleaseDate)
+		switch {
+		case !ok:
+			return "release year unknown", false
+		case f.MinYear != nil && year < *f.MinYear:
+			return fmt.Sprintf("released in %d, before %d", year, *f.MinYear), false
+		case f.MaxYear != nil && year > *f.MaxYear:
+			return fmt.Sprintf("released in %d, after %d", year, *f.MaxYear), false
+		}
+	}
+
+	duration := int(t.Duration)
+	if f.MinDurationMs != nil && duration < *f.MinDurationMs {
+		return fmt.Sprintf("%d ms long, shorter than %d ms", duration, *f.MinDurationMs), false
+	}
+	if f.MaxDurationMs != nil && duration > *f.MaxDurationMs {
+		return fmt.Sprintf("%d ms long, longer than %d ms", duration, *f.MaxDurationMs), false
+	}
+
+	if f.Explicit != nil && t.Explicit != *f.Explicit {
+		if t.Explicit {
+			return "explicit", false
+		}
+		return "not explicit", false
+	}
+
+	popularity := int(t.Popularity)
+	if f.MinPopularity != nil && popularity < *f.MinPopularity {
+		return fmt.Sprintf("popularity %d, below %d", popularity, *f.MinPopularity), false
+	}
+
+	if len(f.AlbumTypes) > 0 && !slices.Contains(f.AlbumTypes, t.Album.AlbumType) {
+		return fmt.Sprintf("released on a %s", t.Album.AlbumType), false
+	}
+	return "", true
+}
+
+// releaseYear reads the year of a release date, which Spotify gives as a
+// year, a month or a day.
+func releaseYear(date string) (int, bool) {
+	if len(date) < 4 {
+		return 0, false
+	}
+	year, err := strconv.Atoi(date[:4])
+	return year, err == nil
+}
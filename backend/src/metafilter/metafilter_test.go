@@ -0,0 +1,71 @@
+package metafilter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/zmb3/spotify/v2"
+)
+
+func track(releaseDate string, albumType string, durationMs int, explicit bool, popularity int) *spotify.FullTrack {
+	t := &spotify.FullTrack{}
+	t.Album.ReleaseDate, t.Album.AlbumType = releaseDate, albumType
+	t.Duration, t.Explicit, t.Popularity = spotify.Numeric(durationMs), explicit, spotify.Numeric(popularity)
+	return t
+}
+
+func TestCheck(t *testing.T) {
+	n := func(v int) *int { return &v }
+	clean := false
+
+	tests := []struct {
+		name    string
+		filters model.MetadataFilters
+		track   *spotify.FullTrack
+		reason  string
+	}{
+		{"no filters", model.MetadataFilters{}, track("", "", 0, true, 0), ""},
+		{"year in range", model.MetadataFilters{MinYear: n(2010), MaxYear: n(2019)}, track("2019-03-01", "album", 200000, false, 50), ""},
+		{"year precision", model.MetadataFilters{MinYear: n(2019)}, track("2019", "album", 200000, false, 50), ""},
+		{"before min year", model.MetadataFilters{MinYear: n(2010)}, track("2008-05-01", "album", 200000, false, 50), "released in 2008, before 2010"},
+		{"after max year", model.MetadataFilters{MaxYear: n(2010)}, track("2012", "album", 200000, false, 50), "released in 2012, after 2010"},
+		{"unknown year", model.MetadataFilters{MinYear: n(2010)}, track("", "album", 200000, false, 50), "release year unknown"},
+		{"too short", model.MetadataFilters{MinDurationMs: n(120000)}, track("2019", "album", 90000, false, 50), "90000 ms long, shorter than 120000 ms"},
+		{"too long", model.MetadataFilters{MaxDurationMs: n(300000)}, track("2019", "album", 320000, false, 50), "320000 ms long, longer than 300000 ms"},
+		{"explicit", model.MetadataFilters{Explicit: &clean}, track("2019", "album", 200000, true, 50), "explicit"},
+		{"unpopular", model.MetadataFilters{MinPopularity: n(30)}, track("2019", "album", 200000, false, 20), "popularity 20, below 30"},
+		{"album type", model.MetadataFilters{AlbumTypes: []string{"album", "single"}}, track("2019", "compilation", 200000, false, 50), "released on a compilation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, ok := Check(tt.filters, tt.track)
+			if ok != (tt.reason == "") || reason != tt.reason {
+				t.Errorf("got %q, %v, want %q", reason, ok, tt.reason)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	n := func(v int) *int { return &v }
+
+	valid := model.MetadataFilters{MinYear: n(2010), MaxYear: n(2010), MinPopularity: n(100), AlbumTypes: []string{"single"}}
+	if err := Validate(valid); err != nil {
+		t.Errorf("valid filters: %v", err)
+	}
+
+	for name, f := range map[string]model.MetadataFilters{
+		"years reversed":     {MinYear: n(2020), MaxYear: n(2010)},
+		"durations reversed": {MinDurationMs: n(300000), MaxDurationMs: n(200000)},
+		"negative duration":  {MaxDurationMs: n(-1)},
+		"popularity":         {MinPopularity: n(101)},
+		"album type":         {AlbumTypes: []string{"ep"}},
+	} {
+		if err := Validate(f); !errors.Is(err, errs.ErrInvalid) {
+			t.Errorf("%s: got %v, want an invalid error", name, err)
+		}
+	}
+}
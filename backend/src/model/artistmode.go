@@ -0,0 +1,72 @@
+package model
+
+import (
+	"fmt"
+)
+
+// ArtistMode is which tracks including an artist brings in.
+type ArtistMode string
+
+const (
+	// ArtistAll brings in every album of the artist.
+	ArtistAll ArtistMode = "all"
+	// ArtistTopTracks brings in the artist's Count most popular tracks, at
+	// most 10.
+	ArtistTopTracks ArtistMode = "top_tracks"
+	// ArtistLatest brings in the artist's Count latest albums.
+	ArtistLatest ArtistMode = "latest"
+	// ArtistSince brings in the artist's albums released on or after Since.
+	ArtistSince ArtistMode = "since"
+)
+
+var ArtistModes = []ArtistMode{ArtistAll, ArtistTopTracks, ArtistLatest, ArtistSince}
+
+// ReleaseType is a part of an artist's discography, as Spotify groups it.
+type ReleaseType string
+
+const (
+	ReleaseAlbum ReleaseType = "album"
+	// ReleaseSingle covers singles and EPs
+	ReleaseSingle      ReleaseType = "single"
+	ReleaseCompilation ReleaseType = "compilation"
+	// ReleaseAppearsOn covers other artists' releases the artist features on
+	ReleaseAppearsOn ReleaseType = "appears_on"
+)
+
+var ReleaseTypes = []ReleaseType{ReleaseAlbum, ReleaseSingle, ReleaseCompilation, ReleaseAppearsOn}
+
+// DefaultReleaseTypes are the releases an artist brings in unless the
+// inclusion picks others.
+var DefaultReleaseTypes = []ReleaseType{ReleaseAlbum}
+
+// ArtistInclusion narrows down the tracks an included artist brings in. It
+// is stored on the inclusion row.
+type ArtistInclusion struct {
+	Mode  ArtistMode `gorm:"column:artist_mode;type:varchar(16);not null;default:all" json:"mode" example:"latest"`
+	Count int        `gorm:"column:artist_count;not null;default:0" json:"count,omitempty" example:"3"`
+	// Since is a date, 2006-01-02
+	Since string `gorm:"column:artist_since;type:varchar(10)" json:"since,omitempty" example:"2019-01-01"`
+	// ReleaseTypes are the releases the mode picks from, albums if empty
+	ReleaseTypes []ReleaseType `gorm:"column:artist_release_types;type:text;serializer:json" json:"releaseTypes,omitempty" example:"album,single"`
+}
+
+// Releases returns the release types the inclusion picks from.
+func (a ArtistInclusion) Releases() []ReleaseType {
+	if len(a.ReleaseTypes) == 0 {
+		return DefaultReleaseTypes
+	}
+	return a.ReleaseTypes
+}
+
+// Badge labels the mode for display, empty for ArtistAll.
+func (a ArtistInclusion) Badge() string {
+	switch a.Mode {
+	case ArtistTopTracks:
+		return fmt.Sprintf("Top %d", a.Count)
+	case ArtistLatest:
+		return fmt.Sprintf("Latest %d", a.Count)
+	case ArtistSince:
+		return "Since " + a.Since
+	}
+	return ""
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// CatalogEntry is a Spotify object cached by catalog.Cached, stored as
+// JSON. Kind tells what the payload is, e.g. an artist or the album list
+// of an artist.
+type CatalogEntry struct {
+	Kind      string     `gorm:"primaryKey;type:varchar(64)"`
+	SpotifyID spotify.ID `gorm:"primaryKey;type:varchar(255);index"`
+	Payload   []byte     `gorm:"not null"`
+	FetchedAt time.Time  `gorm:"index"`
+}
@@ -0,0 +1,22 @@
+package model
+
+// ErrorResponse is the body of every failed API request. Code is a stable
+// identifier of the kind of failure, Error a human readable message.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+const (
+	CodeInvalid      = "invalid_request"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotFound     = "not_found"
+	CodeRateLimited  = "rate_limited"
+	CodeUnavailable  = "upstream_unavailable"
+	CodeConflict     = "conflict"
+	CodeInternal     = "internal"
+
+	// CodeAuthFailed means Spotify didn't grant a token for a login
+	CodeAuthFailed = "auth_failed"
+)
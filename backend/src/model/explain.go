@@ -0,0 +1,32 @@
+package model
+
+import (
+	"github.com/zmb3/spotify/v2"
+)
+
+// ExplainResponse tells why a track is in or out of a playlist.
+type ExplainResponse struct {
+	TrackID   spotify.ID `json:"trackId"`
+	TrackName string     `json:"trackName"`
+	Included  bool       `json:"included"`
+	// Winner is the rule that decided, absent if no rule reaches the track.
+	Winner *RuleMatch `json:"winner,omitempty"`
+	// Matches are all rules reaching the track, the most specific first.
+	Matches []RuleMatch `json:"matches"`
+}
+
+// RuleMatch is an inclusion or exclusion reaching a track.
+type RuleMatch struct {
+	ItemID   spotify.ID `json:"itemId"`
+	ItemName string     `json:"itemName"`
+	ItemType ItemType   `json:"type"`
+	Include  bool       `json:"include"`
+	// Playlist defines the rule. Via is the chain of nested playlists the
+	// rule arrived through, from the explained playlist to Playlist.
+	Playlist PlaylistResponse   `json:"playlist"`
+	Via      []PlaylistResponse `json:"via"`
+	Depth    int                `json:"depth"`
+	// Specificity orders the rules: the lowest wins, an exclusion wins a
+	// tie.
+	Specificity int `json:"specificity"`
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"github.com/zmb3/spotify/v2"
+)
+
+// SetOperator combines the tracks of the operands of a set expression.
+type SetOperator string
+
+const (
+	OpUnion        SetOperator = "union"
+	OpIntersection SetOperator = "intersection"
+	// OpDifference takes the tracks of the first operand that are in none
+	// of the others.
+	OpDifference SetOperator = "difference"
+)
+
+var SetOperators = []SetOperator{OpUnion, OpIntersection, OpDifference}
+
+// SetExpression defines a playlist by set operations over the tracks other
+// playlists resolve to. Each node is either a playlist or an operator over
+// two or more operands, e.g. (A ∪ B) ∩ C − D is
+//
+//	{"op": "difference", "operands": [
+//		{"op": "intersection", "operands": [
+//			{"op": "union", "operands": [{"playlist": "A"}, {"playlist": "B"}]},
+//			{"playlist": "C"}]},
+//		{"playlist": "D"}]}
+type SetExpression struct {
+	Playlist spotify.ID      `json:"playlist,omitempty"`
+	Op       SetOperator     `json:"op,omitempty"`
+	Operands []SetExpression `json:"operands,omitempty"`
+}
+
+type PlaylistExpressionRequest struct {
+	// Expression defining the playlist, null to stop defining it by one
+	Expression *SetExpression `json:"expression"`
+}
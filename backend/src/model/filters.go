@@ -0,0 +1,44 @@
+package model
+
+import (
+	"github.com/zmb3/spotify/v2"
+)
+
+// MetadataFilters narrow down the tracks a playlist resolves to by their
+// metadata. Bounds are inclusive and unset filters let every track
+// through.
+type MetadataFilters struct {
+	// MinYear and MaxYear bound the release year of the track's album.
+	MinYear       *int `json:"minYear,omitempty" example:"2010"`
+	MaxYear       *int `json:"maxYear,omitempty" example:"2019"`
+	MinDurationMs *int `json:"minDurationMs,omitempty" example:"120000"`
+	MaxDurationMs *int `json:"maxDurationMs,omitempty" example:"420000"`
+	// Explicit keeps only explicit tracks when true and only clean ones
+	// when false.
+	Explicit *bool `json:"explicit,omitempty"`
+	// MinPopularity is Spotify's popularity of the track, from 0 to 100.
+	MinPopularity *int `json:"minPopularity,omitempty" example:"30"`
+	// AlbumTypes keeps only tracks released on these album types: album,
+	// single or compilation.
+	AlbumTypes []string `json:"albumTypes,omitempty" example:"album,single"`
+}
+
+var AlbumTypes = []string{"album", "single", "compilation"}
+
+// Empty tells whether no filter is set.
+func (f MetadataFilters) Empty() bool {
+	return f.MinYear == nil && f.MaxYear == nil &&
+		f.MinDurationMs == nil && f.MaxDurationMs == nil &&
+		f.Explicit == nil && f.MinPopularity == nil &&
+		len(f.AlbumTypes) == 0
+}
+
+// FilteredTrack is a track a playlist's metadata filters left out.
+type FilteredTrack struct {
+	SpotifyID spotify.ID `json:"spotifyID"`
+	Name      string     `json:"name"`
+	// Reason names the filter the track failed.
+	Reason string `json:"reason" example:"released in 2008, before 2010"`
+	// Source is the rule that would have put the track in the playlist.
+	Source RuleMatch `json:"source"`
+}
@@ -48,6 +48,9 @@ type ItemInclusionRequest struct {
 	ItemType 	ItemType `json:"type" binding:"required"`
 	PlaylistID 	spotify.ID `json:"playlistid" binding:"required"`
 	Include 	*bool `json:"include" binding:"required"`
+	// Artist narrows down the tracks an included artist brings in, all of
+	// them if it is left out
+	Artist 	*ArtistInclusion `json:"artist,omitempty"`
 }
 
 type ItemRequest struct {
@@ -75,15 +78,13 @@ type ItemResponse struct {
 	Included 	InclusionType `json:"included" binding:"required"`
 	InclusionByProxy *bool `json:"inclusionByProxy"`
 	SortData 	int `json:"sortdata" binding:"required"`
+	// Artist and Badge tell which tracks an included artist brings in,
+	// absent if it brings in all of them
+	Artist 	*ArtistInclusion `json:"artist,omitempty"`
+	Badge 	string `json:"badge,omitempty" example:"Latest 3"`
 }
 
 type InclusionResponse struct {
 	SpotifyID spotify.ID `json:"spotifyID"`
 	Included 	InclusionType `json:"included"`
 }
-
-func IsIncluded(iInc int, iExc int) bool {
-	if (iInc == 0) {return false}
-	if (iExc == 0) {return iInc > 0}
-	return (iInc + iExc) < 0
-}
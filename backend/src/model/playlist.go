@@ -1,34 +1,124 @@
 package model
 
 import (
+	"time"
+
 	"github.com/zmb3/spotify/v2"
 )
 
+// TrackOrder is how the tracks of a playlist are ordered when it is
+// published.
+type TrackOrder string
+
+const (
+	// OrderResolved keeps the order tracks are resolved in: the playlist's
+	// own rules before those of nested playlists.
+	OrderResolved    TrackOrder = "resolved"
+	OrderReleaseDate TrackOrder = "release_date"
+	// OrderAlbum groups tracks by album, in disc and track number order.
+	OrderAlbum    TrackOrder = "album"
+	OrderArtist   TrackOrder = "artist"
+	OrderDuration TrackOrder = "duration"
+	// OrderDateAdded orders tracks by when the rule including them was
+	// added.
+	OrderDateAdded TrackOrder = "date_added"
+	// OrderShuffle shuffles the tracks with the playlist's ShuffleSeed, so
+	// the order stays the same across publishes.
+	OrderShuffle TrackOrder = "shuffle"
+)
+
+var TrackOrders = []TrackOrder{OrderResolved, OrderReleaseDate, OrderAlbum, OrderArtist, OrderDuration, OrderDateAdded, OrderShuffle}
+
+// DuplicatePolicy chooses which version of a recording a playlist keeps
+// when it reaches several releases of it, e.g. the album, the single and a
+// compilation.
+type DuplicatePolicy string
+
+const (
+	KeepAllVersions     DuplicatePolicy = "keep_all"
+	KeepEarliestRelease DuplicatePolicy = "earliest_release"
+	KeepAlbumVersion    DuplicatePolicy = "album_version"
+	KeepMostPopular     DuplicatePolicy = "most_popular"
+)
+
+var DuplicatePolicies = []DuplicatePolicy{KeepAllVersions, KeepEarliestRelease, KeepAlbumVersion, KeepMostPopular}
+
 type Playlist struct {
 	SpotifyID   spotify.ID `gorm:"primaryKey;type:varchar(255);not null" json:"id" example:"37i9dQZF1DXcBWIGoYBM3M"`
 	Name              string `json:"name"`
+	OwnerID           string `gorm:"index;type:varchar(255)" json:"ownerId"`
 	Inclusions        []IdItem   `gorm:"many2many:playlist_inclusions;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	IncludedPlaylists []*Playlist `gorm:"many2many:playlist_nested_playlists;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	ExcludedPlaylists []*Playlist `gorm:"many2many:playlist_nested_exclusions;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	Exclusions        []IdItem   `gorm:"many2many:playlist_exclusions;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	RuleSets          []RuleSet  `gorm:"many2many:playlist_rule_sets;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	TrackOrder        TrackOrder `gorm:"type:varchar(32);not null;default:resolved" json:"trackOrder"`
+	ShuffleSeed       int64      `json:"shuffleSeed"`
+	Duplicates        DuplicatePolicy `gorm:"type:varchar(32);not null;default:keep_all" json:"duplicates"`
+	Filters           MetadataFilters `gorm:"type:text;serializer:json" json:"filters"`
+	// Expression defines the playlist by set operations over Operands.
+	Expression        *SetExpression `gorm:"type:text;serializer:json" json:"expression"`
+	Operands          []*Playlist `gorm:"many2many:playlist_expression_operands;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+}
+
+// PlaylistInclusion is the join table of Playlist.Inclusions. It records
+// when an item was included and, for an artist, which of its tracks.
+type PlaylistInclusion struct {
+	PlaylistSpotifyID spotify.ID `gorm:"primaryKey;type:varchar(255)"`
+	IdItemSpotifyID   spotify.ID `gorm:"primaryKey;type:varchar(255)"`
+	CreatedAt         time.Time
+	ArtistInclusion   `gorm:"embedded"`
 }
 
 type PlaylistCreateRequest struct {
 	Name string `json:"name" binding:"required" example:"My Playlist"`
+	// Duplicates is the duplicate policy of a new playlist, keep_all if left
+	// out
+	Duplicates DuplicatePolicy `json:"duplicates,omitempty" example:"earliest_release"`
 }
 
 type PlaylistPublishRequest struct {
 	SpotifyID         spotify.ID `json:"spotifyID"`
+	// DryRun reports what publishing would change without touching Spotify
+	DryRun            bool `json:"dryRun"`
+}
+
+type PublishAllRequest struct {
+	DryRun bool `json:"dryRun"`
+}
+
+type PlaylistOrderRequest struct {
+	Order TrackOrder `json:"order" binding:"required" example:"release_date"`
+	// Seed of OrderShuffle, a random one is picked if it is left out
+	Seed *int64 `json:"seed"`
+}
+
+type PlaylistDuplicatesRequest struct {
+	Policy DuplicatePolicy `json:"policy" binding:"required" example:"album_version"`
 }
 
 type PlaylistResponse struct {
 	Name              string `json:"name"`
 	SpotifyID         spotify.ID `json:"spotifyID"`
+	TrackOrder        TrackOrder `json:"trackOrder,omitempty"`
+	ShuffleSeed       int64 `json:"shuffleSeed,omitempty"`
+	Duplicates        DuplicatePolicy `json:"duplicates,omitempty"`
+	Filters           *MetadataFilters `json:"filters,omitempty"`
+	Expression        *SetExpression `json:"expression,omitempty"`
 }
 
 func (p Playlist) ToResponse() *PlaylistResponse {
-	return &PlaylistResponse{
+	res := &PlaylistResponse{
 		Name:              p.Name,
 		SpotifyID:         p.SpotifyID,
+		TrackOrder:        p.TrackOrder,
+		ShuffleSeed:       p.ShuffleSeed,
+		Duplicates:        p.Duplicates,
+		Expression:        p.Expression,
+	}
+	if !p.Filters.Empty() {
+		res.Filters = &p.Filters
 	}
+	return res
 }
 
@@ -0,0 +1,27 @@
+package model
+
+import (
+	"github.com/zmb3/spotify/v2"
+)
+
+// PreviewResponse is the tracklist a playlist would be published with.
+type PreviewResponse struct {
+	Tracks          []PreviewTrack `json:"tracks"`
+	TrackCount      int            `json:"trackCount"`
+	TotalDurationMs int            `json:"totalDurationMs"`
+	// Filters are the playlist's metadata filters, absent if it has none.
+	// FilteredOut lists the tracks they left out, in resolved order.
+	Filters     *MetadataFilters `json:"filters,omitempty"`
+	FilteredOut []FilteredTrack  `json:"filteredOut"`
+}
+
+type PreviewTrack struct {
+	SpotifyID  spotify.ID `json:"spotifyID"`
+	Name       string     `json:"name"`
+	Artists    []string   `json:"artists"`
+	Album      string     `json:"album"`
+	AlbumID    spotify.ID `json:"albumId"`
+	DurationMs int        `json:"durationMs"`
+	// Source is the rule that put the track in the playlist.
+	Source RuleMatch `json:"source"`
+}
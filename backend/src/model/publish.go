@@ -0,0 +1,31 @@
+package model
+
+import (
+	"github.com/zmb3/spotify/v2"
+)
+
+// PublishReport is what a publish would change on Spotify, by playlist.
+type PublishReport struct {
+	Playlists []PlaylistChanges `json:"playlists"`
+}
+
+// PlaylistChanges are the edits publishing would make to one Spotify
+// playlist.
+type PlaylistChanges struct {
+	SpotifyID spotify.ID    `json:"spotifyID"`
+	Name      string        `json:"name"`
+	Add       []ReportTrack `json:"add"`
+	Remove    []ReportTrack `json:"remove"`
+	// Moved is how many reorders putting the tracks in order takes
+	Moved int `json:"moved"`
+	// TrackCount is how many tracks the playlist ends up with, counting
+	// items that were taken down
+	TrackCount int      `json:"trackCount"`
+	Warnings   []string `json:"warnings"`
+}
+
+type ReportTrack struct {
+	SpotifyID spotify.ID `json:"spotifyID"`
+	// Name is empty for tracks Spotify no longer has
+	Name string `json:"name"`
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"github.com/zmb3/spotify/v2"
+)
+
+// RuleField is what an exclusion rule looks at. Album rules are checked
+// against the albums of an included artist, track rules against the tracks
+// of an included album.
+type RuleField string
+
+const (
+	FieldAlbumName RuleField = "album_name"
+	FieldAlbumType RuleField = "album_type"
+	FieldTrackName RuleField = "track_name"
+)
+
+var RuleFields = []RuleField{FieldAlbumName, FieldAlbumType, FieldTrackName}
+
+// PatternMatch is how an exclusion rule compares its pattern. All matching
+// ignores case.
+type PatternMatch string
+
+const (
+	MatchContains PatternMatch = "contains"
+	MatchEquals   PatternMatch = "equals"
+	MatchRegex    PatternMatch = "regex"
+	// MatchKeyword takes a keyword like "remaster" as the pattern and
+	// matches it as a whole word, in each language of the rule.
+	MatchKeyword PatternMatch = "keyword"
+)
+
+var PatternMatches = []PatternMatch{MatchContains, MatchEquals, MatchRegex, MatchKeyword}
+
+// RuleSet is a named list of exclusion rules. When an artist or album is
+// included in a playlist, everything the rule sets attached to the
+// playlist match is excluded along with it.
+type RuleSet struct {
+	ID      uint   `gorm:"primaryKey" json:"id"`
+	OwnerID string `gorm:"index;type:varchar(255)" json:"-"`
+	Name    string `json:"name"`
+	// Builtin rule sets are shared by all users and can't be changed.
+	Builtin bool            `json:"builtin"`
+	Rules   []ExclusionRule `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"rules"`
+}
+
+type ExclusionRule struct {
+	ID        uint         `gorm:"primaryKey" json:"-"`
+	RuleSetID uint         `gorm:"index" json:"-"`
+	Field     RuleField    `gorm:"type:varchar(32)" json:"field" example:"track_name"`
+	Match     PatternMatch `gorm:"type:varchar(32)" json:"match" example:"contains"`
+	Pattern   string       `json:"pattern" example:"karaoke"`
+	// Languages limits a keyword rule to the words of these languages, all
+	// languages if empty.
+	Languages []string `gorm:"type:text;serializer:json" json:"languages,omitempty" example:"en,es"`
+}
+
+// DefaultRuleSetName names the builtin rule set new playlists start out
+// with attached.
+const DefaultRuleSetName = "Default"
+
+// BuiltinRuleSets returns the rule sets shared by all users: the default
+// one, and ones excluding remasters, demos and karaoke versions in any
+// language, which playlists can be attached to.
+func BuiltinRuleSets() []RuleSet {
+	ruleSets := []RuleSet{DefaultRuleSet()}
+	for _, set := range []struct{ name, keyword string }{{"Remasters", "remaster"}, {"Demos", "demo"}, {"Karaoke", "karaoke"}} {
+		ruleSets = append(ruleSets, RuleSet{Name: set.name, Builtin: true, Rules: []ExclusionRule{
+			{Field: FieldAlbumName, Match: MatchKeyword, Pattern: set.keyword},
+			{Field: FieldTrackName, Match: MatchKeyword, Pattern: set.keyword},
+		}})
+	}
+	return ruleSets
+}
+
+// DefaultRuleSet excludes live, instrumental and acoustic releases and
+// versions. New playlists start out with it attached.
+func DefaultRuleSet() RuleSet {
+	rules := []ExclusionRule{}
+	for _, keyword := range []string{"live", "instrumental", "acoustic"} {
+		rules = append(rules, ExclusionRule{Field: FieldAlbumName, Match: MatchContains, Pattern: keyword})
+	}
+	for _, keyword := range []string{"- live", "- instrumental", "- acoustic", "- orchestral", "- single"} {
+		rules = append(rules, ExclusionRule{Field: FieldTrackName, Match: MatchContains, Pattern: keyword})
+	}
+	return RuleSet{Name: DefaultRuleSetName, Builtin: true, Rules: rules}
+}
+
+type RuleSetRequest struct {
+	Name  string          `json:"name" binding:"required" example:"No karaoke"`
+	Rules []ExclusionRule `json:"rules"`
+}
+
+type RuleSetTestRequest struct {
+	ArtistID spotify.ID      `json:"artistId" binding:"required"`
+	Rules    []ExclusionRule `json:"rules"`
+	// ReleaseTypes of the artist to test against, albums if empty
+	ReleaseTypes []ReleaseType `json:"releaseTypes,omitempty" example:"album,single"`
+}
+
+// RuleSetTestResponse lists what including an artist would exclude.
+type RuleSetTestResponse struct {
+	Albums []ExcludedItem `json:"albums"`
+	Tracks []ExcludedItem `json:"tracks"`
+}
+
+type ExcludedItem struct {
+	SpotifyID spotify.ID `json:"spotifyID"`
+	Name      string     `json:"name"`
+	// Rule is the first rule matching the item.
+	Rule ExclusionRule `json:"rule"`
+}
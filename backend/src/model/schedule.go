@@ -0,0 +1,54 @@
+package model
+
+import (
+	"time"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// ScheduleStatus is how the last run of a schedule went.
+type ScheduleStatus string
+
+const (
+	// SchedulePublished means the resolved tracks changed and were published.
+	SchedulePublished ScheduleStatus = "published"
+	// ScheduleUnchanged means the resolved tracks were the same as last time,
+	// so nothing was published.
+	ScheduleUnchanged ScheduleStatus = "unchanged"
+	ScheduleFailed    ScheduleStatus = "failed"
+)
+
+// Schedule republishes a playlist in the background, so it picks up new
+// releases of the artists it includes. A playlist has at most one.
+type Schedule struct {
+	PlaylistSpotifyID spotify.ID `gorm:"primaryKey;type:varchar(255)"`
+	OwnerID           string     `gorm:"index;type:varchar(255);not null"`
+	// Spec is a cron expression, or "@every" and a duration for an interval
+	Spec   string `gorm:"type:varchar(255);not null"`
+	Paused bool   `gorm:"not null;default:false"`
+
+	LastRunAt  *time.Time
+	LastStatus ScheduleStatus `gorm:"type:varchar(16)"`
+	LastError  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// ScheduleRequest sets when a playlist is republished, either by a cron
+// expression or by an interval.
+type ScheduleRequest struct {
+	Cron string `json:"cron,omitempty" example:"0 6 * * 1"`
+	// Interval is a duration, like 6h or 90m
+	Interval string `json:"interval,omitempty" example:"12h"`
+}
+
+type ScheduleResponse struct {
+	PlaylistSpotifyID spotify.ID     `json:"playlistSpotifyID"`
+	PlaylistName      string         `json:"playlistName"`
+	Spec              string         `json:"spec" example:"@every 12h"`
+	Paused            bool           `json:"paused"`
+	NextRunAt         *time.Time     `json:"nextRunAt,omitempty"`
+	LastRunAt         *time.Time     `json:"lastRunAt,omitempty"`
+	LastStatus        ScheduleStatus `json:"lastStatus,omitempty"`
+	LastError         string         `json:"lastError,omitempty"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import (
+	"time"
+)
+
+// Session maps a browser or API client to a Spotify user. ID is the SHA-256
+// hash of the token handed to the client, never the token itself.
+type Session struct {
+	ID        string `gorm:"primaryKey;type:varchar(64);not null"`
+	UserID    string `gorm:"index;type:varchar(255);not null"`
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+)
+
+// SpotifyToken is the OAuth token of a Spotify user. Token holds the
+// encrypted oauth2.Token; Expiry and Scopes are kept in the clear so they
+// can be reported without decrypting.
+type SpotifyToken struct {
+	UserID    string `gorm:"primaryKey;type:varchar(255);not null"`
+	Token     []byte `gorm:"not null"`
+	Expiry    time.Time
+	Scopes    string
+	UpdatedAt time.Time
+}
+
+type AuthStatusResponse struct {
+	Authenticated bool       `json:"authenticated"`
+	UserID        string     `json:"userId,omitempty"`
+	Expiry        *time.Time `json:"expiry,omitempty"`
+	Scopes        []string   `json:"scopes,omitempty"`
+}
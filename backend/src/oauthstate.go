@@ -0,0 +1,80 @@
+package src
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"sync"
+	"time"
+)
+
+const (
+	loginCookie = "spootify_login"
+	loginTTL    = 10 * time.Minute
+)
+
+// pendingLogin is an authorization request that hasn't come back through the
+// callback yet. It is bound to the browser that started it through a random
+// value kept in the login cookie, so a callback carrying someone else's
+// state is rejected.
+type pendingLogin struct {
+	binding  string
+	verifier string
+	expires  time.Time
+}
+
+var (
+	lockPendingLogins = &sync.Mutex{}
+	pendingLogins     = map[string]pendingLogin{}
+)
+
+// startLogin registers a new authorization request and returns its state,
+// the value for the login cookie and the PKCE code verifier.
+func startLogin() (state string, binding string, verifier string, err error) {
+	if state, err = randomToken(); err != nil {
+		return
+	}
+	if binding, err = randomToken(); err != nil {
+		return
+	}
+	if verifier, err = randomToken(); err != nil {
+		return
+	}
+
+	lockPendingLogins.Lock()
+	defer lockPendingLogins.Unlock()
+
+	now := time.Now()
+	for s, p := range pendingLogins {
+		if now.After(p.expires) {
+			delete(pendingLogins, s)
+		}
+	}
+	pendingLogins[state] = pendingLogin{binding: binding, verifier: verifier, expires: now.Add(loginTTL)}
+	return
+}
+
+// finishLogin consumes the authorization request for state and returns its
+// code verifier if it was started by the same browser and hasn't expired.
+// A state can only be used once.
+func finishLogin(state string, binding string) (string, bool) {
+	lockPendingLogins.Lock()
+	defer lockPendingLogins.Unlock()
+
+	p, ok := pendingLogins[state]
+	if !ok {
+		return "", false
+	}
+	delete(pendingLogins, state)
+
+	if time.Now().After(p.expires) || subtle.ConstantTimeCompare([]byte(p.binding), []byte(binding)) != 1 {
+		return "", false
+	}
+	return p.verifier, true
+}
+
+// codeChallenge derives the S256 PKCE challenge from a code verifier.
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,101 @@
+// Package ordering puts the resolved tracks of a playlist in the order
+// chosen for it. Every strategy is deterministic: the same tracks in the
+// same resolved order always come out the same way, so republishing an
+// unchanged playlist doesn't reorder it.
+package ordering
+
+import (
+	"cmp"
+	"encoding/binary"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/zmb3/spotify/v2"
+)
+
+// Track holds what the strategies order by.
+type Track struct {
+	ID     spotify.ID
+	Artist string
+	// ReleaseDate is the album's, as precise as Spotify knows it: a year,
+	// a month or a day.
+	ReleaseDate string
+	AlbumID     spotify.ID
+	Album       string
+	Disc        int
+	Number      int
+	DurationMs  int
+	// Added is when the rule including the track was added, zero if that
+	// is unknown.
+	Added time.Time
+}
+
+// FromSpotify fills a Track from Spotify's track details.
+func FromSpotify(t *spotify.FullTrack) Track {
+	track := Track{
+		ID:          t.ID,
+		ReleaseDate: t.Album.ReleaseDate,
+		AlbumID:     t.Album.ID,
+		Album:       t.Album.Name,
+		Disc:        int(t.DiscNumber),
+		Number:      int(t.TrackNumber),
+		DurationMs:  int(t.Duration),
+	}
+	if len(t.Artists) > 0 {
+		track.Artist = t.Artists[0].Name
+	}
+	return track
+}
+
+// Sort orders tracks, given in resolved order, by the strategy. Tracks
+// that compare equal keep their resolved order. The seed is only used by
+// model.OrderShuffle.
+func Sort(tracks []Track, order model.TrackOrder, seed int64) {
+	switch order {
+	case model.OrderReleaseDate:
+		slices.SortStableFunc(tracks, func(a, b Track) int {
+			return cmp.Or(cmp.Compare(a.ReleaseDate, b.ReleaseDate), byAlbum(a, b))
+		})
+	case model.OrderAlbum:
+		slices.SortStableFunc(tracks, byAlbum)
+	case model.OrderArtist:
+		slices.SortStableFunc(tracks, func(a, b Track) int {
+			return cmp.Or(
+				cmp.Compare(strings.ToLower(a.Artist), strings.ToLower(b.Artist)),
+				cmp.Compare(a.ReleaseDate, b.ReleaseDate),
+				byAlbum(a, b),
+			)
+		})
+	case model.OrderDuration:
+		slices.SortStableFunc(tracks, func(a, b Track) int { return cmp.Compare(a.DurationMs, b.DurationMs) })
+	case model.OrderDateAdded:
+		slices.SortStableFunc(tracks, func(a, b Track) int { return a.Added.Compare(b.Added) })
+	case model.OrderShuffle:
+		// Each track gets its place on its own, so adding or removing a
+		// track doesn't move the others
+		slices.SortStableFunc(tracks, func(a, b Track) int {
+			return cmp.Compare(shuffleKey(seed, a.ID), shuffleKey(seed, b.ID))
+		})
+	}
+}
+
+// shuffleKey is where id goes in the shuffle of seed.
+func shuffleKey(seed int64, id spotify.ID) uint64 {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, seed)
+	h.Write([]byte(id))
+	return h.Sum64()
+}
+
+// byAlbum groups tracks by album and orders them by disc and track number.
+func byAlbum(a, b Track) int {
+	return cmp.Or(
+		cmp.Compare(strings.ToLower(a.Album), strings.ToLower(b.Album)),
+		cmp.Compare(a.AlbumID, b.AlbumID),
+		cmp.Compare(a.Disc, b.Disc),
+		cmp.Compare(a.Number, b.Number),
+	)
+}
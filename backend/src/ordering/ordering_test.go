@@ -0,0 +1,84 @@
+package ordering
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/zmb3/spotify/v2"
+)
+
+var day = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+// tracks in resolved order: a late single, then a two disc album out of
+// order, then a track of another artist.
+var tracks = []Track{
+	{ID: "single", Artist: "The Testers", ReleaseDate: "2021-06-01", AlbumID: "s", Album: "Single", Disc: 1, Number: 1, DurationMs: 180000, Added: day},
+	{ID: "disc2", Artist: "The Testers", ReleaseDate: "2019-03-01", AlbumID: "lp", Album: "Long Player", Disc: 2, Number: 1, DurationMs: 240000, Added: day.Add(-time.Hour)},
+	{ID: "disc1b", Artist: "The Testers", ReleaseDate: "2019-03-01", AlbumID: "lp", Album: "Long Player", Disc: 1, Number: 2, DurationMs: 200000, Added: day.Add(-time.Hour)},
+	{ID: "disc1a", Artist: "The Testers", ReleaseDate: "2019-03-01", AlbumID: "lp", Album: "Long Player", Disc: 1, Number: 1, DurationMs: 200000, Added: day.Add(-time.Hour)},
+	{ID: "other", Artist: "Another Band", ReleaseDate: "2020", AlbumID: "o", Album: "Another Album", Disc: 1, Number: 1, DurationMs: 150000},
+}
+
+func ids(tracks []Track) []spotify.ID {
+	result := []spotify.ID{}
+	for _, t := range tracks {
+		result = append(result, t.ID)
+	}
+	return result
+}
+
+func TestSort(t *testing.T) {
+	tests := []struct {
+		order model.TrackOrder
+		want  []spotify.ID
+	}{
+		{model.OrderResolved, []spotify.ID{"single", "disc2", "disc1b", "disc1a", "other"}},
+		{model.OrderReleaseDate, []spotify.ID{"disc1a", "disc1b", "disc2", "other", "single"}},
+		{model.OrderAlbum, []spotify.ID{"other", "disc1a", "disc1b", "disc2", "single"}},
+		{model.OrderArtist, []spotify.ID{"other", "disc1a", "disc1b", "disc2", "single"}},
+		// disc1b and disc1a are as long, they keep their resolved order
+		{model.OrderDuration, []spotify.ID{"other", "single", "disc1b", "disc1a", "disc2"}},
+		{model.OrderDateAdded, []spotify.ID{"other", "disc2", "disc1b", "disc1a", "single"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.order), func(t *testing.T) {
+			got := slices.Clone(tracks)
+			Sort(got, tt.order, 0)
+			if !slices.Equal(ids(got), tt.want) {
+				t.Errorf("got %v, want %v", ids(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestShuffleIsSeeded(t *testing.T) {
+	first, second, other := slices.Clone(tracks), slices.Clone(tracks), slices.Clone(tracks)
+	Sort(first, model.OrderShuffle, 42)
+	Sort(second, model.OrderShuffle, 42)
+	Sort(other, model.OrderShuffle, 7)
+
+	if !slices.Equal(ids(first), ids(second)) {
+		t.Errorf("same seed gave %v and %v", ids(first), ids(second))
+	}
+	if slices.Equal(ids(first), ids(other)) {
+		t.Errorf("seeds 42 and 7 both gave %v", ids(first))
+	}
+}
+
+func TestShuffleKeepsOrderOfOtherTracks(t *testing.T) {
+	before := slices.Clone(tracks)
+	Sort(before, model.OrderShuffle, 42)
+
+	// One track more and one less only moves those two
+	after := append(slices.Clone(tracks[1:]), Track{ID: "new"})
+	Sort(after, model.OrderShuffle, 42)
+
+	kept := slices.DeleteFunc(ids(after), func(id spotify.ID) bool { return id == "new" })
+	want := slices.DeleteFunc(ids(before), func(id spotify.ID) bool { return id == tracks[0].ID })
+	if !slices.Equal(kept, want) {
+		t.Errorf("got %v, want the remaining tracks in order %v", kept, want)
+	}
+}
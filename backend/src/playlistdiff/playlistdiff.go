@@ -0,0 +1,135 @@
+// Package playlistdiff computes the edits that turn the contents of a
+// playlist into the wanted contents: removing what is no longer wanted,
+// appending what is missing and moving the rest into place. Items that stay
+// are never removed and added again, so Spotify keeps their date added.
+package playlistdiff
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Plan is applied in order: first Remove, then Add, then Moves.
+type Plan[T comparable] struct {
+	// Remove holds positions in the current contents, ascending.
+	Remove []int
+	// Add is appended to the end once the removals are done.
+	Add []T
+	// Moves put the contents in order once the additions are done.
+	Moves []Move
+}
+
+// Move takes the item at From and inserts it before the item at
+// InsertBefore, both counted before the move, like the range_start and
+// insert_before of the Web API's reorder.
+type Move struct {
+	From         int
+	InsertBefore int
+}
+
+// Empty tells whether the contents already are as wanted.
+func (p Plan[T]) Empty() bool {
+	return len(p.Remove) == 0 && len(p.Add) == 0 && len(p.Moves) == 0
+}
+
+// Compute returns the plan with the fewest removals and additions, and the
+// fewest moves for those. An item occurring more than once is matched by
+// occurrence, so surplus copies are removed and missing ones added.
+func Compute[T comparable](current []T, want []T) Plan[T] {
+	need := map[T]int{}
+	for _, item := range want {
+		need[item]++
+	}
+
+	plan := Plan[T]{Remove: []int{}, Add: []T{}}
+	contents := []T{}
+	for i, item := range current {
+		if need[item] > 0 {
+			need[item]--
+			contents = append(contents, item)
+		} else {
+			plan.Remove = append(plan.Remove, i)
+		}
+	}
+	for _, item := range want {
+		if need[item] > 0 {
+			need[item]--
+			plan.Add = append(plan.Add, item)
+			contents = append(contents, item)
+		}
+	}
+
+	plan.Moves = moves(contents, want)
+	return plan
+}
+
+// moves orders contents like want, which holds the same items. The items
+// forming the longest run already in order stay, every other item is moved
+// right behind the one it follows in want, in the order of want.
+func moves[T comparable](contents []T, want []T) []Move {
+	positions := map[T][]int{}
+	for i, item := range want {
+		positions[item] = append(positions[item], i)
+	}
+	// order holds the position in want of every item of contents
+	order := make([]int, len(contents))
+	for i, item := range contents {
+		order[i] = positions[item][0]
+		positions[item] = positions[item][1:]
+	}
+
+	stay := longestIncreasing(order)
+	result := []Move{}
+	for target := range order {
+		if stay[target] {
+			continue
+		}
+
+		from := slices.Index(order, target)
+		before := 0
+		if target > 0 {
+			before = slices.Index(order, target-1) + 1
+		}
+		if from == before {
+			continue
+		}
+
+		result = append(result, Move{From: from, InsertBefore: before})
+		order = slices.Delete(order, from, from+1)
+		if from < before {
+			before--
+		}
+		order = slices.Insert(order, before, target)
+	}
+	return result
+}
+
+// longestIncreasing returns which values of seq, a permutation of 0 to
+// len(seq)-1, form its longest increasing subsequence.
+func longestIncreasing(seq []int) []bool {
+	// tails[k] is the index of the smallest value ending an increasing
+	// subsequence of length k+1
+	tails := []int{}
+	prev := make([]int, len(seq))
+	for i, v := range seq {
+		k, _ := slices.BinarySearchFunc(tails, v, func(j int, v int) int { return cmp.Compare(seq[j], v) })
+		prev[i] = -1
+		if k > 0 {
+			prev[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+
+	in := make([]bool, len(seq))
+	if len(tails) == 0 {
+		return in
+	}
+	for i := tails[len(tails)-1]; i >= 0; i = prev[i] {
+		in[seq[i]] = true
+	}
+	return in
+}
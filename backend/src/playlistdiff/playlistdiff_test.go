@@ -0,0 +1,66 @@
+package playlistdiff
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// apply edits contents the way Spotify would.
+func apply(contents []string, plan Plan[string]) []string {
+	contents = slices.Clone(contents)
+	for i, pos := range plan.Remove {
+		contents = slices.Delete(contents, pos-i, pos-i+1)
+	}
+	contents = append(contents, plan.Add...)
+	for _, m := range plan.Moves {
+		item := contents[m.From]
+		contents = slices.Delete(contents, m.From, m.From+1)
+		before := m.InsertBefore
+		if m.From < before {
+			before--
+		}
+		contents = slices.Insert(contents, before, item)
+	}
+	return contents
+}
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name                 string
+		current, want        string
+		removes, adds, moves int
+	}{
+		{"unchanged", "abcd", "abcd", 0, 0, 0},
+		{"empty playlist", "", "abc", 0, 3, 0},
+		{"emptied", "abc", "", 3, 0, 0},
+		{"appended", "abc", "abcde", 0, 2, 0},
+		{"inserted in the middle", "abd", "abcd", 0, 1, 1},
+		{"removed from the middle", "abcd", "abd", 1, 0, 0},
+		{"first moved to the end", "dabc", "abcd", 0, 0, 1},
+		{"last moved to the front", "bcda", "abcd", 0, 0, 1},
+		{"reversed", "abcde", "edcba", 0, 0, 4},
+		{"swapped pairs", "badc", "abcd", 0, 0, 2},
+		{"surplus copy", "abab", "ab", 2, 0, 0},
+		{"missing copy", "ab", "abab", 0, 2, 0},
+		{"everything at once", "xabcdy", "dacbe", 2, 1, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, want := strings.Split(tt.current, ""), strings.Split(tt.want, "")
+			plan := Compute(current, want)
+
+			if got := apply(current, plan); !slices.Equal(got, want) {
+				t.Fatalf("applying %+v gives %v, want %v", plan, got, want)
+			}
+			if len(plan.Remove) != tt.removes || len(plan.Add) != tt.adds || len(plan.Moves) != tt.moves {
+				t.Errorf("got %d removals, %d additions and %d moves, want %d, %d and %d",
+					len(plan.Remove), len(plan.Add), len(plan.Moves), tt.removes, tt.adds, tt.moves)
+			}
+			if plan.Empty() != (tt.current == tt.want) {
+				t.Errorf("Empty() = %v", plan.Empty())
+			}
+		})
+	}
+}
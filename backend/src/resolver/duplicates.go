@@ -0,0 +1,155 @@
+package resolver
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// Version describes a track for finding other releases of the same
+// recording.
+type Version struct {
+	ISRC        string
+	Name        string
+	DurationMs  int
+	ReleaseDate string
+	// AlbumType is the type of the release: album, single or compilation.
+	AlbumType  string
+	Popularity int
+}
+
+// Keep chooses which version of a recording released more than once stays.
+type Keep int
+
+const (
+	KeepEarliest Keep = iota + 1
+	KeepAlbum
+	KeepPopular
+)
+
+// durationTolerance is how far apart the durations of two tracks matched by
+// name may be.
+const durationTolerance = 2000
+
+// Dedupe drops all but one version of every recording among decisions.
+// Tracks with the same ISRC are the same recording. A track without an ISRC
+// also matches tracks with the same name and about the same duration.
+// Tracks without a version never match. What stays keeps its position.
+func Dedupe(decisions []Decision, versions map[spotify.ID]Version, keep Keep) []Decision {
+	groups := newUnion(len(decisions))
+
+	byISRC := map[string]int{}
+	byName := map[string][]int{}
+	for i, d := range decisions {
+		v, ok := versions[d.Track]
+		if !ok {
+			continue
+		}
+		if v.ISRC != "" {
+			if first, seen := byISRC[v.ISRC]; seen {
+				groups.join(first, i)
+			} else {
+				byISRC[v.ISRC] = i
+			}
+		}
+		name := strings.ToLower(strings.TrimSpace(v.Name))
+		byName[name] = append(byName[name], i)
+	}
+
+	for _, same := range byName {
+		for x, i := range same {
+			for _, j := range same[x+1:] {
+				a, b := versions[decisions[i].Track], versions[decisions[j].Track]
+				if (a.ISRC == "" || b.ISRC == "") && abs(a.DurationMs-b.DurationMs) <= durationTolerance {
+					groups.join(i, j)
+				}
+			}
+		}
+	}
+
+	best := map[int]int{}
+	for i, d := range decisions {
+		root := groups.find(i)
+		current, ok := best[root]
+		if !ok || better(versions[d.Track], versions[decisions[current].Track], keep) {
+			best[root] = i
+		}
+	}
+
+	kept := []Decision{}
+	for i, d := range decisions {
+		if best[groups.find(i)] == i {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// better tells whether a is a better version to keep than b. Ties go to
+// the track reached first.
+func better(a, b Version, keep Keep) bool {
+	switch keep {
+	case KeepAlbum:
+		if c := cmp.Compare(albumRank(a), albumRank(b)); c != 0 {
+			return c < 0
+		}
+	case KeepPopular:
+		if a.Popularity != b.Popularity {
+			return a.Popularity > b.Popularity
+		}
+	}
+	return earlier(a.ReleaseDate, b.ReleaseDate)
+}
+
+// earlier compares release dates, which are as precise as Spotify knows
+// them. Unknown dates come last.
+func earlier(a, b string) bool {
+	switch {
+	case a == "":
+		return false
+	case b == "":
+		return true
+	}
+	return a < b
+}
+
+var albumRanks = []string{"album", "single", "compilation"}
+
+func albumRank(v Version) int {
+	if i := slices.Index(albumRanks, v.AlbumType); i >= 0 {
+		return i
+	}
+	return len(albumRanks)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// union is a disjoint set of indices.
+type union []int
+
+func newUnion(n int) union {
+	u := make(union, n)
+	for i := range u {
+		u[i] = i
+	}
+	return u
+}
+
+func (u union) find(i int) int {
+	for u[i] != i {
+		u[i] = u[u[i]]
+		i = u[i]
+	}
+	return i
+}
+
+func (u union) join(i, j int) {
+	u[u.find(j)] = u.find(i)
+}
@@ -0,0 +1,50 @@
+package resolver
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// versions holds one recording released on an album, a single, a deluxe
+// edition and a compilation, plus an unrelated track.
+var versions = map[spotify.ID]Version{
+	"album":       {ISRC: "ISRC1", Name: "Song", DurationMs: 200000, ReleaseDate: "2019-03-01", AlbumType: "album", Popularity: 40},
+	"single":      {ISRC: "ISRC1", Name: "Song", DurationMs: 200000, ReleaseDate: "2018-11-20", AlbumType: "single", Popularity: 30},
+	"compilation": {ISRC: "ISRC1", Name: "Song", DurationMs: 200000, ReleaseDate: "2022", AlbumType: "compilation", Popularity: 60},
+	// Without an ISRC, matched by name and about the same duration
+	"deluxe": {Name: "song ", DurationMs: 201500, ReleaseDate: "2020-01-01", AlbumType: "album"},
+	// Same name but a different recording
+	"remix": {ISRC: "ISRC2", Name: "Song", DurationMs: 320000, ReleaseDate: "2021", AlbumType: "single"},
+	"other": {ISRC: "ISRC3", Name: "Other", DurationMs: 180000, ReleaseDate: "2019-03-01", AlbumType: "album"},
+}
+
+func TestDedupe(t *testing.T) {
+	decisions := []Decision{}
+	for _, id := range []spotify.ID{"compilation", "other", "album", "single", "deluxe", "remix", "unknown"} {
+		decisions = append(decisions, Decision{Track: id, Included: true})
+	}
+
+	tests := []struct {
+		name string
+		keep Keep
+		want []spotify.ID
+	}{
+		{"earliest release", KeepEarliest, []spotify.ID{"other", "single", "remix", "unknown"}},
+		{"album version", KeepAlbum, []spotify.ID{"other", "album", "remix", "unknown"}},
+		{"most popular", KeepPopular, []spotify.ID{"compilation", "other", "remix", "unknown"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []spotify.ID{}
+			for _, d := range Dedupe(decisions, versions, tt.keep) {
+				got = append(got, d.Track)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
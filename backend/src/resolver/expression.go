@@ -0,0 +1,109 @@
+package resolver
+
+import (
+	"slices"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// Op is a set operation.
+type Op int
+
+const (
+	// Leaf is no operation: the tracks of Expr.Playlist.
+	Leaf Op = iota
+	Union
+	Intersection
+	// Difference takes the tracks of the first operand that are in none
+	// of the others.
+	Difference
+)
+
+// Expr is a set expression over the tracks playlists resolve to.
+type Expr struct {
+	Op       Op
+	Playlist spotify.ID
+	Operands []Expr
+}
+
+// Playlists returns the playlists the expression names, in order and
+// without repeats.
+func (e Expr) Playlists() []spotify.ID {
+	if e.Op == Leaf {
+		return []spotify.ID{e.Playlist}
+	}
+	ids := []spotify.ID{}
+	for _, operand := range e.Operands {
+		for _, id := range operand.Playlists() {
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// evaluate returns the tracks of the expression in the order of its first
+// operand, then the order of the following ones. A playlist that is
+// already being resolved contributes no tracks.
+func evaluate(g Graph, e Expr, exp Expansion, resolving map[spotify.ID]bool) []spotify.ID {
+	if e.Op == Leaf {
+		if resolving[e.Playlist] {
+			return []spotify.ID{}
+		}
+		return resolveNested(g, e.Playlist, exp, resolving)
+	}
+
+	operands := make([][]spotify.ID, len(e.Operands))
+	for i, operand := range e.Operands {
+		operands[i] = evaluate(g, operand, exp, resolving)
+	}
+	if len(operands) == 0 {
+		return []spotify.ID{}
+	}
+
+	tracks := []spotify.ID{}
+	switch e.Op {
+	case Union:
+		seen := map[spotify.ID]bool{}
+		for _, operand := range operands {
+			for _, track := range operand {
+				if !seen[track] {
+					seen[track] = true
+					tracks = append(tracks, track)
+				}
+			}
+		}
+	case Intersection:
+		for _, track := range operands[0] {
+			if !slices.Contains(tracks, track) && inAll(track, operands[1:]) {
+				tracks = append(tracks, track)
+			}
+		}
+	case Difference:
+		for _, track := range operands[0] {
+			if !slices.Contains(tracks, track) && !inAny(track, operands[1:]) {
+				tracks = append(tracks, track)
+			}
+		}
+	}
+	return tracks
+}
+
+func inAll(track spotify.ID, sets [][]spotify.ID) bool {
+	for _, set := range sets {
+		if !slices.Contains(set, track) {
+			return false
+		}
+	}
+	return true
+}
+
+func inAny(track spotify.ID, sets [][]spotify.ID) bool {
+	for _, set := range sets {
+		if slices.Contains(set, track) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package resolver
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+func leaf(id spotify.ID) Expr        { return Expr{Playlist: id} }
+func op(o Op, operands ...Expr) Expr { return Expr{Op: o, Operands: operands} }
+
+func TestEvaluateExpression(t *testing.T) {
+	playlists := Graph{
+		"A": {Rules: []Rule{include("a1", Album)}},
+		"B": {Rules: []Rule{include("a2", Album)}},
+		"C": {Rules: []Rule{include("t4", Track), include("t2", Track)}},
+		"D": {Rules: []Rule{include("t4", Track)}},
+	}
+
+	tests := []struct {
+		name string
+		root Node
+		want []spotify.ID
+	}{
+		{
+			name: "union",
+			root: Node{Expression: &Expr{Op: Union, Operands: []Expr{leaf("B"), leaf("A")}}},
+			want: []spotify.ID{"t4", "t1", "t2", "t3"},
+		},
+		{
+			name: "intersection keeps the order of the first operand",
+			root: Node{Expression: &Expr{Op: Intersection, Operands: []Expr{leaf("A"), leaf("C")}}},
+			want: []spotify.ID{"t2"},
+		},
+		{
+			name: "(A ∪ B) ∩ C − D",
+			root: Node{Expression: &Expr{Op: Difference, Operands: []Expr{
+				op(Intersection, op(Union, leaf("A"), leaf("B")), leaf("C")),
+				leaf("D"),
+			}}},
+			want: []spotify.ID{"t2"},
+		},
+		{
+			name: "own rules still apply",
+			root: Node{
+				Rules:      []Rule{include("t3", Track), exclude("t1", Track)},
+				Expression: &Expr{Op: Union, Operands: []Expr{leaf("A"), leaf("B")}},
+			},
+			want: []spotify.ID{"t3", "t2", "t4"},
+		},
+		{
+			name: "own artist exclusion wins a tie",
+			root: Node{
+				Rules:      []Rule{exclude("artist", Artist)},
+				Expression: &Expr{Op: Union, Operands: []Expr{leaf("A"), leaf("B")}},
+			},
+			want: []spotify.ID{},
+		},
+		{
+			name: "a cycle contributes nothing",
+			root: Node{Expression: &Expr{Op: Union, Operands: []Expr{leaf("root"), leaf("D")}}},
+			want: []spotify.ID{"t4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := Graph{"root": tt.root}
+			for id, node := range playlists {
+				g[id] = node
+			}
+			got := Resolve(g, "root", exp)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpressionPlaylists(t *testing.T) {
+	e := op(Difference, op(Union, leaf("A"), leaf("B")), op(Intersection, leaf("B"), leaf("C")))
+	if got, want := e.Playlists(), []spotify.ID{"A", "B", "C"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
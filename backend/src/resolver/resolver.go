@@ -0,0 +1,306 @@
+// Package resolver decides which tracks end up in a playlist. It works on a
+// playlist graph and a catalog expansion loaded up front, so it needs
+// neither the database nor Spotify.
+//
+// Every inclusion or exclusion rule that reaches a track has a specificity:
+// the kind of item it names (track 1, album 2, artist 3) plus 3 for every
+// level of playlist nesting it arrives through. A lower specificity is more
+// specific. A track is in the playlist if it is reached by an inclusion
+// that is strictly more specific than every exclusion reaching it, so an
+// exclusion wins a tie.
+//
+// A playlist can also exclude a nested playlist, subtracting every track
+// that playlist resolves to. Such an exclusion has the specificity of a
+// rule one level down naming a playlist (0), so it beats every rule of the
+// playlists nested at that level but not the track and album rules of the
+// playlist declaring it.
+//
+// A playlist defined by a set expression over other playlists gets the
+// tracks the expression evaluates to as inclusions of that same
+// specificity, so its own rules still add and remove tracks.
+//
+// A nested playlist can be narrowed to the tracks left after its own
+// metadata filters and duplicate policy. Inclusions reaching a parent
+// through it then only count for those tracks, and excluding it or naming
+// it in an expression stands for exactly those tracks.
+package resolver
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+type Kind int
+
+const (
+	// Playlist rules only come from nested exclusions.
+	Playlist Kind = 0
+	Track    Kind = 1
+	Album    Kind = 2
+	Artist   Kind = 3
+)
+
+// depthWeight is added to the specificity per level of nesting, so a rule
+// of a nested playlist is less specific than any rule of its parent.
+const depthWeight = 3
+
+// Rule includes or excludes an artist, album or track.
+type Rule struct {
+	ItemID  spotify.ID
+	Kind    Kind
+	Exclude bool
+	// Variant names the part of an artist's tracks the rule brings in,
+	// e.g. its top tracks, empty for all of them.
+	Variant string
+}
+
+// Key is the entry of the rule's item in an Expansion.
+func (r Rule) Key() spotify.ID {
+	if r.Variant == "" {
+		return r.ItemID
+	}
+	return r.ItemID + "#" + spotify.ID(r.Variant)
+}
+
+// Node is a playlist: its own rules, the playlists nested in it, the
+// playlists whose tracks it subtracts and the set expression over other
+// playlists it is defined by, if any.
+type Node struct {
+	Rules      []Rule
+	Children   []spotify.ID
+	Excluded   []spotify.ID
+	Expression *Expr
+	// Narrowed holds the tracks the playlist keeps when resolved on its
+	// own, nil if it keeps every track its rules include. It only applies
+	// where the playlist is nested.
+	Narrowed []spotify.ID
+}
+
+// Graph holds the nodes of a playlist and of everything nested in it.
+type Graph map[spotify.ID]Node
+
+// Expansion holds the tracks of the artists and albums named by rules, by
+// Rule.Key. Track rules need no entry.
+type Expansion map[spotify.ID][]spotify.ID
+
+// Match is a rule reaching a track.
+type Match struct {
+	Rule Rule
+	// Playlist defines the rule, Path leads to it from the resolved
+	// playlist, starting with the resolved playlist itself.
+	Playlist    spotify.ID
+	Path        []spotify.ID
+	Depth       int
+	Specificity int
+}
+
+// Decision is the outcome for a single track.
+type Decision struct {
+	Track    spotify.ID
+	Included bool
+	// Winner is the match that decided, nil if no rule reaches the track.
+	Winner *Match
+	// Matches are all rules reaching the track, most specific first.
+	Matches []Match
+}
+
+// Resolve returns the tracks of the playlist root, in the order they are
+// first reached: root's rules before those of nested playlists, rules in
+// order, and tracks of an artist or album in catalog order.
+func Resolve(g Graph, root spotify.ID, exp Expansion) []spotify.ID {
+	tracks := []spotify.ID{}
+	for _, d := range Decide(g, root, exp) {
+		if d.Included {
+			tracks = append(tracks, d.Track)
+		}
+	}
+	return tracks
+}
+
+// Decide returns the decisions for every track reached by a rule of the
+// playlist root, in the order of Resolve.
+func Decide(g Graph, root spotify.ID, exp Expansion) []Decision {
+	order, matches := collect(g, root, exp)
+
+	decisions := make([]Decision, len(order))
+	for i, id := range order {
+		decisions[i] = decide(id, matches[id])
+	}
+	return decisions
+}
+
+// Explain returns the decision for a single track of the playlist root.
+func Explain(g Graph, root spotify.ID, exp Expansion, track spotify.ID) Decision {
+	_, matches := collect(g, root, exp)
+	return decide(track, matches[track])
+}
+
+// Specificity of a rule of the given kind at the given nesting depth.
+func Specificity(kind Kind, depth int) int {
+	return depth*depthWeight + int(kind)
+}
+
+func decide(track spotify.ID, matches []Match) Decision {
+	matches = slices.Clone(matches)
+	slices.SortStableFunc(matches, func(a, b Match) int {
+		if c := cmp.Compare(a.Specificity, b.Specificity); c != 0 {
+			return c
+		}
+		// Exclusions first, they win ties
+		switch {
+		case a.Rule.Exclude && !b.Rule.Exclude:
+			return -1
+		case !a.Rule.Exclude && b.Rule.Exclude:
+			return 1
+		}
+		return 0
+	})
+
+	decision := Decision{Track: track, Matches: matches}
+	if len(matches) > 0 {
+		decision.Winner = &matches[0]
+		decision.Included = !matches[0].Rule.Exclude
+	}
+	return decision
+}
+
+// collect walks the graph breadth first, so every playlist is visited once
+// at its shallowest depth, and gathers the matches of every track reached.
+func collect(g Graph, root spotify.ID, exp Expansion) ([]spotify.ID, map[spotify.ID][]Match) {
+	return collectFrom(g, root, exp, map[spotify.ID]bool{root: true})
+}
+
+// collectFrom is collect while resolving the playlists in resolving, which
+// excluded playlists can't subtract again: a playlist excluding one of
+// those, through any nesting, would depend on its own result.
+func collectFrom(g Graph, root spotify.ID, exp Expansion, resolving map[spotify.ID]bool) ([]spotify.ID, map[spotify.ID][]Match) {
+	order := []spotify.ID{}
+	matches := map[spotify.ID][]Match{}
+	narrowed := narrowedSets(g)
+	add := func(track spotify.ID, match Match) {
+		if !match.Rule.Exclude && !kept(narrowed, match.Path[1:], track) {
+			return
+		}
+		if _, seen := matches[track]; !seen {
+			order = append(order, track)
+		}
+		matches[track] = append(matches[track], match)
+	}
+
+	paths := map[spotify.ID][]spotify.ID{root: {root}}
+	queue := []spotify.ID{root}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		path := paths[id]
+		node := g[id]
+
+		for _, rule := range node.Rules {
+			match := Match{
+				Rule:        rule,
+				Playlist:    id,
+				Path:        path,
+				Depth:       len(path) - 1,
+				Specificity: Specificity(rule.Kind, len(path)-1),
+			}
+
+			tracks := exp[rule.Key()]
+			if rule.Kind == Track {
+				tracks = []spotify.ID{rule.ItemID}
+			}
+			for _, track := range tracks {
+				add(track, match)
+			}
+		}
+
+		if node.Expression != nil {
+			match := Match{
+				Rule:        Rule{ItemID: id, Kind: Playlist},
+				Playlist:    id,
+				Path:        path,
+				Depth:       len(path) - 1,
+				Specificity: Specificity(Playlist, len(path)),
+			}
+
+			for _, track := range evaluate(g, *node.Expression, exp, resolving) {
+				add(track, match)
+			}
+		}
+
+		for _, excluded := range node.Excluded {
+			if resolving[excluded] {
+				continue
+			}
+			match := Match{
+				Rule:        Rule{ItemID: excluded, Kind: Playlist, Exclude: true},
+				Playlist:    id,
+				Path:        path,
+				Depth:       len(path) - 1,
+				Specificity: Specificity(Playlist, len(path)),
+			}
+
+			for _, track := range resolveNested(g, excluded, exp, resolving) {
+				add(track, match)
+			}
+		}
+
+		for _, child := range node.Children {
+			if _, seen := paths[child]; seen {
+				continue
+			}
+			paths[child] = append(slices.Clone(path), child)
+			queue = append(queue, child)
+		}
+	}
+
+	return order, matches
+}
+
+// narrowedSets holds the tracks of every narrowed playlist of g.
+func narrowedSets(g Graph) map[spotify.ID]map[spotify.ID]bool {
+	sets := map[spotify.ID]map[spotify.ID]bool{}
+	for id, node := range g {
+		if node.Narrowed == nil {
+			continue
+		}
+		sets[id] = map[spotify.ID]bool{}
+		for _, track := range node.Narrowed {
+			sets[id][track] = true
+		}
+	}
+	return sets
+}
+
+// kept reports whether every playlist of path, which leads to a rule from
+// below the resolved playlist, kept track when narrowed.
+func kept(narrowed map[spotify.ID]map[spotify.ID]bool, path []spotify.ID, track spotify.ID) bool {
+	for _, id := range path {
+		if set, ok := narrowed[id]; ok && !set[track] {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveNested resolves a playlist excluded by, or in the expression of, a
+// playlist being resolved.
+func resolveNested(g Graph, id spotify.ID, exp Expansion, resolving map[spotify.ID]bool) []spotify.ID {
+	if narrowed := g[id].Narrowed; narrowed != nil {
+		return slices.Clone(narrowed)
+	}
+
+	resolving = maps.Clone(resolving)
+	resolving[id] = true
+
+	order, matches := collectFrom(g, id, exp, resolving)
+	tracks := []spotify.ID{}
+	for _, track := range order {
+		if decide(track, matches[track]).Included {
+			tracks = append(tracks, track)
+		}
+	}
+	return tracks
+}
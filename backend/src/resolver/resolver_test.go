@@ -0,0 +1,194 @@
+package resolver
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/zmb3/spotify/v2"
+)
+
+// exp is a small discography: artist → albums a1 (t1, t2, t3) and a2 (t4),
+// the latest.
+var exp = Expansion{
+	"artist":          {"t1", "t2", "t3", "t4"},
+	"artist#latest:1": {"t4"},
+	"a1":              {"t1", "t2", "t3"},
+	"a2":              {"t4"},
+}
+
+func include(id spotify.ID, kind Kind) Rule { return Rule{ItemID: id, Kind: kind} }
+func exclude(id spotify.ID, kind Kind) Rule { return Rule{ItemID: id, Kind: kind, Exclude: true} }
+
+func TestResolvePrecedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		graph Graph
+		want  []spotify.ID
+	}{
+		{
+			name:  "artist",
+			graph: Graph{"root": {Rules: []Rule{include("artist", Artist)}}},
+			want:  []spotify.ID{"t1", "t2", "t3", "t4"},
+		},
+		{
+			name:  "excluded album beats included artist",
+			graph: Graph{"root": {Rules: []Rule{include("artist", Artist), exclude("a1", Album)}}},
+			want:  []spotify.ID{"t4"},
+		},
+		{
+			name:  "included track beats excluded album",
+			graph: Graph{"root": {Rules: []Rule{include("artist", Artist), exclude("a1", Album), include("t2", Track)}}},
+			want:  []spotify.ID{"t2", "t4"},
+		},
+		{
+			name:  "exclusion wins a tie",
+			graph: Graph{"root": {Rules: []Rule{include("a1", Album), exclude("a1", Album)}}},
+			want:  []spotify.ID{},
+		},
+		{
+			name:  "exclusions alone include nothing",
+			graph: Graph{"root": {Rules: []Rule{exclude("t1", Track)}}},
+			want:  []spotify.ID{},
+		},
+		{
+			name: "own exclusion beats nested inclusion",
+			graph: Graph{
+				"root":  {Rules: []Rule{exclude("artist", Artist)}, Children: []spotify.ID{"child"}},
+				"child": {Rules: []Rule{include("t1", Track)}},
+			},
+			// Track in child: 3+1 = 4, artist in root: 3
+			want: []spotify.ID{},
+		},
+		{
+			name: "nested exclusion keeps applying",
+			graph: Graph{
+				"root":  {Children: []spotify.ID{"child"}},
+				"child": {Rules: []Rule{include("artist", Artist), exclude("a2", Album)}},
+			},
+			want: []spotify.ID{"t1", "t2", "t3"},
+		},
+		{
+			name: "own inclusion beats nested exclusion",
+			graph: Graph{
+				"root":  {Rules: []Rule{include("a2", Album)}, Children: []spotify.ID{"child"}},
+				"child": {Rules: []Rule{exclude("t4", Track)}},
+			},
+			want: []spotify.ID{"t4"},
+		},
+		{
+			name: "cycles and diamonds are walked once at the shallowest depth",
+			graph: Graph{
+				"root": {Children: []spotify.ID{"a", "b"}},
+				"a":    {Children: []spotify.ID{"b", "root"}, Rules: []Rule{include("a2", Album)}},
+				"b":    {Rules: []Rule{exclude("t4", Track)}},
+			},
+			// a2 through a: 3+2 = 5, t4 through b: 3+1 = 4
+			want: []spotify.ID{},
+		},
+		{
+			name: "variants of an artist expand on their own",
+			graph: Graph{
+				"root":  {Rules: []Rule{{ItemID: "artist", Kind: Artist, Variant: "latest:1"}}, Children: []spotify.ID{"child"}},
+				"child": {Rules: []Rule{include("artist", Artist)}},
+			},
+			want: []spotify.ID{"t4", "t1", "t2", "t3"},
+		},
+		{
+			name: "excluded playlist subtracts what it resolves to",
+			graph: Graph{
+				"root":       {Children: []spotify.ID{"workout"}, Excluded: []spotify.ID{"overplayed"}},
+				"workout":    {Rules: []Rule{include("artist", Artist)}},
+				"overplayed": {Rules: []Rule{include("a1", Album), exclude("t2", Track)}},
+			},
+			want: []spotify.ID{"t2", "t4"},
+		},
+		{
+			name: "own album inclusion beats excluded playlist",
+			graph: Graph{
+				"root":       {Rules: []Rule{include("a1", Album)}, Excluded: []spotify.ID{"overplayed"}},
+				"overplayed": {Rules: []Rule{include("t1", Track)}},
+			},
+			// a1 in root: 2, overplayed: 3+0 = 3
+			want: []spotify.ID{"t1", "t2", "t3"},
+		},
+		{
+			name: "playlists excluding each other",
+			graph: Graph{
+				"root":  {Children: []spotify.ID{"child"}, Excluded: []spotify.ID{"other"}},
+				"child": {Rules: []Rule{include("a2", Album)}},
+				"other": {Rules: []Rule{include("t4", Track)}, Excluded: []spotify.ID{"root"}},
+			},
+			want: []spotify.ID{},
+		},
+		{
+			name: "nested playlist only brings in the tracks it keeps",
+			graph: Graph{
+				"root":  {Children: []spotify.ID{"child"}},
+				"child": {Children: []spotify.ID{"grandchild"}, Rules: []Rule{include("a2", Album)}, Narrowed: []spotify.ID{"t1", "t3"}},
+				// Reaches root through child, so child's narrowing applies
+				"grandchild": {Rules: []Rule{include("a1", Album)}},
+			},
+			want: []spotify.ID{"t1", "t3"},
+		},
+		{
+			name: "own rules aren't narrowed by a nested playlist",
+			graph: Graph{
+				"root":  {Rules: []Rule{include("t2", Track)}, Children: []spotify.ID{"child"}},
+				"child": {Rules: []Rule{include("a1", Album)}, Narrowed: []spotify.ID{}},
+			},
+			want: []spotify.ID{"t2"},
+		},
+		{
+			name: "resolved playlist ignores its own narrowing",
+			graph: Graph{
+				"root": {Rules: []Rule{include("a2", Album)}, Narrowed: []spotify.ID{}},
+			},
+			want: []spotify.ID{"t4"},
+		},
+		{
+			name: "excluded playlist subtracts the tracks it keeps",
+			graph: Graph{
+				"root":       {Rules: []Rule{include("artist", Artist)}, Excluded: []spotify.ID{"overplayed"}},
+				"overplayed": {Rules: []Rule{include("a1", Album)}, Narrowed: []spotify.ID{"t2"}},
+			},
+			want: []spotify.ID{"t1", "t3", "t4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Resolve(tt.graph, "root", exp)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplain(t *testing.T) {
+	graph := Graph{
+		"root":  {Rules: []Rule{exclude("a1", Album)}, Children: []spotify.ID{"child"}},
+		"child": {Rules: []Rule{include("t2", Track), include("artist", Artist)}},
+	}
+
+	decision := Explain(graph, "root", exp, "t2")
+	if decision.Included {
+		t.Errorf("t2 is included, want it excluded by a1")
+	}
+	if decision.Winner == nil || decision.Winner.Rule != exclude("a1", Album) || decision.Winner.Specificity != 2 {
+		t.Fatalf("winner is %+v, want the exclusion of a1", decision.Winner)
+	}
+	if len(decision.Matches) != 3 {
+		t.Fatalf("got %d matches, want 3", len(decision.Matches))
+	}
+
+	nested := decision.Matches[1]
+	if nested.Rule != include("t2", Track) || nested.Depth != 1 || nested.Specificity != 4 ||
+		!slices.Equal(nested.Path, []spotify.ID{"root", "child"}) {
+		t.Errorf("second match is %+v, want the inclusion of t2 through child", nested)
+	}
+
+	if decision := Explain(graph, "root", exp, "unknown"); decision.Included || decision.Winner != nil {
+		t.Errorf("unknown track got %+v, want no decision", decision)
+	}
+}
@@ -1,42 +1,25 @@
 package services
 
 import (
-	"log"
+	"context"
 	"slices"
 
 	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/fanout"
 	"github.com/zmb3/spotify/v2"
 )
 
-func getAlbumsByIds(ids []spotify.ID) []*spotify.FullAlbum {
-	spotiConn := src.GetSpotifyConn()
-	ctx, client := spotiConn.Ctx, spotiConn.Client
+func getAlbumsByIds(conn *src.SpotifyConn, ids []spotify.ID) ([]*spotify.FullAlbum, error) {
+	chunks := slices.Collect(slices.Chunk(ids, 20))
 
-	chunks := slices.Chunk(ids, 20)
-	albums := []*spotify.FullAlbum{}
-
-	for chunk := range chunks {
-		res, err := client.GetAlbums(ctx, chunk)
-		if err != nil {
-			log.Fatal(err)
-		}
-		albums = append(albums, res...)	
-	}
-	
-	return albums
+	return fanout.FlatMap(conn.Ctx, fanout.Limit(), chunks, func(ctx context.Context, chunk []spotify.ID) ([]*spotify.FullAlbum, error) {
+		return conn.Catalog.GetAlbums(ctx, chunk)
+	})
 }
 
 
-func getTracksFromAlbumById(id spotify.ID) []spotify.SimpleTrack{
-	spotiConn := src.GetSpotifyConn()
-	ctx, client := spotiConn.Ctx, spotiConn.Client
-
-	results, err := client.GetAlbumTracks(ctx, id, spotify.Limit(50))
+func getTracksFromAlbumById(conn *src.SpotifyConn, id spotify.ID) ([]spotify.SimpleTrack, error) {
+	ctx, cat := conn.Ctx, conn.Catalog
 
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return results.Tracks
+	return cat.GetAlbumTracks(ctx, id)
 }
-
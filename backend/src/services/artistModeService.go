@@ -0,0 +1,179 @@
+package services
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/utils"
+	"github.com/zmb3/spotify/v2"
+)
+
+// maxTopTracks is how many top tracks Spotify returns for an artist.
+const maxTopTracks = 10
+
+// normalizeArtistInclusion checks an artist mode and drops the settings the
+// mode doesn't use. No mode is ArtistAll.
+func normalizeArtistInclusion(a *model.ArtistInclusion) (model.ArtistInclusion, error) {
+	if a == nil {
+		return model.ArtistInclusion{Mode: model.ArtistAll}, nil
+	}
+	releases, err := normalizeReleaseTypes(a.ReleaseTypes)
+	if err != nil {
+		return model.ArtistInclusion{}, err
+	}
+
+	switch a.Mode {
+	case "", model.ArtistAll:
+		return model.ArtistInclusion{Mode: model.ArtistAll, ReleaseTypes: releases}, nil
+	case model.ArtistTopTracks:
+		if a.Count < 1 || a.Count > maxTopTracks {
+			return model.ArtistInclusion{}, errs.Invalid("count of top tracks must be between 1 and %d", maxTopTracks)
+		}
+		return model.ArtistInclusion{Mode: a.Mode, Count: a.Count, ReleaseTypes: releases}, nil
+	case model.ArtistLatest:
+		if a.Count < 1 {
+			return model.ArtistInclusion{}, errs.Invalid("count of latest releases must be at least 1")
+		}
+		return model.ArtistInclusion{Mode: a.Mode, Count: a.Count, ReleaseTypes: releases}, nil
+	case model.ArtistSince:
+		if _, err := time.Parse(time.DateOnly, a.Since); err != nil {
+			return model.ArtistInclusion{}, errs.Invalid("since must be a date like 2019-01-31, got %q", a.Since)
+		}
+		return model.ArtistInclusion{Mode: a.Mode, Since: a.Since, ReleaseTypes: releases}, nil
+	}
+	return model.ArtistInclusion{}, errs.Invalid("unknown artist mode %q", a.Mode)
+}
+
+// normalizeReleaseTypes checks release types and puts them in a fixed order,
+// leaving them empty when they're the default.
+func normalizeReleaseTypes(releases []model.ReleaseType) ([]model.ReleaseType, error) {
+	for _, r := range releases {
+		if !slices.Contains(model.ReleaseTypes, r) {
+			return nil, errs.Invalid("unknown release type %q", r)
+		}
+	}
+
+	normalized := slices.DeleteFunc(slices.Clone(model.ReleaseTypes), func(r model.ReleaseType) bool {
+		return !slices.Contains(releases, r)
+	})
+	if len(normalized) == 0 || slices.Equal(normalized, model.DefaultReleaseTypes) {
+		return nil, nil
+	}
+	return normalized, nil
+}
+
+// artistInclusions returns the artist modes of the inclusions of a
+// playlist, by item.
+func artistInclusions(playlistID spotify.ID) (map[spotify.ID]model.ArtistInclusion, error) {
+	var inclusions []model.PlaylistInclusion
+	if err := src.GetDbConn().Db.Where("playlist_spotify_id = ?", playlistID).Find(&inclusions).Error; err != nil {
+		return nil, err
+	}
+
+	modes := map[spotify.ID]model.ArtistInclusion{}
+	for _, in := range inclusions {
+		modes[in.IdItemSpotifyID] = in.ArtistInclusion
+	}
+	return modes, nil
+}
+
+// artistVariant names the part of an artist's tracks a mode brings in, as a
+// resolver.Rule variant, like "latest:2@album,single". parseArtistVariant
+// reads it back.
+func artistVariant(a model.ArtistInclusion) string {
+	variant := ""
+	switch a.Mode {
+	case model.ArtistTopTracks, model.ArtistLatest:
+		variant = fmt.Sprintf("%s:%d", a.Mode, a.Count)
+	case model.ArtistSince:
+		variant = fmt.Sprintf("%s:%s", a.Mode, a.Since)
+	}
+	if len(a.ReleaseTypes) > 0 {
+		variant += "@" + strings.Join(utils.Map(a.ReleaseTypes, func(r model.ReleaseType) string { return string(r) }), ",")
+	}
+	return variant
+}
+
+func parseArtistVariant(variant string) model.ArtistInclusion {
+	variant, releases, _ := strings.Cut(variant, "@")
+	mode, value, _ := strings.Cut(variant, ":")
+	a := model.ArtistInclusion{Mode: model.ArtistMode(mode)}
+	if releases != "" {
+		a.ReleaseTypes = utils.Map(strings.Split(releases, ","), func(r string) model.ReleaseType { return model.ReleaseType(r) })
+	}
+	switch a.Mode {
+	case model.ArtistTopTracks, model.ArtistLatest:
+		a.Count, _ = strconv.Atoi(value)
+	case model.ArtistSince:
+		a.Since = value
+	default:
+		a.Mode = model.ArtistAll
+	}
+	return a
+}
+
+// getArtistTracks returns the tracks including the artist in the given mode
+// brings in.
+func getArtistTracks(conn *src.SpotifyConn, id spotify.ID, a model.ArtistInclusion) ([]spotify.SimpleTrack, error) {
+	switch a.Mode {
+	case model.ArtistTopTracks:
+		top, err := conn.Catalog.GetArtistTopTracks(conn.Ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		// Only release types picked explicitly narrow down the top tracks, so
+		// inclusions from before there were any keep all of them
+		if len(a.ReleaseTypes) > 0 {
+			top = slices.DeleteFunc(top, func(t spotify.FullTrack) bool {
+				return !slices.Contains(a.ReleaseTypes, releaseType(t.Album, id))
+			})
+		}
+		top = top[:min(len(top), a.Count)]
+		return utils.Map(top, func(t spotify.FullTrack) spotify.SimpleTrack { return t.SimpleTrack }), nil
+	case model.ArtistLatest, model.ArtistSince:
+		albums, err := GetAlbumsFromArtistById(conn, id, a.Releases())
+		if err != nil {
+			return nil, err
+		}
+		return getArtistAlbumTracks(conn, id, selectReleases(albums, a))
+	}
+	return getTracksFromArtistById(conn, id, a.Releases())
+}
+
+// selectReleases keeps the latest Count albums, or those released on or
+// after Since, in catalog order.
+func selectReleases(albums []spotify.SimpleAlbum, a model.ArtistInclusion) []spotify.SimpleAlbum {
+	if a.Mode == model.ArtistSince {
+		return slices.DeleteFunc(slices.Clone(albums), func(album spotify.SimpleAlbum) bool {
+			return releaseDay(album.ReleaseDate) < a.Since
+		})
+	}
+
+	latest := slices.Clone(albums)
+	slices.SortStableFunc(latest, func(x, y spotify.SimpleAlbum) int {
+		return cmp.Compare(releaseDay(y.ReleaseDate), releaseDay(x.ReleaseDate))
+	})
+	latest = latest[:min(len(latest), a.Count)]
+	return slices.DeleteFunc(slices.Clone(albums), func(album spotify.SimpleAlbum) bool {
+		return !slices.ContainsFunc(latest, func(l spotify.SimpleAlbum) bool { return l.ID == album.ID })
+	})
+}
+
+// releaseDay pads a release date Spotify only knows the year or month of
+// to its first day, so dates compare as strings.
+func releaseDay(date string) string {
+	switch len(date) {
+	case 4:
+		return date + "-01-01"
+	case 7:
+		return date + "-01"
+	}
+	return date
+}
@@ -1,67 +1,69 @@
 package services
 
 import (
-	"log"
+	"context"
 	"slices"
 
 	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/fanout"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/utils"
 	"github.com/zmb3/spotify/v2"
 )
 
-func getArtistsByIds(ids []spotify.ID) []*spotify.FullArtist {
-	spotiConn := src.GetSpotifyConn()
-	ctx, client := spotiConn.Ctx, spotiConn.Client
+func getArtistsByIds(conn *src.SpotifyConn, ids []spotify.ID) ([]*spotify.FullArtist, error) {
+	chunks := slices.Collect(slices.Chunk(ids, 50))
 
-	chunks := slices.Chunk(ids, 50)
-	artists := []*spotify.FullArtist{}
+	return fanout.FlatMap(conn.Ctx, fanout.Limit(), chunks, func(ctx context.Context, chunk []spotify.ID) ([]*spotify.FullArtist, error) {
+		return conn.Catalog.GetArtists(ctx, chunk)
+	})
+}
 
-	for chunk := range chunks {
-		res, err := client.GetArtists(ctx, chunk...)
-		if err != nil {
-			log.Fatal(err)
-		}
-		artists = append(artists, res...)	
-	}
-	return artists
+var albumTypes = map[model.ReleaseType]spotify.AlbumType{
+	model.ReleaseAlbum:       spotify.AlbumTypeAlbum,
+	model.ReleaseSingle:      spotify.AlbumTypeSingle,
+	model.ReleaseCompilation: spotify.AlbumTypeCompilation,
+	model.ReleaseAppearsOn:   spotify.AlbumTypeAppearsOn,
 }
 
-func GetAlbumsFromArtistById(id spotify.ID) []spotify.SimpleAlbum{
-	spotiConn := src.GetSpotifyConn()
-	ctx, client := spotiConn.Ctx, spotiConn.Client
+// GetAlbumsFromArtistById returns the artist's releases of the given types.
+func GetAlbumsFromArtistById(conn *src.SpotifyConn, id spotify.ID, releases []model.ReleaseType) ([]spotify.SimpleAlbum, error) {
+	ctx, cat := conn.Ctx, conn.Catalog
 
-	albums, err := client.GetArtistAlbums(ctx, id, []spotify.AlbumType{spotify.AlbumTypeAlbum}, spotify.Limit(50))
+	return cat.GetArtistAlbums(ctx, id, utils.Map(releases, func(r model.ReleaseType) spotify.AlbumType { return albumTypes[r] }))
+}
 
-	if err != nil {
-		log.Fatal(err)
+// releaseType tells which part of the artist's discography an album is in.
+// Albums fetched for the artist know it; for others it's guessed from the
+// album's type and artists.
+func releaseType(album spotify.SimpleAlbum, artist spotify.ID) model.ReleaseType {
+	if album.AlbumGroup != "" {
+		return model.ReleaseType(album.AlbumGroup)
 	}
-
-	return albums.Albums
+	if !slices.ContainsFunc(album.Artists, func(a spotify.SimpleArtist) bool { return a.ID == artist }) {
+		return model.ReleaseAppearsOn
+	}
+	return model.ReleaseType(album.AlbumType)
 }
 
-func GetAlbumsAndSinglesFromArtistById(id spotify.ID) []spotify.SimpleAlbum{
-	spotiConn := src.GetSpotifyConn()
-	ctx, client := spotiConn.Ctx, spotiConn.Client
-
-	albums, err := client.GetArtistAlbums(ctx, id, []spotify.AlbumType{spotify.AlbumTypeAlbum, spotify.AlbumTypeSingle}, spotify.Limit(50))
-
+func getTracksFromArtistById(conn *src.SpotifyConn, id spotify.ID, releases []model.ReleaseType) ([]spotify.SimpleTrack, error) {
+	albums, err := GetAlbumsFromArtistById(conn, id, releases)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-
-	return albums.Albums
+	return getArtistAlbumTracks(conn, id, albums)
 }
 
-func getTracksFromArtistById(id spotify.ID) []spotify.SimpleTrack{
-	albums := GetAlbumsFromArtistById(id)
-	var result []spotify.SimpleTrack = []spotify.SimpleTrack{}
-
-	// handle album results
-	if albums != nil {
-		for _, album := range albums {
-			tracks := getTracksFromAlbumById(album.ID)
-			result = append(result, tracks...)
+// getArtistAlbumTracks returns the tracks of the artist's albums. Of the
+// albums the artist only appears on, just the tracks they play on count.
+func getArtistAlbumTracks(conn *src.SpotifyConn, id spotify.ID, albums []spotify.SimpleAlbum) ([]spotify.SimpleTrack, error) {
+	return fanout.FlatMap(conn.Ctx, fanout.Limit(), albums, func(ctx context.Context, album spotify.SimpleAlbum) ([]spotify.SimpleTrack, error) {
+		tracks, err := getTracksFromAlbumById(conn.WithContext(ctx), album.ID)
+		if err != nil || releaseType(album, id) != model.ReleaseAppearsOn {
+			return tracks, err
 		}
-	}
-
-	return result
+		return slices.DeleteFunc(tracks, func(t spotify.SimpleTrack) bool {
+			return !slices.ContainsFunc(t.Artists, func(a spotify.SimpleArtist) bool { return a.ID == id })
+		}), nil
+	})
 }
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/catalog"
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/zmb3/spotify/v2"
+)
+
+// cachePruneSpec is how often expired catalog cache entries are dropped.
+const cachePruneSpec = "@daily"
+
+// InvalidateCache drops the cached catalog data of an artist, album or
+// track, so it is fetched from Spotify again on next use.
+func InvalidateCache(id spotify.ID) (int64, error) {
+	dbConn := src.GetDbConn()
+	return catalog.InvalidateCache(dbConn.Ctx, dbConn.Db, id)
+}
+
+// ClearCache drops the whole catalog cache. The cache is shared by every
+// user, so only the users listed in CACHE_ADMINS may clear it.
+func ClearCache(conn *src.SpotifyConn) (int64, error) {
+	if !isCacheAdmin(conn.UserID) {
+		return 0, errs.ErrForbidden
+	}
+
+	dbConn := src.GetDbConn()
+	return catalog.ClearCache(dbConn.Ctx, dbConn.Db)
+}
+
+// isCacheAdmin reports whether userID is in the comma separated
+// CACHE_ADMINS.
+func isCacheAdmin(userID string) bool {
+	admins := strings.Split(os.Getenv("CACHE_ADMINS"), ",")
+	for i := range admins {
+		admins[i] = strings.TrimSpace(admins[i])
+	}
+	return userID != "" && slices.Contains(admins, userID)
+}
+
+// PruneCache drops the catalog cache entries that have expired.
+func PruneCache() (int64, error) {
+	dbConn := src.GetDbConn()
+	return catalog.PruneCache(dbConn.Ctx, dbConn.Db, catalog.CacheTTLFromEnv())
+}
+
+// StartCachePruning prunes the catalog cache once a day, alongside the
+// playlist schedules.
+func StartCachePruning() error {
+	_, err := scheduler.AddFunc(cachePruneSpec, func() {
+		removed, err := PruneCache()
+		if err != nil {
+			log.Println("Failed to prune catalog cache:", err)
+			return
+		}
+		log.Printf("Pruned %d expired catalog cache entries", removed)
+	})
+	return err
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"slices"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/resolver"
+	"github.com/zmb3/spotify/v2"
+	"gorm.io/gorm"
+)
+
+// keepVersions maps the policies that drop duplicates to the version the
+// resolver keeps.
+var keepVersions = map[model.DuplicatePolicy]resolver.Keep{
+	model.KeepEarliestRelease: resolver.KeepEarliest,
+	model.KeepAlbumVersion:    resolver.KeepAlbum,
+	model.KeepMostPopular:     resolver.KeepPopular,
+}
+
+// SetDuplicatePolicy changes which version of a recording released more
+// than once a playlist keeps.
+func SetDuplicatePolicy(conn *src.SpotifyConn, id spotify.ID, req model.PlaylistDuplicatesRequest) (*model.PlaylistResponse, error) {
+	dbConn := src.GetDbConn()
+	ctx, db := dbConn.Ctx, dbConn.Db
+
+	if !slices.Contains(model.DuplicatePolicies, req.Policy) {
+		return nil, errs.Invalid("unknown duplicate policy %q", req.Policy)
+	}
+	playlist, err := getPlaylist(conn, id)
+	if err != nil {
+		return nil, err
+	}
+
+	playlist.Duplicates = req.Policy
+	_, err = gorm.G[model.Playlist](db).
+		Where("spotify_id = ? AND owner_id = ?", id, conn.UserID).
+		Update(ctx, "duplicates", req.Policy)
+	return playlist.ToResponse(), err
+}
+
+func trackVersions(details map[spotify.ID]*spotify.FullTrack) map[spotify.ID]resolver.Version {
+	versions := map[spotify.ID]resolver.Version{}
+	for id, t := range details {
+		versions[id] = resolver.Version{
+			ISRC:        t.ExternalIDs["isrc"],
+			Name:        t.Name,
+			DurationMs:  int(t.Duration),
+			ReleaseDate: t.Album.ReleaseDate,
+			AlbumType:   t.Album.AlbumType,
+			Popularity:  int(t.Popularity),
+		}
+	}
+	return versions
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"slices"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/resolver"
+	"github.com/aarhunt/spootify/src/utils"
+	"github.com/zmb3/spotify/v2"
+	"gorm.io/gorm"
+)
+
+var setOps = map[model.SetOperator]resolver.Op{
+	model.OpUnion:        resolver.Union,
+	model.OpIntersection: resolver.Intersection,
+	model.OpDifference:   resolver.Difference,
+}
+
+// SetPlaylistExpression defines a playlist by a set expression over other
+// playlists of the user, or stops defining it by one. An expression
+// depending on the playlist itself, directly or through nesting, or nesting
+// playlists too deep is refused.
+func SetPlaylistExpression(conn *src.SpotifyConn, id spotify.ID, req model.PlaylistExpressionRequest) (*model.PlaylistResponse, error) {
+	db := src.GetDbConn().Db
+
+	playlist, err := getPlaylist(conn, id)
+	if err != nil {
+		return nil, err
+	}
+
+	operands := []*model.Playlist{}
+	if req.Expression != nil {
+		if err := validateExpression(*req.Expression); err != nil {
+			return nil, err
+		}
+		for _, operandID := range toExpr(*req.Expression).Playlists() {
+			operand, err := getPlaylist(conn, operandID)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkNesting(playlist, operand); err != nil {
+				return nil, err
+			}
+			operands = append(operands, operand)
+		}
+	}
+
+	playlist.Expression = req.Expression
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(playlist).Select("Expression").Updates(playlist).Error; err != nil {
+			return err
+		}
+		return tx.Model(playlist).Omit("Operands.*").Association("Operands").Replace(operands)
+	})
+	return playlist.ToResponse(), err
+}
+
+// validateExpression checks that every node is either a playlist or a
+// known operator over two or more operands.
+func validateExpression(e model.SetExpression) error {
+	if e.Op == "" {
+		if e.Playlist == "" || len(e.Operands) > 0 {
+			return errs.Invalid("an expression needs either a playlist or an operator with operands")
+		}
+		return nil
+	}
+
+	if !slices.Contains(model.SetOperators, e.Op) {
+		return errs.Invalid("unknown set operator %q", e.Op)
+	}
+	if e.Playlist != "" {
+		return errs.Invalid("the %s of playlist %s needs to be written as a playlist operand", e.Op, e.Playlist)
+	}
+	if len(e.Operands) < 2 {
+		return errs.Invalid("%s needs at least two operands", e.Op)
+	}
+	for _, operand := range e.Operands {
+		if err := validateExpression(operand); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toExpr(e model.SetExpression) resolver.Expr {
+	if e.Op == "" {
+		return resolver.Expr{Op: resolver.Leaf, Playlist: e.Playlist}
+	}
+	return resolver.Expr{Op: setOps[e.Op], Operands: utils.Map(e.Operands, toExpr)}
+}
+
+func GetOperandPlaylistsFromPlaylist(p *model.Playlist) []model.Playlist {
+	var operands = []model.Playlist{}
+
+	_ = src.GetDbConn().Db.
+		Table("playlists").
+		Joins("JOIN playlist_expression_operands ON playlist_expression_operands.operand_spotify_id = playlists.spotify_id").
+		Where("playlist_expression_operands.playlist_spotify_id = ?", p.SpotifyID).
+		Find(&operands).Error
+
+	return operands
+}
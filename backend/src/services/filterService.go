@@ -0,0 +1,59 @@
+package services
+
+import (
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/metafilter"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/resolver"
+	"github.com/zmb3/spotify/v2"
+	"gorm.io/gorm"
+)
+
+// SetPlaylistFilters replaces the metadata filters of a playlist. Empty
+// filters let every resolved track through.
+func SetPlaylistFilters(conn *src.SpotifyConn, id spotify.ID, filters model.MetadataFilters) (*model.PlaylistResponse, error) {
+	dbConn := src.GetDbConn()
+	ctx, db := dbConn.Ctx, dbConn.Db
+
+	if err := metafilter.Validate(filters); err != nil {
+		return nil, err
+	}
+	playlist, err := getPlaylist(conn, id)
+	if err != nil {
+		return nil, err
+	}
+
+	playlist.Filters = filters
+	_, err = gorm.G[model.Playlist](db).
+		Where("spotify_id = ? AND owner_id = ?", id, conn.UserID).
+		Select("Filters").
+		Updates(ctx, *playlist)
+	return playlist.ToResponse(), err
+}
+
+// filteredDecision is a decision to include a track that the metadata
+// filters overruled.
+type filteredDecision struct {
+	resolver.Decision
+	reason string
+}
+
+// filterDecisions splits decisions into those for tracks passing the
+// filters and those for tracks failing them. Tracks without details can't
+// be checked and are kept.
+func filterDecisions(filters model.MetadataFilters, decisions []resolver.Decision, details map[spotify.ID]*spotify.FullTrack) ([]resolver.Decision, []filteredDecision) {
+	kept, filtered := []resolver.Decision{}, []filteredDecision{}
+	for _, d := range decisions {
+		t, ok := details[d.Track]
+		if !ok {
+			kept = append(kept, d)
+			continue
+		}
+		if reason, ok := metafilter.Check(filters, t); ok {
+			kept = append(kept, d)
+		} else {
+			filtered = append(filtered, filteredDecision{d, reason})
+		}
+	}
+	return kept, filtered
+}
@@ -1,9 +1,7 @@
 package services
 
 import (
-	"log"
 	"slices"
-	"strings"
 
 	"github.com/aarhunt/spootify/src"
 	"github.com/aarhunt/spootify/src/model"
@@ -14,11 +12,14 @@ import (
 )
 
 // Include or exclude an item from a playlist
-func IncludeExcludeItem(req model.ItemInclusionRequest, recurse bool, override bool) (*model.InclusionResponse, error) {
+func IncludeExcludeItem(conn *src.SpotifyConn, req model.ItemInclusionRequest, recurse bool, override bool) (*model.InclusionResponse, error) {
 	dbConn := src.GetDbConn()
 	db := dbConn.Db
 
-	playlist, err := getPlaylist(req.PlaylistID)
+	playlist, err := getPlaylist(conn, req.PlaylistID)
+	if err != nil {
+		return nil, err
+	}
 
 	newItem := model.IdItem{
 		SpotifyID: req.ItemSpotifyID,
@@ -26,8 +27,15 @@ func IncludeExcludeItem(req model.ItemInclusionRequest, recurse bool, override b
 		Playlists: []model.Playlist{},
 	}
 
+	artistMode, err := normalizeArtistInclusion(req.Artist)
+	if err != nil {
+		return nil, err
+	}
+
 	if *req.Include && recurse {
-		GetAutoExclusions(req, false)
+		if err := GetAutoExclusions(conn, req, false); err != nil {
+			return nil, err
+		}
 	}
 
 	returnItem := model.InclusionResponse{
@@ -35,7 +43,7 @@ func IncludeExcludeItem(req model.ItemInclusionRequest, recurse bool, override b
 		Included: model.InclusionType(0),
 	}
 
-	db.Transaction(func(tx *gorm.DB) error {
+	err = db.Transaction(func(tx *gorm.DB) error {
 		err := tx.Clauses(clause.OnConflict{
 			Columns:   []clause.Column{{Name: "spotify_id"}},
 			UpdateAll: true,
@@ -64,6 +72,12 @@ func IncludeExcludeItem(req model.ItemInclusionRequest, recurse bool, override b
 
 			tx.Model(&playlist).Association("Exclusions").Delete(&newItem)
 			err = tx.Model(&playlist).Association("Inclusions").Append(&newItem)
+			if err == nil && req.ItemType == model.Artist {
+				err = tx.Model(&model.PlaylistInclusion{}).
+					Where("playlist_spotify_id = ? AND id_item_spotify_id = ?", playlist.SpotifyID, newItem.SpotifyID).
+					Select("artist_mode", "artist_count", "artist_since", "artist_release_types").
+					Updates(model.PlaylistInclusion{ArtistInclusion: artistMode}).Error
+			}
 			returnItem.Included = model.Included
 		} else {
 			if !override && isIncluded {
@@ -85,85 +99,80 @@ func IncludeExcludeItem(req model.ItemInclusionRequest, recurse bool, override b
 	return &returnItem, err
 }
 
-func GetAutoExclusions(req model.ItemInclusionRequest, undo bool) {
-	ex := []spotify.ID{}
-	var itemType model.ItemType = model.Track;
-	
-	included := false
-	excluded := false
+// GetAutoExclusions excludes what the rule sets attached to the playlist
+// match along with an included artist or album, or stops excluding it when
+// undo is set.
+func GetAutoExclusions(conn *src.SpotifyConn, req model.ItemInclusionRequest, undo bool) error {
+	matcher, err := playlistMatcher(req.PlaylistID)
+	if err != nil {
+		return err
+	}
 
-	switch req.ItemType {
-	case model.Artist:
-		albums := GetAlbumsFromArtistById(req.ItemSpotifyID)
+	// Undoing goes by the releases the artist was included with
+	artist, err := normalizeArtistInclusion(req.Artist)
+	if err != nil {
+		return err
+	}
+	if undo && req.ItemType == model.Artist {
+		modes, err := artistInclusions(req.PlaylistID)
+		if err != nil {
+			return err
+		}
+		artist = modes[req.ItemSpotifyID]
+	}
 
-		for i := len(albums)-1; i >= 0; i-- {
-			album := albums[i] 
+	albums, tracks, err := findAutoExclusions(conn, matcher, req.ItemType, req.ItemSpotifyID, artist.Releases())
+	if err != nil {
+		return err
+	}
 
-			if strings.Contains(strings.ToLower(album.Name), "live") { ex = append(ex, album.ID)
-			} else if strings.Contains(strings.ToLower(album.Name), "instrumental") {ex = append(ex, album.ID)
-			} else if strings.Contains(strings.ToLower(album.Name), "acoustic") {ex = append(ex, album.ID)
+	included := false
+	excluded := false
+	apply := func(items []model.ExcludedItem, itemType model.ItemType) error {
+		for _, item := range items {
+			var err error
+			if !undo {
+				_, err = IncludeExcludeItem(conn, model.ItemInclusionRequest{
+					ItemSpotifyID: item.SpotifyID,
+					ItemType: itemType,
+					PlaylistID: req.PlaylistID,
+					Include: &included,
+				}, false, false)
 			} else {
-				GetAutoExclusions(model.ItemInclusionRequest{
-					ItemSpotifyID: album.ID,
-					ItemType: model.Album,
+				_, err = UndoIncludeExcludeItem(conn, model.ItemInclusionRequest{
+					ItemSpotifyID: item.SpotifyID,
+					ItemType: itemType,
 					PlaylistID: req.PlaylistID,
-					Include: nil,
-				}, undo)
+					Include: &excluded,
+				})
+			}
+			if err != nil {
+				return err
 			}
 		}
-
-		itemType = model.Album
-	case model.Album:
-		tracks := getTracksFromAlbumById(req.ItemSpotifyID)
-		for i := len(tracks)-1; i >= 0; i-- {
-			track := tracks[i] 
-
-			if strings.Contains(strings.ToLower(track.Name), "- live") { ex = append(ex, track.ID)
-			} else if strings.Contains(strings.ToLower(track.Name), "- instrumental") {ex = append(ex, track.ID)
-			} else if strings.Contains(strings.ToLower(track.Name), "- acoustic") {ex = append(ex, track.ID)
-			} else if strings.Contains(strings.ToLower(track.Name), "- orchestral") {ex = append(ex, track.ID)
-			} else if strings.Contains(strings.ToLower(track.Name), "- single") {ex = append(ex, track.ID)
-			} 
-		}
-
-		itemType = model.Track
-	case model.Track:
-		return
+		return nil
 	}
 
-	if !undo {
-		for _, id := range ex {
-			IncludeExcludeItem(model.ItemInclusionRequest{
-				ItemSpotifyID: id,
-				ItemType: itemType,
-				PlaylistID: req.PlaylistID,
-				Include: &included,
-			}, false, false)
-		}
-	} else {
-		for _, id := range ex {
-			UndoIncludeExcludeItem(model.ItemInclusionRequest{
-				ItemSpotifyID: id,
-				ItemType: itemType,
-				PlaylistID: req.PlaylistID,
-				Include: &excluded,
-			})
-		}
+	if err := apply(albums, model.Album); err != nil {
+		return err
 	}
+	return apply(tracks, model.Track)
 }
 
 // Undo the inclusion or exclusion of an item from a playlist
-func UndoIncludeExcludeItem(req model.ItemInclusionRequest) (*model.InclusionResponse, error) {
+func UndoIncludeExcludeItem(conn *src.SpotifyConn, req model.ItemInclusionRequest) (*model.InclusionResponse, error) {
     dbConn := src.GetDbConn()
     db := dbConn.Db
 
-    playlist, err := getPlaylist(req.PlaylistID)
+    playlist, err := getPlaylist(conn, req.PlaylistID)
     if err != nil {
         return nil, err
     }
 
 	if *req.Include {
-		GetAutoExclusions(req, true)
+		if err := GetAutoExclusions(conn, req, true); err != nil {
+			return nil, err
+		}
 	}
 
     item := model.IdItem{SpotifyID: req.ItemSpotifyID}
@@ -192,57 +201,130 @@ func UndoIncludeExcludeItem(req model.ItemInclusionRequest) (*model.InclusionRes
 
 
 
-// Include a playlist into a playlist
-func IncludePlaylist(req model.ItemPlaylistRequest) (*model.PlaylistResponse, error) {
-	dbConn := src.GetDbConn()
-	ctx, db := dbConn.Ctx, dbConn.Db
+// Include a playlist into a playlist, unless that makes a loop or nests
+// playlists deeper than MaxNestingDepth
+func IncludePlaylist(conn *src.SpotifyConn, req model.ItemPlaylistRequest) (*model.PlaylistResponse, error) {
+	db := src.GetDbConn().Db
+
+	parentPlaylist, err := getPlaylist(conn, req.ParentSpotifyID)
+	if err != nil {
+		return nil, err
+	}
+	childPlaylist, err := getPlaylist(conn, req.ChildSpotifyID)
+	if err != nil {
+		return nil, err
+	}
 
-	parentPlaylist, err := gorm.G[model.Playlist](db).Where("spotify_id = ?", req.ParentSpotifyID).First(ctx)
-	childPlaylist, err := gorm.G[model.Playlist](db).Where("spotify_id = ?", req.ChildSpotifyID).First(ctx)
+	if err := checkNesting(parentPlaylist, childPlaylist); err != nil {
+		return nil, err
+	}
 
-	err = db.Model(&parentPlaylist).Association("IncludedPlaylists").Append(&childPlaylist)
+	err = db.Model(parentPlaylist).Association("IncludedPlaylists").Append(childPlaylist)
 	return parentPlaylist.ToResponse(), err
 }
 
 
 // Include a playlist into a playlist
-func UndoIncludePlaylist(req model.ItemPlaylistRequest) (*model.PlaylistResponse, error) {
-	dbConn := src.GetDbConn()
-	ctx, db := dbConn.Ctx, dbConn.Db
+func UndoIncludePlaylist(conn *src.SpotifyConn, req model.ItemPlaylistRequest) (*model.PlaylistResponse, error) {
+	db := src.GetDbConn().Db
 
-	parentPlaylist, err := gorm.G[model.Playlist](db).Where("spotify_id = ?", req.ParentSpotifyID).First(ctx)
-	childPlaylist, err := gorm.G[model.Playlist](db).Where("spotify_id = ?", req.ChildSpotifyID).First(ctx)
+	parentPlaylist, err := getPlaylist(conn, req.ParentSpotifyID)
+	if err != nil {
+		return nil, err
+	}
+	childPlaylist, err := getPlaylist(conn, req.ChildSpotifyID)
+	if err != nil {
+		return nil, err
+	}
 
-	err = db.Model(&parentPlaylist).Association("IncludedPlaylists").Delete(&childPlaylist)
+	err = db.Model(parentPlaylist).Association("IncludedPlaylists").Delete(childPlaylist)
 	return parentPlaylist.ToResponse(), err
 }
 
-// Get a specific album from an artist
-func GetAlbumFromArtist(req model.ItemRequest) ([]model.ItemResponse, error) {
-	conn := src.GetSpotifyConn()
-	ctx, client := conn.Ctx, conn.Client
+// Exclude a playlist from a playlist, subtracting the tracks it resolves to.
+// Loops and nesting deeper than MaxNestingDepth are refused as for inclusions.
+func ExcludePlaylist(conn *src.SpotifyConn, req model.ItemPlaylistRequest) (*model.PlaylistResponse, error) {
+	db := src.GetDbConn().Db
 
-	playlist, err := getPlaylist(req.PlaylistID)
-	results, err := client.GetArtistAlbums(ctx, req.ParentID, []spotify.AlbumType{spotify.AlbumTypeAlbum, spotify.AlbumTypeSingle}, spotify.Limit(50))
+	parentPlaylist, err := getPlaylist(conn, req.ParentSpotifyID)
+	if err != nil {
+		return nil, err
+	}
+	childPlaylist, err := getPlaylist(conn, req.ChildSpotifyID)
+	if err != nil {
+		return nil, err
+	}
 
-	var albums = results.Albums
+	if err := checkNesting(parentPlaylist, childPlaylist); err != nil {
+		return nil, err
+	}
 
-	return albumToResponse(albums, playlist), err
+	err = db.Model(parentPlaylist).Association("ExcludedPlaylists").Append(childPlaylist)
+	return parentPlaylist.ToResponse(), err
 }
 
-func GetTracksFromAlbum(req model.ItemRequest) ([]model.ItemResponse, error) {
-	conn := src.GetSpotifyConn()
-	ctx, client := conn.Ctx, conn.Client
+// Undo the exclusion of a playlist from a playlist
+func UndoExcludePlaylist(conn *src.SpotifyConn, req model.ItemPlaylistRequest) (*model.PlaylistResponse, error) {
+	db := src.GetDbConn().Db
 
-	playlist, err := getPlaylist(req.PlaylistID)
-	results, err := client.GetAlbumTracks(ctx, req.ParentID, spotify.Limit(50))
+	parentPlaylist, err := getPlaylist(conn, req.ParentSpotifyID)
+	if err != nil {
+		return nil, err
+	}
+	childPlaylist, err := getPlaylist(conn, req.ChildSpotifyID)
+	if err != nil {
+		return nil, err
+	}
 
-	var tracks = results.Tracks
+	err = db.Model(parentPlaylist).Association("ExcludedPlaylists").Delete(childPlaylist)
+	return parentPlaylist.ToResponse(), err
+}
+
+// Get a specific album from an artist
+func GetAlbumFromArtist(conn *src.SpotifyConn, req model.ItemRequest) ([]model.ItemResponse, error) {
+	ctx, cat := conn.Ctx, conn.Catalog
+
+	playlist, err := getPlaylist(conn, req.PlaylistID)
+	if err != nil {
+		return nil, err
+	}
+	modes, err := artistInclusions(playlist.SpotifyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Browsing shows albums and singles, and whatever else the artist is
+	// included with
+	releases := []model.ReleaseType{model.ReleaseAlbum, model.ReleaseSingle}
+	for _, r := range modes[req.ParentID].ReleaseTypes {
+		if !slices.Contains(releases, r) {
+			releases = append(releases, r)
+		}
+	}
+	albums, err := cat.GetArtistAlbums(ctx, req.ParentID, utils.Map(releases, func(r model.ReleaseType) spotify.AlbumType { return albumTypes[r] }))
+	if err != nil {
+		return nil, err
+	}
 
-	return singleAlbumTrackToResponse(tracks, playlist, req.ParentID), err
+	return albumToResponse(conn, albums, playlist, req.ParentID, modes)
 }
 
-func IncludedItemsToResponse(items []model.IdItem, included model.InclusionType) []model.ItemResponse {
+func GetTracksFromAlbum(conn *src.SpotifyConn, req model.ItemRequest) ([]model.ItemResponse, error) {
+	ctx, cat := conn.Ctx, conn.Catalog
+
+	playlist, err := getPlaylist(conn, req.PlaylistID)
+	if err != nil {
+		return nil, err
+	}
+	tracks, err := cat.GetAlbumTracks(ctx, req.ParentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return singleAlbumTrackToResponse(tracks, playlist, req.ParentID), nil
+}
+
+func IncludedItemsToResponse(conn *src.SpotifyConn, items []model.IdItem, included model.InclusionType) ([]model.ItemResponse, error) {
 	results := []model.ItemResponse{}
 
 	artists := []model.IdItem{}
@@ -261,9 +343,18 @@ func IncludedItemsToResponse(items []model.IdItem, included model.InclusionType)
 	}
 
 	toId := func(i model.IdItem) spotify.ID {return i.SpotifyID}
-	fullArtists := getArtistsByIds(utils.Map(artists, toId))
-	fullAlbums := getAlbumsByIds(utils.Map(albums, toId))
-	fullTracks := getTracks(utils.Map(tracks, toId))
+	fullArtists, err := getArtistsByIds(conn, utils.Map(artists, toId))
+	if err != nil {
+		return nil, err
+	}
+	fullAlbums, err := getAlbumsByIds(conn, utils.Map(albums, toId))
+	if err != nil {
+		return nil, err
+	}
+	fullTracks, err := getTracks(conn, utils.Map(tracks, toId))
+	if err != nil {
+		return nil, err
+	}
 
 	results = append(results, utils.Map(fullArtists, func(a *spotify.FullArtist) model.ItemResponse {
 		return model.ItemResponse{
@@ -297,7 +388,7 @@ func IncludedItemsToResponse(items []model.IdItem, included model.InclusionType)
 		}
 	})...)
 
-	return results
+	return results, nil
 }
 
 func artistToResponse(artists []spotify.FullArtist, playlist *model.Playlist) []model.ItemResponse {
@@ -324,27 +415,52 @@ func artistToResponse(artists []spotify.FullArtist, playlist *model.Playlist) []
 	})
 }
 
-func albumToResponse(albums []spotify.SimpleAlbum, playlist *model.Playlist) []model.ItemResponse {
+// albumToResponse marks albums included or excluded through an artist by
+// the artist browsed, or each album's first artist if none. An included
+// artist only brings in the albums its mode selects.
+func albumToResponse(conn *src.SpotifyConn, albums []spotify.SimpleAlbum, playlist *model.Playlist, artist spotify.ID,
+	modes map[spotify.ID]model.ArtistInclusion) ([]model.ItemResponse, error) {
+	artistOf := func(a spotify.SimpleAlbum) spotify.ID {
+		if artist != "" {
+			return artist
+		}
+		return a.Artists[0].ID
+	}
 	albumIDs := utils.Map(albums, func(a spotify.SimpleAlbum) spotify.ID { return a.ID })
-	artistIDs := utils.Map(albums, func(a spotify.SimpleAlbum) spotify.ID { return a.Artists[0].ID })
+	artistIDs := utils.Map(albums, artistOf)
 
 	incMap := GetInclusionMap(playlist.SpotifyID, append(albumIDs, artistIDs...))
 	excMap := GetExclusionMap(playlist.SpotifyID, append(albumIDs, artistIDs...))
 
+	selected := map[spotify.ID]map[spotify.ID]bool{}
+	for _, id := range artistIDs {
+		if _, ok := selected[id]; ok || !incMap[id] {
+			continue
+		}
+		var err error
+		if selected[id], err = selectedAlbums(conn, id, modes[id]); err != nil {
+			return nil, err
+		}
+	}
+
 	return utils.Map(albums, func(a spotify.SimpleAlbum) model.ItemResponse {
+		albumArtist := artistOf(a)
+		inclusion := slices.Contains(modes[albumArtist].Releases(), releaseType(a, albumArtist))
+		if s, ok := selected[albumArtist]; ok {
+			inclusion = s[a.ID]
+		}
 
 		var included model.InclusionType = model.Nothing;
 		if incMap[a.ID] {
 			included = model.Included
 		} else if excMap[a.ID] {
 			included = model.Excluded
-		} else if incMap[a.Artists[0].ID] {
-			if (a.AlbumType == "album") {included = model.IncludedByProxy}
-		} else if excMap[a.Artists[0].ID] {
+		} else if incMap[albumArtist] {
+			if (inclusion) {included = model.IncludedByProxy}
+		} else if excMap[albumArtist] {
 			included = model.ExcludedByProxy
 		}
 
-		inclusion := a.AlbumType == "album"
 		return model.ItemResponse{
 			SpotifyID: a.ID,
 			Name:      a.Name,
@@ -354,7 +470,29 @@ func albumToResponse(albums []spotify.SimpleAlbum, playlist *model.Playlist) []m
 			InclusionByProxy: &inclusion,
 			SortData:  a.ReleaseDateTime().Year(),
 		}
-	})
+	}), nil
+}
+
+// selectedAlbums returns the albums an artist included in the given mode
+// brings in whole, the way the resolver picks them. Top tracks bring in
+// no album whole.
+func selectedAlbums(conn *src.SpotifyConn, artist spotify.ID, a model.ArtistInclusion) (map[spotify.ID]bool, error) {
+	selected := map[spotify.ID]bool{}
+	if a.Mode == model.ArtistTopTracks {
+		return selected, nil
+	}
+
+	albums, err := GetAlbumsFromArtistById(conn, artist, a.Releases())
+	if err != nil {
+		return nil, err
+	}
+	if a.Mode == model.ArtistLatest || a.Mode == model.ArtistSince {
+		albums = selectReleases(albums, a)
+	}
+	for _, album := range albums {
+		selected[album.ID] = true
+	}
+	return selected, nil
 }
 
 func singleAlbumTrackToResponse(tracks []spotify.SimpleTrack, playlist *model.Playlist, album spotify.ID) []model.ItemResponse {
@@ -463,46 +601,50 @@ func mapToSlice(m map[spotify.ID]bool) []spotify.ID {
     return slice
 }
 
-func SearchArtist(req model.SearchRequest) []model.ItemResponse {
-	conn := src.GetSpotifyConn()
-	ctx, client := conn.Ctx, conn.Client
+func SearchArtist(conn *src.SpotifyConn, req model.SearchRequest) ([]model.ItemResponse, error) {
+	ctx, cat := conn.Ctx, conn.Catalog
 
-	playlist, err := getPlaylist(req.PlaylistID)
-	results, err := client.Search(ctx, req.Query, spotify.SearchTypeArtist, spotify.Limit(5))
-
-	// handle album results
+	playlist, err := getPlaylist(conn, req.PlaylistID)
 	if err != nil {
-		log.Fatal("help")
+		return nil, err
 	}
-	return artistToResponse(results.Artists.Artists, playlist)
+	results, err := cat.SearchArtists(ctx, req.Query, 5)
+	if err != nil {
+		return nil, err
+	}
+	return artistToResponse(results, playlist), nil
 }
 
-func SearchAlbum(req model.SearchRequest) []model.ItemResponse {
-	conn := src.GetSpotifyConn()
-	ctx, client := conn.Ctx, conn.Client
-
-	playlist, err := getPlaylist(req.PlaylistID)
-	results, err := client.Search(ctx, req.Query, spotify.SearchTypeAlbum, spotify.Limit(5))
+func SearchAlbum(conn *src.SpotifyConn, req model.SearchRequest) ([]model.ItemResponse, error) {
+	ctx, cat := conn.Ctx, conn.Catalog
 
-	// handle album results
+	playlist, err := getPlaylist(conn, req.PlaylistID)
 	if err != nil {
-		log.Fatal("help")
+		return nil, err
 	}
-	return albumToResponse(results.Albums.Albums, playlist)
+	results, err := cat.SearchAlbums(ctx, req.Query, 5)
+	if err != nil {
+		return nil, err
+	}
+	modes, err := artistInclusions(playlist.SpotifyID)
+	if err != nil {
+		return nil, err
+	}
+	return albumToResponse(conn, results, playlist, "", modes)
 }
 
-func SearchTrack(req model.SearchRequest) []model.ItemResponse {
-	conn := src.GetSpotifyConn()
-	ctx, client := conn.Ctx, conn.Client
+func SearchTrack(conn *src.SpotifyConn, req model.SearchRequest) ([]model.ItemResponse, error) {
+	ctx, cat := conn.Ctx, conn.Catalog
 
-	playlist, err := getPlaylist(req.PlaylistID)
-	results, err := client.Search(ctx, req.Query, spotify.SearchTypeTrack, spotify.Limit(5))
-
-	// handle album results
+	playlist, err := getPlaylist(conn, req.PlaylistID)
+	if err != nil {
+		return nil, err
+	}
+	results, err := cat.SearchTracks(ctx, req.Query, 5)
 	if err != nil {
-		log.Fatal("help")
+		return nil, err
 	}
-	return trackToResponse(fullToSimpleTrack(results.Tracks.Tracks), playlist)
+	return trackToResponse(fullToSimpleTrack(results), playlist), nil
 }
 
 func fullToSimpleTrack(tracks []spotify.FullTrack) []spotify.SimpleTrack {
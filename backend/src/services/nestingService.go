@@ -0,0 +1,109 @@
+package services
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/utils"
+	"github.com/zmb3/spotify/v2"
+)
+
+const defaultMaxNestingDepth = 8
+
+// MaxNestingDepth is how many levels of playlists may hang below a
+// playlist through nesting, nested exclusions and expressions, set with
+// PLAYLIST_MAX_NESTING_DEPTH.
+func MaxNestingDepth() int {
+	if n, err := strconv.Atoi(os.Getenv("PLAYLIST_MAX_NESTING_DEPTH")); err == nil && n > 0 {
+		return n
+	}
+	return defaultMaxNestingDepth
+}
+
+// checkNesting tells whether parent may depend on child: refused when child
+// already depends on parent, which would make a loop, or when the longest
+// chain through the two would nest deeper than MaxNestingDepth.
+func checkNesting(parent *model.Playlist, child *model.Playlist) error {
+	if path := dependencyPath(child.SpotifyID, parent.SpotifyID); path != nil {
+		return errs.Invalid("%q can't depend on %q, which depends on it: %s", parent.Name, child.Name, loopPath(append([]spotify.ID{parent.SpotifyID}, path...)))
+	}
+
+	above := nestingHeight(parent.SpotifyID, GetPlaylistParents, map[spotify.ID]bool{})
+	below := nestingHeight(child.SpotifyID, playlistDependencies, map[spotify.ID]bool{})
+	if depth := above + 1 + below; depth > MaxNestingDepth() {
+		return errs.Invalid("%q in %q would nest playlists %d levels deep, more than the limit of %d", child.Name, parent.Name, depth, MaxNestingDepth())
+	}
+	return nil
+}
+
+// playlistDependencies returns the playlists p gets tracks from or drops
+// tracks of.
+func playlistDependencies(p *model.Playlist) []model.Playlist {
+	return slices.Concat(GetIncludedPlaylistsFromPlaylist(p), GetExcludedPlaylistsFromPlaylist(p), GetOperandPlaylistsFromPlaylist(p))
+}
+
+// nestingHeight returns the length of the longest chain of playlists next
+// leads to from id. Loops saved before they were refused are cut short.
+func nestingHeight(id spotify.ID, next func(*model.Playlist) []model.Playlist, visiting map[spotify.ID]bool) int {
+	if visiting[id] {
+		return 0
+	}
+	visiting[id] = true
+	defer delete(visiting, id)
+
+	height := 0
+	for _, p := range next(&model.Playlist{SpotifyID: id}) {
+		height = max(height, 1+nestingHeight(p.SpotifyID, next, visiting))
+	}
+	return height
+}
+
+// dependencyPath returns the playlists leading from one playlist to
+// another through nesting, nested exclusions and expressions, from first
+// to last, or nil if from doesn't depend on to.
+func dependencyPath(from spotify.ID, to spotify.ID) []spotify.ID {
+	previous := map[spotify.ID]spotify.ID{from: ""}
+	queue := []spotify.ID{from}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == to {
+			path := []spotify.ID{}
+			for id := current; id != ""; id = previous[id] {
+				path = append(path, id)
+			}
+			slices.Reverse(path)
+			return path
+		}
+
+		for _, d := range playlistDependencies(&model.Playlist{SpotifyID: current}) {
+			if _, seen := previous[d.SpotifyID]; !seen {
+				previous[d.SpotifyID] = current
+				queue = append(queue, d.SpotifyID)
+			}
+		}
+	}
+	return nil
+}
+
+// loopPath writes a chain of playlists by name, like "Mix → Workout → Mix".
+func loopPath(ids []spotify.ID) string {
+	var playlists []model.Playlist
+	_ = src.GetDbConn().Db.Where("spotify_id IN ?", ids).Find(&playlists).Error
+
+	names := map[spotify.ID]string{}
+	for _, p := range playlists {
+		names[p.SpotifyID] = p.Name
+	}
+	return strings.Join(utils.Map(ids, func(id spotify.ID) string {
+		if name, ok := names[id]; ok {
+			return name
+		}
+		return string(id)
+	}), " → ")
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/ordering"
+	"github.com/aarhunt/spootify/src/resolver"
+	"github.com/aarhunt/spootify/src/utils"
+	"github.com/zmb3/spotify/v2"
+	"gorm.io/gorm"
+)
+
+// SetPlaylistOrder changes how the tracks of a playlist are ordered on
+// publish. A shuffle without a seed gets a random one, so it keeps its order
+// until it is set again.
+func SetPlaylistOrder(conn *src.SpotifyConn, id spotify.ID, req model.PlaylistOrderRequest) (*model.PlaylistResponse, error) {
+	dbConn := src.GetDbConn()
+	ctx, db := dbConn.Ctx, dbConn.Db
+
+	if !slices.Contains(model.TrackOrders, req.Order) {
+		return nil, errs.Invalid("unknown track order %q", req.Order)
+	}
+	playlist, err := getPlaylist(conn, id)
+	if err != nil {
+		return nil, err
+	}
+
+	playlist.TrackOrder, playlist.ShuffleSeed = req.Order, 0
+	if req.Order == model.OrderShuffle {
+		playlist.ShuffleSeed = rand.Int64()
+		if req.Seed != nil {
+			playlist.ShuffleSeed = *req.Seed
+		}
+	}
+
+	_, err = gorm.G[model.Playlist](db).
+		Where("spotify_id = ? AND owner_id = ?", id, conn.UserID).
+		Select("TrackOrder", "ShuffleSeed").
+		Updates(ctx, *playlist)
+	return playlist.ToResponse(), err
+}
+
+func isResolvedOrder(order model.TrackOrder) bool {
+	return order == "" || order == model.OrderResolved
+}
+
+// orderDecisions puts the decisions for the tracks of p, given in resolved
+// order, in the track order of p, using the details fetched for them.
+func orderDecisions(p model.Playlist, decisions []resolver.Decision, details map[spotify.ID]*spotify.FullTrack) ([]resolver.Decision, error) {
+	if isResolvedOrder(p.TrackOrder) {
+		return decisions, nil
+	}
+
+	var err error
+	var added map[inclusionKey]time.Time
+	if p.TrackOrder == model.OrderDateAdded {
+		playlists := utils.Map(decisions, func(d resolver.Decision) spotify.ID { return d.Winner.Playlist })
+		if added, err = inclusionTimes(slices.Compact(slices.Sorted(slices.Values(playlists)))); err != nil {
+			return nil, err
+		}
+	}
+
+	tracks := make([]ordering.Track, len(decisions))
+	byTrack := map[spotify.ID]resolver.Decision{}
+	for i, d := range decisions {
+		tracks[i] = ordering.Track{ID: d.Track}
+		if t, ok := details[d.Track]; ok {
+			tracks[i] = ordering.FromSpotify(t)
+		}
+		tracks[i].Added = added[inclusionKey{d.Winner.Playlist, d.Winner.Rule.ItemID}]
+		byTrack[d.Track] = d
+	}
+
+	ordering.Sort(tracks, p.TrackOrder, p.ShuffleSeed)
+	return utils.Map(tracks, func(t ordering.Track) resolver.Decision { return byTrack[t.ID] }), nil
+}
+
+type inclusionKey struct {
+	playlist spotify.ID
+	item     spotify.ID
+}
+
+// inclusionTimes returns when each inclusion of the playlists was added.
+func inclusionTimes(playlists []spotify.ID) (map[inclusionKey]time.Time, error) {
+	var inclusions []model.PlaylistInclusion
+	err := src.GetDbConn().Db.Where("playlist_spotify_id IN ?", playlists).Find(&inclusions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	times := map[inclusionKey]time.Time{}
+	for _, in := range inclusions {
+		times[inclusionKey{in.PlaylistSpotifyID, in.IdItemSpotifyID}] = in.CreatedAt
+	}
+	return times, nil
+}
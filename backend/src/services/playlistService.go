@@ -1,13 +1,13 @@
 package services
 
 import (
-	"fmt"
-	"log"
+	"errors"
 	"regexp"
 	"slices"
 	"strings"
 
 	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/errs"
 	"github.com/aarhunt/spootify/src/model"
 	"github.com/aarhunt/spootify/src/utils"
 	"github.com/zmb3/spotify/v2"
@@ -15,17 +15,23 @@ import (
 	"gorm.io/gorm/clause"
 )
 
-func GetPlaylists() ([]model.PlaylistResponse, error) {
+func GetPlaylists(conn *src.SpotifyConn) ([]model.PlaylistResponse, error) {
 	var playlists []model.Playlist
 	db := src.GetDbConn().Db
 
-	err := db.Find(&playlists)
+	err := db.Where("owner_id = ?", conn.UserID).Find(&playlists)
 	return utils.Map(playlists, func (p model.Playlist) model.PlaylistResponse { return  *p.ToResponse() }), err.Error
 }
 
-func SearchPlaylist(req model.SearchRequest) []model.ItemResponse {
-	playlist, _ := getPlaylist(req.PlaylistID)
-	playlists, _ := GetPlaylists()
+func SearchPlaylist(conn *src.SpotifyConn, req model.SearchRequest) ([]model.ItemResponse, error) {
+	playlist, err := getPlaylist(conn, req.PlaylistID)
+	if err != nil {
+		return nil, err
+	}
+	playlists, err := GetPlaylists(conn)
+	if err != nil {
+		return nil, err
+	}
 	ids := getPlaylistsRecursive(*playlist, make(map[spotify.ID]bool));
 
 	playlists = slices.DeleteFunc(playlists, func(p model.PlaylistResponse) bool {
@@ -47,69 +53,119 @@ func SearchPlaylist(req model.SearchRequest) []model.ItemResponse {
 			ItemType:  model.PlaylistItem,
 			Included:  included,
 		}
-	})
+	}), nil
 }
 
-func getPlaylist(id spotify.ID) (*model.Playlist, error) {
+// getPlaylist looks up a playlist owned by the connected user.
+func getPlaylist(conn *src.SpotifyConn, id spotify.ID) (*model.Playlist, error) {
 	dbConn := src.GetDbConn()
 	ctx, db := dbConn.Ctx, dbConn.Db
-	playlist, err := gorm.G[model.Playlist](db).Where("spotify_id = ?", id).First(ctx)
+	playlist, err := gorm.G[model.Playlist](db).Where("spotify_id = ? AND owner_id = ?", id, conn.UserID).First(ctx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errs.NotFound("playlist %s", id)
+	}
 
 	return &playlist, err
 }
 
-func DeletePlaylist(id spotify.ID) *gorm.DB {
-	dbConn := src.GetDbConn()
-	ctx, db := dbConn.Ctx, dbConn.Db
-	client := src.GetSpotifyConn().Client
+func DeletePlaylist(conn *src.SpotifyConn, id spotify.ID) (int64, error) {
+	db := src.GetDbConn().Db
+
+   	playlist, err := getPlaylist(conn, id)
+	if err != nil {
+		return 0, err
+	}
 
-	client.UnfollowPlaylist(ctx, id)
+	// A playlist already removed on Spotify can still be deleted locally
+	err = conn.Catalog.UnfollowPlaylist(conn.Ctx, id)
+	if err != nil && !errors.Is(err, errs.ErrNotFound) {
+		return 0, err
+	}
 
-   	playlist, _ := getPlaylist(id)
+	result := db.Select(clause.Associations).Delete(playlist)
+	if result.Error != nil {
+		return 0, result.Error
+	}
 
-    return db.Select(clause.Associations).Delete(&playlist)
+	if err := db.Where("playlist_spotify_id = ?", id).Delete(&model.Schedule{}).Error; err != nil {
+		return 0, err
+	}
+	unregister(id)
+    return result.RowsAffected, nil
 }
 
-func RenamePlaylist(id spotify.ID, name string) (int, error) {
+func RenamePlaylist(conn *src.SpotifyConn, id spotify.ID, name string) (int, error) {
 	dbConn := src.GetDbConn()
 	ctx, db := dbConn.Ctx, dbConn.Db
 
-	client := src.GetSpotifyConn().Client
+	if _, err := getPlaylist(conn, id); err != nil {
+		return 0, err
+	}
 
-	client.ChangePlaylistName(ctx, id, name)
+	if err := conn.Catalog.RenamePlaylist(conn.Ctx, id, name); err != nil {
+		return 0, err
+	}
 
-	return gorm.G[model.Playlist](db).Where("spotify_id = ?", id).Update(ctx, "name", name)
+	return gorm.G[model.Playlist](db).Where("spotify_id = ? AND owner_id = ?", id, conn.UserID).Update(ctx, "name", name)
 }
 
-func PostPlaylist(req model.PlaylistCreateRequest) (*model.PlaylistResponse, error) {
-	spotiConn := src.GetSpotifyConn()
-	ctx, client, user := spotiConn.Ctx, spotiConn.Client, spotiConn.UserID
+func PostPlaylist(conn *src.SpotifyConn, req model.PlaylistCreateRequest) (*model.PlaylistResponse, error) {
+	ctx, cat, user := conn.Ctx, conn.Catalog, conn.UserID
 	db := src.GetDbConn().Db
 
-	spotPlaylist, err := client.CreatePlaylistForUser(ctx, user, req.Name, "", false, false)
+	duplicates := req.Duplicates
+	if duplicates == "" {
+		duplicates = model.KeepAllVersions
+	}
+	if !slices.Contains(model.DuplicatePolicies, duplicates) {
+		return nil, errs.Invalid("unknown duplicate policy %q", duplicates)
+	}
 
+	spotPlaylistID, err := cat.CreatePlaylist(ctx, user, req.Name)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	localPlaylist := model.Playlist{
-		SpotifyID:		   spotPlaylist.ID,
+		SpotifyID:		   spotPlaylistID,
 		Name:              req.Name,
+		OwnerID:           user,
 		Inclusions:        []model.IdItem{},
 		IncludedPlaylists: []*model.Playlist{},
 		Exclusions:        []model.IdItem{},
+		TrackOrder:        model.OrderResolved,
+		Duplicates:        duplicates,
 	}
 
 	err = gorm.G[model.Playlist](db).Create(ctx, &localPlaylist)
+	if err != nil {
+		return nil, err
+	}
 
-	return localPlaylist.ToResponse(), err
+	return localPlaylist.ToResponse(), attachBuiltinRuleSets(db, &localPlaylist)
 }
 
-func ClearPlaylists() (int, error) {
+func ClearPlaylists(conn *src.SpotifyConn) (int, error) {
 	dbConn := src.GetDbConn()
 	ctx, db := dbConn.Ctx, dbConn.Db
 
-	return gorm.G[model.Playlist](db).Where("true").Delete(ctx)
+	var ids []spotify.ID
+	if err := db.Model(&model.Playlist{}).Where("owner_id = ?", conn.UserID).Pluck("spotify_id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	deleted, err := gorm.G[model.Playlist](db).Where("owner_id = ?", conn.UserID).Delete(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := db.Where("playlist_spotify_id IN ?", ids).Delete(&model.Schedule{}).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		unregister(id)
+	}
+	return deleted, nil
 }
 
 func GetIncludedIDsFromPlaylist(p *model.Playlist, ids []spotify.ID) ([]spotify.ID) {
@@ -165,27 +221,42 @@ func GetInclusionMap(playlistID spotify.ID, ids []spotify.ID) map[spotify.ID]boo
 	return m
 }
 
-func GetAllInclusions(id spotify.ID) []model.ItemResponse {
+func GetAllInclusions(conn *src.SpotifyConn, id spotify.ID) ([]model.ItemResponse, error) {
     var items []model.IdItem
-	var playlists = SearchPlaylist(model.SearchRequest{Query: "", PlaylistID: id, ItemType: model.PlaylistItem})
+	playlists, err := SearchPlaylist(conn, model.SearchRequest{Query: "", PlaylistID: id, ItemType: model.PlaylistItem})
+	if err != nil {
+		return nil, err
+	}
 
 	playlists = slices.DeleteFunc(playlists, func(req model.ItemResponse) bool {return !(req.Included == model.Included || req.Included == model.IncludedByProxy)})
 
 
-    err := src.GetDbConn().Db.
+    err = src.GetDbConn().Db.
         Table("id_items").
         Joins("JOIN playlist_inclusions ON playlist_inclusions.id_item_spotify_id = id_items.spotify_id").
         Where("playlist_inclusions.playlist_spotify_id = ?", id).
         Find(&items).Error
-
     if err != nil {
-        fmt.Printf("Error fetching inclusions: %v\n", err)
-        return []model.ItemResponse{}
+        return nil, err
     }
 
-	itemResponses := IncludedItemsToResponse(items, model.Included)
+	itemResponses, err := IncludedItemsToResponse(conn, items, model.Included)
+	if err != nil {
+		return nil, err
+	}
+
+	modes, err := artistInclusions(id)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range itemResponses {
+		if mode, ok := modes[item.SpotifyID]; ok && item.ItemType == model.Artist && (mode.Mode != model.ArtistAll || len(mode.ReleaseTypes) > 0) {
+			itemResponses[i].Artist = &mode
+			itemResponses[i].Badge = mode.Badge()
+		}
+	}
 
-    return append(playlists, itemResponses...)
+    return append(playlists, itemResponses...), nil
 }
 
 func GetExclusionMap(playlistID spotify.ID, ids []spotify.ID) map[spotify.ID]bool {
@@ -200,25 +271,26 @@ func GetExclusionMap(playlistID spotify.ID, ids []spotify.ID) map[spotify.ID]boo
 	return m
 }
 
-func GetAllExclusions(id spotify.ID) []model.ItemResponse {
+func GetAllExclusions(conn *src.SpotifyConn, id spotify.ID) ([]model.ItemResponse, error) {
     var items []model.IdItem
+	if _, err := getPlaylist(conn, id); err != nil {
+		return nil, err
+	}
 
     err := src.GetDbConn().Db.
         Table("id_items").
         Joins("JOIN playlist_exclusions ON playlist_exclusions.id_item_spotify_id = id_items.spotify_id").
         Where("playlist_exclusions.playlist_spotify_id = ?", id).
         Find(&items).Error
-
     if err != nil {
-        fmt.Printf("Error fetching exclusions: %v\n", err)
-        return []model.ItemResponse{}
+        return nil, err
     }
 
-	itemResponses := IncludedItemsToResponse(items, model.Excluded)
-
-    return itemResponses
+	return IncludedItemsToResponse(conn, items, model.Excluded)
 }
 
+// GetPlaylistParents returns the playlists including, excluding or defined
+// by an expression over p, whose tracks change along with it.
 func GetPlaylistParents(p *model.Playlist) ([]model.Playlist) {
 	var includedParents = []model.Playlist{}
 
@@ -228,7 +300,23 @@ func GetPlaylistParents(p *model.Playlist) ([]model.Playlist) {
         Where("playlist_nested_playlists.included_playlist_spotify_id = ?", p.SpotifyID).
         Find(&includedParents).Error
 
-	return includedParents
+	var excludingParents = []model.Playlist{}
+
+    _ = src.GetDbConn().Db.
+        Table("playlists").
+        Joins("JOIN playlist_nested_exclusions ON playlist_nested_exclusions.playlist_spotify_id = playlists.spotify_id").
+        Where("playlist_nested_exclusions.excluded_playlist_spotify_id = ?", p.SpotifyID).
+        Find(&excludingParents).Error
+
+	var definedParents = []model.Playlist{}
+
+    _ = src.GetDbConn().Db.
+        Table("playlists").
+        Joins("JOIN playlist_expression_operands ON playlist_expression_operands.playlist_spotify_id = playlists.spotify_id").
+        Where("playlist_expression_operands.operand_spotify_id = ?", p.SpotifyID).
+        Find(&definedParents).Error
+
+	return slices.Concat(includedParents, excludingParents, definedParents)
 }
 
 func getParentsRecursive(p model.Playlist, visited map[spotify.ID]bool) map[spotify.ID]bool {
@@ -262,6 +350,18 @@ func GetIncludedPlaylistsFromPlaylist(p *model.Playlist) ([]model.Playlist) {
 	return includedPlaylists
 }
 
+func GetExcludedPlaylistsFromPlaylist(p *model.Playlist) ([]model.Playlist) {
+	var excludedPlaylists = []model.Playlist{}
+
+    _ = src.GetDbConn().Db.
+        Table("playlists").
+        Joins("JOIN playlist_nested_exclusions ON playlist_nested_exclusions.excluded_playlist_spotify_id = playlists.spotify_id").
+        Where("playlist_nested_exclusions.playlist_spotify_id = ?", p.SpotifyID).
+        Find(&excludedPlaylists).Error
+
+	return excludedPlaylists
+}
+
 func getPlaylistsRecursive(p model.Playlist, visited map[spotify.ID]bool) map[spotify.ID]int {
     if visited[p.SpotifyID] {
         return nil
@@ -287,124 +387,39 @@ func getPlaylistsRecursive(p model.Playlist, visited map[spotify.ID]bool) map[sp
 	return includedPlaylists
 }
 
-func getTracksFromPlaylist(p model.Playlist) []spotify.ID {
-	inclusions, exclusions := getTracksRecursive(p, make(map[spotify.ID]bool))
-
-    finalTracks := []spotify.ID{}
-    for id, inc := range inclusions {
-		exc := exclusions[id]
-		if model.IsIncluded(inc, exc) {finalTracks = append(finalTracks, id)}
-    }
-
-	return finalTracks
-}
-
-func getTracksRecursive(p model.Playlist, visited map[spotify.ID]bool) (map[spotify.ID]int, map[spotify.ID]int) {
-    if visited[p.SpotifyID] {
-        return nil, nil
-    }
-    visited[p.SpotifyID] = true
-
-    excludedMap := make(map[spotify.ID]int)
-	includedMap := make(map[spotify.ID]int)
-
-	for _, nested := range GetIncludedPlaylistsFromPlaylist(&p) {
-		nestedInclusions, nestedExclusions := getTracksRecursive(nested, visited)
-		for id, val := range nestedInclusions {
-			if val != 0 {
-				includedMap[id]	= val + 3
-			} else {
-				includedMap[id] = val
-			}
-		}
-		for id, val := range nestedExclusions {
-			if val != 0 {
-				excludedMap[id]	= val + 3
-			} else {
-				excludedMap[id] = val
-			}
-		}
-	}
-
-	inclusions, exclusions := GetAllInclusions(p.SpotifyID), GetAllExclusions(p.SpotifyID)
-
-    for _, v := range exclusions {
-        switch v.ItemType {
-        case model.Artist:
-            for _, t := range getTracksFromArtistById(v.SpotifyID) {
-				if excludedMap[t.ID] == 0 {
-					excludedMap[t.ID] = -3 
-				}
-            }
-        case model.Album:
-            for _, t := range getTracksFromAlbumById(v.SpotifyID) {
-				if excludedMap[t.ID] == 0 || excludedMap[t.ID] == -3 {
-					excludedMap[t.ID] = -2
-				}
-            }
-        case model.Track:
-            excludedMap[v.SpotifyID] = -1
-		}
-    }
-
-    for _, v := range inclusions {
-        switch v.ItemType {
-        case model.Artist:
-            for _, t := range getTracksFromArtistById(v.SpotifyID) {
-				if includedMap[t.ID] == 0 {
-					includedMap[t.ID] = 3 
-				}
-            }
-        case model.Album:
-            for _, t := range getTracksFromAlbumById(v.SpotifyID) {
-				if includedMap[t.ID] == 0 || excludedMap[t.ID] == 3 {
-					includedMap[t.ID] = 2
-				}
-            }
-        case model.Track:
-            includedMap[v.SpotifyID] = 1
-		}
-    }
-
-    return includedMap, excludedMap
-}
-
-func PublishPlaylist(req model.PlaylistPublishRequest) error {
-    spotiConn := src.GetSpotifyConn()
-    ctx, client := spotiConn.Ctx, spotiConn.Client
-
-    playlist, err := getPlaylist(req.SpotifyID)
+func PublishPlaylist(conn *src.SpotifyConn, req model.PlaylistPublishRequest) error {
+    playlist, err := getPlaylist(conn, req.SpotifyID)
     if err != nil {
         return err
     }
 
-	affected := getParentsRecursive(*playlist, make(map[spotify.ID]bool))
-	affectedPlaylists := []*model.Playlist{playlist}
-	for id := range affected {
-		parent, err := getPlaylist(id)
-		if err != nil {
-			return err
-		}
-		affectedPlaylists = append(affectedPlaylists, parent)
+	trackIDs, err := getTracksFromPlaylist(conn, *playlist)
+	if err != nil {
+		return err
 	}
+	return publishTracks(conn, playlist, trackIDs)
+}
 
-	for _, p := range affectedPlaylists {
-
-		trackIDs := getTracksFromPlaylist(*p)
-
-		chunks := slices.Chunk(trackIDs, 100)
+// publishTracks publishes trackIDs, the tracks p resolves to, and then the
+// playlists depending on p.
+func publishTracks(conn *src.SpotifyConn, p *model.Playlist, trackIDs []spotify.ID) error {
+	affectedPlaylists, err := publishTargets(conn, p)
+	if err != nil {
+		return err
+	}
+	if err := syncPlaylist(conn, p.SpotifyID, trackIDs); err != nil {
+		return err
+	}
 
-		err = client.ReplacePlaylistTracks(ctx, p.SpotifyID)
+	for _, parent := range affectedPlaylists[1:] {
+		trackIDs, err := getTracksFromPlaylist(conn, *parent)
 		if err != nil {
 			return err
 		}
 
-		for chunk := range chunks {
-			_, err := client.AddTracksToPlaylist(ctx, p.SpotifyID, chunk...)
-			if err != nil {
-				return err
-			}
+		if err := syncPlaylist(conn, parent.SpotifyID, trackIDs); err != nil {
+			return err
 		}
 	}
-    return nil
+	return nil
 }
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/catalog"
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/playlistdiff"
+	"github.com/aarhunt/spootify/src/utils"
+	"github.com/zmb3/spotify/v2"
+)
+
+// syncAttempts is how often a publish starts over when the playlist is
+// edited on Spotify while it runs.
+const syncAttempts = 3
+
+// Spotify takes at most 100 items per playlist edit.
+const editChunk = 100
+
+// Spotify playlists hold at most 10000 items.
+const maxPlaylistTracks = 10000
+
+func trackURI(id spotify.ID) spotify.URI {
+	return spotify.URI("spotify:track:" + id)
+}
+
+func uriTrack(uri spotify.URI) spotify.ID {
+	return spotify.ID(strings.TrimPrefix(string(uri), "spotify:track:"))
+}
+
+// publishTargets returns p and the playlists depending on it, whose tracks
+// a publish of p updates too.
+func publishTargets(conn *src.SpotifyConn, p *model.Playlist) ([]*model.Playlist, error) {
+	// The parents found include p itself
+	parents := getParentsRecursive(*p, make(map[spotify.ID]bool))
+	delete(parents, p.SpotifyID)
+
+	targets := []*model.Playlist{p}
+	for _, id := range slices.Sorted(maps.Keys(parents)) {
+		parent, err := getPlaylist(conn, id)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, parent)
+	}
+	return targets, nil
+}
+
+// PlanPublish reports what publishing a playlist would change on it and on
+// the playlists depending on it, without touching Spotify.
+func PlanPublish(conn *src.SpotifyConn, req model.PlaylistPublishRequest) (*model.PublishReport, error) {
+	playlist, err := getPlaylist(conn, req.SpotifyID)
+	if err != nil {
+		return nil, err
+	}
+	targets, err := publishTargets(conn, playlist)
+	if err != nil {
+		return nil, err
+	}
+	return planPublishes(conn, targets)
+}
+
+// PlanPublishAll reports what publishing every playlist of the user would
+// change, without touching Spotify.
+func PlanPublishAll(conn *src.SpotifyConn) (*model.PublishReport, error) {
+	var playlists []*model.Playlist
+	err := src.GetDbConn().Db.Where("owner_id = ?", conn.UserID).Order("name").Find(&playlists).Error
+	if err != nil {
+		return nil, err
+	}
+	return planPublishes(conn, playlists)
+}
+
+func planPublishes(conn *src.SpotifyConn, playlists []*model.Playlist) (*model.PublishReport, error) {
+	report := &model.PublishReport{Playlists: []model.PlaylistChanges{}}
+	for _, p := range playlists {
+		changes, err := planPublish(conn, p)
+		if err != nil {
+			return nil, err
+		}
+		report.Playlists = append(report.Playlists, *changes)
+	}
+	return report, nil
+}
+
+// planPublish resolves p and lays out the edits syncPlaylist would make,
+// warning about an empty or oversized result, items that were taken down
+// and tracks Spotify no longer returns. Whether a track is playable is
+// left out: Spotify only tells for a market, which track lookups don't
+// pass.
+func planPublish(conn *src.SpotifyConn, p *model.Playlist) (*model.PlaylistChanges, error) {
+	trackIDs, err := getTracksFromPlaylist(conn, *p)
+	if err != nil {
+		return nil, err
+	}
+	items, plan, err := planSync(conn, p.SpotifyID, trackIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	added := utils.Map(plan.Add, uriTrack)
+	removed := utils.Map(plan.Remove, func(pos int) spotify.ID { return uriTrack(items.URIs[pos]) })
+	tracks, err := getTracks(conn, slices.Concat(trackIDs, removed))
+	if err != nil {
+		return nil, err
+	}
+	details := map[spotify.ID]*spotify.FullTrack{}
+	for _, t := range tracks {
+		if t != nil {
+			details[t.ID] = t
+		}
+	}
+	reportTrack := func(id spotify.ID) model.ReportTrack {
+		if t, ok := details[id]; ok {
+			return model.ReportTrack{SpotifyID: id, Name: t.Name}
+		}
+		return model.ReportTrack{SpotifyID: id}
+	}
+
+	// Taken down items stay in the playlist, so they count against its size
+	takenDown := 0
+	for _, uri := range items.URIs {
+		if uri == "" {
+			takenDown++
+		}
+	}
+
+	changes := &model.PlaylistChanges{
+		SpotifyID:  p.SpotifyID,
+		Name:       p.Name,
+		Add:        utils.Map(added, reportTrack),
+		Remove:     utils.Map(removed, reportTrack),
+		Moved:      len(plan.Moves),
+		TrackCount: len(trackIDs) + takenDown,
+		Warnings:   []string{},
+	}
+	if changes.TrackCount == 0 {
+		changes.Warnings = append(changes.Warnings, "the playlist would be empty")
+	}
+	if changes.TrackCount > maxPlaylistTracks {
+		changes.Warnings = append(changes.Warnings, fmt.Sprintf("%d tracks is more than the %d Spotify allows in a playlist", changes.TrackCount, maxPlaylistTracks))
+	}
+	if takenDown > 0 {
+		changes.Warnings = append(changes.Warnings, fmt.Sprintf("%d items of the playlist were taken down on Spotify and are left in place", takenDown))
+	}
+	unavailable := slices.DeleteFunc(slices.Clone(trackIDs), func(id spotify.ID) bool {
+		_, ok := details[id]
+		return ok
+	})
+	if len(unavailable) > 0 {
+		names := utils.Map(unavailable, func(id spotify.ID) string { return string(id) })
+		changes.Warnings = append(changes.Warnings, "tracks unavailable on Spotify: "+strings.Join(names, ", "))
+	}
+	return changes, nil
+}
+
+// syncPlaylist makes the Spotify playlist id hold trackIDs, in order, by
+// applying only the difference to its current contents.
+func syncPlaylist(conn *src.SpotifyConn, id spotify.ID, trackIDs []spotify.ID) error {
+	var err error
+	for range syncAttempts {
+		err = applySync(conn, id, trackIDs)
+		if !errors.Is(err, errs.ErrConflict) {
+			return err
+		}
+		log.Printf("playlist %s was edited during publish, starting over: %v", id, err)
+	}
+	return err
+}
+
+// planSync reads the current contents of the Spotify playlist and plans
+// the edits turning them into trackIDs.
+func planSync(conn *src.SpotifyConn, id spotify.ID, trackIDs []spotify.ID) (*catalog.PlaylistItems, playlistdiff.Plan[spotify.URI], error) {
+	items, err := conn.Catalog.GetPlaylistItems(conn.Ctx, id)
+	if err != nil {
+		return nil, playlistdiff.Plan[spotify.URI]{}, err
+	}
+
+	want := make([]spotify.URI, len(trackIDs))
+	for i, t := range trackIDs {
+		want[i] = trackURI(t)
+	}
+
+	// Items whose track was taken down can't be removed by URI, the plan is
+	// made for the other items and leaves those where they are
+	current := slices.DeleteFunc(slices.Clone(items.URIs), func(uri spotify.URI) bool { return uri == "" })
+	plan := playlistdiff.Compute(current, want)
+	if len(current) < len(items.URIs) {
+		plan = aroundTakenDown(items.URIs, plan)
+	}
+	return items, plan, nil
+}
+
+// aroundTakenDown turns the positions of plan, made for the items of uris
+// that have a track, into positions among all of uris.
+func aroundTakenDown(uris []spotify.URI, plan playlistdiff.Plan[spotify.URI]) playlistdiff.Plan[spotify.URI] {
+	// Whether each item has a track, kept up to date as the plan is applied
+	tracks := utils.Map(uris, func(uri spotify.URI) bool { return uri != "" })
+	position := func(i int) int {
+		for pos, ok := range tracks {
+			if ok && i == 0 {
+				return pos
+			}
+			if ok {
+				i--
+			}
+		}
+		return len(tracks)
+	}
+
+	remove := utils.Map(plan.Remove, position)
+	for _, pos := range slices.Backward(remove) {
+		tracks = slices.Delete(tracks, pos, pos+1)
+	}
+	for range plan.Add {
+		tracks = append(tracks, true)
+	}
+
+	moves := make([]playlistdiff.Move, len(plan.Moves))
+	for i, m := range plan.Moves {
+		from, before := position(m.From), position(m.InsertBefore)
+		moves[i] = playlistdiff.Move{From: from, InsertBefore: before}
+		tracks = slices.Delete(tracks, from, from+1)
+		if before > from {
+			before--
+		}
+		tracks = slices.Insert(tracks, before, true)
+	}
+	return playlistdiff.Plan[spotify.URI]{Remove: remove, Add: plan.Add, Moves: moves}
+}
+
+func applySync(conn *src.SpotifyConn, id spotify.ID, trackIDs []spotify.ID) error {
+	ctx, cat := conn.Ctx, conn.Catalog
+
+	items, plan, err := planSync(conn, id, trackIDs)
+	if err != nil {
+		return err
+	}
+	snapshotID := items.SnapshotID
+
+	// Remove from the end, so the positions left to remove don't shift
+	remove := slices.Clone(plan.Remove)
+	slices.Reverse(remove)
+	for chunk := range slices.Chunk(remove, editChunk) {
+		toRemove := make([]spotify.TrackToRemove, len(chunk))
+		for i, pos := range chunk {
+			toRemove[i] = spotify.TrackToRemove{URI: string(items.URIs[pos]), Positions: []int{pos}}
+		}
+		if snapshotID, err = cat.RemovePlaylistItems(ctx, id, snapshotID, toRemove...); err != nil {
+			return err
+		}
+	}
+
+	ids := map[spotify.URI]spotify.ID{}
+	for _, t := range trackIDs {
+		ids[trackURI(t)] = t
+	}
+	for chunk := range slices.Chunk(plan.Add, editChunk) {
+		add := make([]spotify.ID, len(chunk))
+		for i, uri := range chunk {
+			add[i] = ids[uri]
+		}
+		if snapshotID, err = cat.AddTracksToPlaylist(ctx, id, add...); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range plan.Moves {
+		snapshotID, err = cat.ReorderPlaylistItems(ctx, id, spotify.PlaylistReorderOptions{
+			RangeStart:   spotify.Numeric(m.From),
+			InsertBefore: spotify.Numeric(m.InsertBefore),
+			SnapshotID:   snapshotID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,458 @@
+package services
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/fanout"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/resolver"
+	"github.com/aarhunt/spootify/src/utils"
+	"github.com/zmb3/spotify/v2"
+)
+
+var ruleKinds = map[model.ItemType]resolver.Kind{
+	model.Artist: resolver.Artist,
+	model.Album:  resolver.Album,
+	model.Track:  resolver.Track,
+}
+
+var itemTypes = map[resolver.Kind]model.ItemType{
+	resolver.Playlist: model.PlaylistItem,
+	resolver.Artist:   model.Artist,
+	resolver.Album:    model.Album,
+	resolver.Track:    model.Track,
+}
+
+// getTracksFromPlaylist resolves the tracks of p and everything nested in
+// it, in the track order of p.
+func getTracksFromPlaylist(conn *src.SpotifyConn, p model.Playlist) ([]spotify.ID, error) {
+	res, err := resolvePlaylist(conn, p)
+	if err != nil {
+		return nil, err
+	}
+	return utils.Map(res.decisions, func(d resolver.Decision) spotify.ID { return d.Track }), nil
+}
+
+// resolution is what a playlist resolves to.
+type resolution struct {
+	graph resolver.Graph
+	// decisions are those for the tracks the playlist gets, in its track
+	// order.
+	decisions []resolver.Decision
+	// filtered are those for the tracks its metadata filters left out, in
+	// resolved order.
+	filtered []filteredDecision
+}
+
+// resolvePlaylist resolves p: its rules and those of nested playlists pick
+// the tracks, then its metadata filters narrow them down, its duplicate
+// policy drops extra versions and its track order puts them in order.
+// Nested playlists go through their own filters and duplicate policy first.
+func resolvePlaylist(conn *src.SpotifyConn, p model.Playlist) (*resolution, error) {
+	graph, expansion, err := loadResolution(conn, p)
+	if err != nil {
+		return nil, err
+	}
+
+	res, details, err := narrowPlaylist(conn, graph, expansion, p, !isResolvedOrder(p.TrackOrder))
+	if err != nil {
+		return nil, err
+	}
+	res.decisions, err = orderDecisions(p, res.decisions, details)
+	return res, err
+}
+
+// narrowPlaylist resolves p within graph and applies its metadata filters
+// and duplicate policy. The details of the tracks it keeps are only fetched
+// when those need them, or when withDetails is set.
+func narrowPlaylist(conn *src.SpotifyConn, graph resolver.Graph, expansion resolver.Expansion, p model.Playlist,
+	withDetails bool) (*resolution, map[spotify.ID]*spotify.FullTrack, error) {
+
+	res := &resolution{graph: graph, filtered: []filteredDecision{}}
+	res.decisions = slices.DeleteFunc(resolver.Decide(graph, p.SpotifyID, expansion), func(d resolver.Decision) bool {
+		return !d.Included
+	})
+
+	var err error
+	details := map[spotify.ID]*spotify.FullTrack{}
+	keep, dedupe := keepVersions[p.Duplicates]
+	if dedupe || !p.Filters.Empty() || withDetails {
+		if details, err = trackDetails(conn, res.decisions); err != nil {
+			return nil, nil, err
+		}
+	}
+	if !p.Filters.Empty() {
+		res.decisions, res.filtered = filterDecisions(p.Filters, res.decisions, details)
+	}
+	if dedupe {
+		res.decisions = resolver.Dedupe(res.decisions, trackVersions(details), keep)
+	}
+	return res, details, nil
+}
+
+// narrowGraph narrows every playlist nested in root that has metadata
+// filters or a duplicate policy to the tracks it keeps on its own, so it
+// only passes those on to root. Playlists are narrowed deepest first and
+// each of them once, however often it is nested.
+func narrowGraph(conn *src.SpotifyConn, graph resolver.Graph, expansion resolver.Expansion, root spotify.ID) error {
+	var playlists []model.Playlist
+	if err := src.GetDbConn().Db.Where("spotify_id IN ?", slices.Collect(maps.Keys(graph))).Find(&playlists).Error; err != nil {
+		return err
+	}
+	byID := map[spotify.ID]model.Playlist{}
+	for _, p := range playlists {
+		byID[p.SpotifyID] = p
+	}
+
+	done := map[spotify.ID]bool{}
+	var narrow func(id spotify.ID) error
+	narrow = func(id spotify.ID) error {
+		if done[id] {
+			return nil
+		}
+		done[id] = true
+
+		node := graph[id]
+		nested := slices.Concat(node.Children, node.Excluded)
+		if node.Expression != nil {
+			nested = append(nested, node.Expression.Playlists()...)
+		}
+		for _, n := range nested {
+			if err := narrow(n); err != nil {
+				return err
+			}
+		}
+
+		// root gets its filters and duplicate policy applied by the caller
+		p, ok := byID[id]
+		_, dedupe := keepVersions[p.Duplicates]
+		if id == root || !ok || (!dedupe && p.Filters.Empty()) {
+			return nil
+		}
+		res, _, err := narrowPlaylist(conn, graph, expansion, p, false)
+		if err != nil {
+			return err
+		}
+		node.Narrowed = utils.Map(res.decisions, func(d resolver.Decision) spotify.ID { return d.Track })
+		graph[id] = node
+		return nil
+	}
+	return narrow(root)
+}
+
+// trackDetails fetches the full details of the tracks of decisions.
+func trackDetails(conn *src.SpotifyConn, decisions []resolver.Decision) (map[spotify.ID]*spotify.FullTrack, error) {
+	tracks, err := getTracks(conn, utils.Map(decisions, func(d resolver.Decision) spotify.ID { return d.Track }))
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[spotify.ID]*spotify.FullTrack{}
+	for _, t := range tracks {
+		if t != nil {
+			details[t.ID] = t
+		}
+	}
+	return details, nil
+}
+
+// loadResolution loads everything the resolver needs for p: the graph of p
+// and its nested playlists from the database, and the tracks of every
+// artist and album their rules name from Spotify. Nested playlists with
+// filters or a duplicate policy come narrowed.
+func loadResolution(conn *src.SpotifyConn, p model.Playlist) (resolver.Graph, resolver.Expansion, error) {
+	graph, err := loadGraph(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expansion, err := expandGraph(conn, graph)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := narrowGraph(conn, graph, expansion, p.SpotifyID); err != nil {
+		return nil, nil, err
+	}
+	return graph, expansion, nil
+}
+
+func loadGraph(p model.Playlist) (resolver.Graph, error) {
+	graph := resolver.Graph{}
+
+	queue := []model.Playlist{p}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if _, seen := graph[current.SpotifyID]; seen {
+			continue
+		}
+
+		inclusions, err := getRules(current.SpotifyID, "playlist_inclusions", false)
+		if err != nil {
+			return nil, err
+		}
+		exclusions, err := getRules(current.SpotifyID, "playlist_exclusions", true)
+		if err != nil {
+			return nil, err
+		}
+
+		node := resolver.Node{Rules: append(inclusions, exclusions...)}
+		for _, nested := range GetIncludedPlaylistsFromPlaylist(&current) {
+			node.Children = append(node.Children, nested.SpotifyID)
+			queue = append(queue, nested)
+		}
+		for _, excluded := range GetExcludedPlaylistsFromPlaylist(&current) {
+			node.Excluded = append(node.Excluded, excluded.SpotifyID)
+			queue = append(queue, excluded)
+		}
+		if current.Expression != nil {
+			expr := toExpr(*current.Expression)
+			node.Expression = &expr
+			queue = append(queue, GetOperandPlaylistsFromPlaylist(&current)...)
+		}
+		graph[current.SpotifyID] = node
+	}
+
+	return graph, nil
+}
+
+// getRules reads the inclusions or exclusions of a playlist from joinTable.
+func getRules(playlistID spotify.ID, joinTable string, exclude bool) ([]resolver.Rule, error) {
+	var items []model.IdItem
+	err := src.GetDbConn().Db.
+		Table("id_items").
+		Joins("JOIN "+joinTable+" ON "+joinTable+".id_item_spotify_id = id_items.spotify_id").
+		Where(joinTable+".playlist_spotify_id = ?", playlistID).
+		Order("id_items.spotify_id").
+		Find(&items).Error
+	if err != nil {
+		return nil, err
+	}
+
+	modes := map[spotify.ID]model.ArtistInclusion{}
+	if !exclude {
+		if modes, err = artistInclusions(playlistID); err != nil {
+			return nil, err
+		}
+	}
+
+	rules := []resolver.Rule{}
+	for _, item := range items {
+		if kind, ok := ruleKinds[item.ItemType]; ok {
+			rule := resolver.Rule{ItemID: item.SpotifyID, Kind: kind, Exclude: exclude}
+			if kind == resolver.Artist {
+				rule.Variant = artistVariant(modes[item.SpotifyID])
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// expandGraph fetches the tracks of every artist and album named in graph,
+// a few at a time.
+func expandGraph(conn *src.SpotifyConn, graph resolver.Graph) (resolver.Expansion, error) {
+	rules := []resolver.Rule{}
+	seen := map[spotify.ID]bool{}
+	for _, node := range graph {
+		for _, rule := range node.Rules {
+			if rule.Kind != resolver.Track && !seen[rule.Key()] {
+				seen[rule.Key()] = true
+				rules = append(rules, rule)
+			}
+		}
+	}
+
+	tracks, err := fanout.Map(conn.Ctx, fanout.Limit(), rules, func(ctx context.Context, rule resolver.Rule) ([]spotify.ID, error) {
+		var tracks []spotify.SimpleTrack
+		var err error
+		if rule.Kind == resolver.Artist {
+			tracks, err = getArtistTracks(conn.WithContext(ctx), rule.ItemID, parseArtistVariant(rule.Variant))
+		} else {
+			tracks, err = getTracksFromAlbumById(conn.WithContext(ctx), rule.ItemID)
+		}
+		return utils.Map(tracks, func(t spotify.SimpleTrack) spotify.ID { return t.ID }), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	expansion := resolver.Expansion{}
+	for i, rule := range rules {
+		expansion[rule.Key()] = tracks[i]
+	}
+	return expansion, nil
+}
+
+// ExplainTrack tells why a track is in or out of a playlist: every rule
+// reaching it, through which nested playlists, and which one won.
+func ExplainTrack(conn *src.SpotifyConn, playlistID spotify.ID, trackID spotify.ID) (*model.ExplainResponse, error) {
+	playlist, err := getPlaylist(conn, playlistID)
+	if err != nil {
+		return nil, err
+	}
+
+	graph, expansion, err := loadResolution(conn, *playlist)
+	if err != nil {
+		return nil, err
+	}
+	decision := resolver.Explain(graph, playlist.SpotifyID, expansion, trackID)
+
+	playlists, err := playlistsByID(slices.Collect(maps.Keys(graph)))
+	if err != nil {
+		return nil, err
+	}
+	names, err := itemNames(conn, []spotify.ID{trackID}, decision.Matches)
+	if err != nil {
+		return nil, err
+	}
+
+	toMatch := func(m resolver.Match) model.RuleMatch { return ruleMatch(m, names, playlists) }
+	res := &model.ExplainResponse{
+		TrackID:   trackID,
+		TrackName: names[trackID],
+		Included:  decision.Included,
+		Matches:   utils.Map(decision.Matches, toMatch),
+	}
+	if decision.Winner != nil {
+		winner := toMatch(*decision.Winner)
+		res.Winner = &winner
+	}
+	return res, nil
+}
+
+// PreviewPlaylist resolves a playlist without publishing it: the tracks it
+// would get, in its track order, with the rule that put each of them there,
+// and the tracks its metadata filters left out.
+func PreviewPlaylist(conn *src.SpotifyConn, id spotify.ID) (*model.PreviewResponse, error) {
+	playlist, err := getPlaylist(conn, id)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resolvePlaylist(conn, *playlist)
+	if err != nil {
+		return nil, err
+	}
+
+	playlists, err := playlistsByID(slices.Collect(maps.Keys(res.graph)))
+	if err != nil {
+		return nil, err
+	}
+	decisions := slices.Concat(res.decisions, utils.Map(res.filtered, func(f filteredDecision) resolver.Decision { return f.Decision }))
+	winners := utils.Map(decisions, func(d resolver.Decision) resolver.Match { return *d.Winner })
+	names, err := itemNames(conn, nil, winners)
+	if err != nil {
+		return nil, err
+	}
+	details, err := trackDetails(conn, decisions)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &model.PreviewResponse{Tracks: []model.PreviewTrack{}, FilteredOut: []model.FilteredTrack{}}
+	for i, d := range res.decisions {
+		// Tracks the catalog no longer returns are left out
+		t, ok := details[d.Track]
+		if !ok {
+			continue
+		}
+		preview.Tracks = append(preview.Tracks, model.PreviewTrack{
+			SpotifyID:  t.ID,
+			Name:       t.Name,
+			Artists:    utils.Map(t.Artists, func(a spotify.SimpleArtist) string { return a.Name }),
+			Album:      t.Album.Name,
+			AlbumID:    t.Album.ID,
+			DurationMs: int(t.Duration),
+			Source:     ruleMatch(winners[i], names, playlists),
+		})
+		preview.TotalDurationMs += int(t.Duration)
+	}
+	preview.TrackCount = len(preview.Tracks)
+
+	for i, f := range res.filtered {
+		// A track the catalog no longer returns goes by its ID
+		name := string(f.Track)
+		if t, ok := details[f.Track]; ok {
+			name = t.Name
+		}
+		preview.FilteredOut = append(preview.FilteredOut, model.FilteredTrack{
+			SpotifyID: f.Track,
+			Name:      name,
+			Reason:    f.reason,
+			Source:    ruleMatch(winners[len(res.decisions)+i], names, playlists),
+		})
+	}
+	if !playlist.Filters.Empty() {
+		preview.Filters = &playlist.Filters
+	}
+	return preview, nil
+}
+
+func ruleMatch(m resolver.Match, names map[spotify.ID]string, playlists map[spotify.ID]model.PlaylistResponse) model.RuleMatch {
+	name := names[m.Rule.ItemID]
+	if m.Rule.Kind == resolver.Playlist {
+		name = playlists[m.Rule.ItemID].Name
+	}
+	return model.RuleMatch{
+		ItemID:      m.Rule.ItemID,
+		ItemName:    name,
+		ItemType:    itemTypes[m.Rule.Kind],
+		Include:     !m.Rule.Exclude,
+		Playlist:    playlists[m.Playlist],
+		Via:         utils.Map(m.Path, func(id spotify.ID) model.PlaylistResponse { return playlists[id] }),
+		Depth:       m.Depth,
+		Specificity: m.Specificity,
+	}
+}
+
+func playlistsByID(ids []spotify.ID) (map[spotify.ID]model.PlaylistResponse, error) {
+	var playlists []model.Playlist
+	if err := src.GetDbConn().Db.Where("spotify_id IN ?", ids).Find(&playlists).Error; err != nil {
+		return nil, err
+	}
+
+	byID := map[spotify.ID]model.PlaylistResponse{}
+	for _, p := range playlists {
+		byID[p.SpotifyID] = *p.ToResponse()
+	}
+	return byID, nil
+}
+
+// itemNames looks up the names of the tracks and of the items the matches
+// name.
+func itemNames(conn *src.SpotifyConn, trackIDs []spotify.ID, matches []resolver.Match) (map[spotify.ID]string, error) {
+	ids := map[resolver.Kind][]spotify.ID{resolver.Track: slices.Clone(trackIDs)}
+	for _, m := range matches {
+		if !slices.Contains(ids[m.Rule.Kind], m.Rule.ItemID) {
+			ids[m.Rule.Kind] = append(ids[m.Rule.Kind], m.Rule.ItemID)
+		}
+	}
+
+	names := map[spotify.ID]string{}
+	artists, err := getArtistsByIds(conn, ids[resolver.Artist])
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range artists {
+		names[a.ID] = a.Name
+	}
+	albums, err := getAlbumsByIds(conn, ids[resolver.Album])
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range albums {
+		names[a.ID] = a.Name
+	}
+	tracks, err := getTracks(conn, ids[resolver.Track])
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tracks {
+		names[t.ID] = t.Name
+	}
+	return names, nil
+}
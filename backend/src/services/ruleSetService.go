@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/autoexclude"
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/fanout"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/zmb3/spotify/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetRuleSets returns the builtin rule sets and those of the user.
+func GetRuleSets(conn *src.SpotifyConn) ([]model.RuleSet, error) {
+	var ruleSets []model.RuleSet
+	err := src.GetDbConn().Db.Preload("Rules").
+		Where("builtin = ? OR owner_id = ?", true, conn.UserID).
+		Order("builtin DESC, name, id").
+		Find(&ruleSets).Error
+	return ruleSets, err
+}
+
+// GetRuleSet looks up a builtin rule set or one of the user's.
+func GetRuleSet(conn *src.SpotifyConn, id uint) (*model.RuleSet, error) {
+	var ruleSet model.RuleSet
+	err := src.GetDbConn().Db.Preload("Rules").
+		Where("id = ? AND (builtin = ? OR owner_id = ?)", id, true, conn.UserID).
+		First(&ruleSet).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errs.NotFound("rule set %d", id)
+	}
+	return &ruleSet, err
+}
+
+// getOwnRuleSet looks up a rule set the user may change.
+func getOwnRuleSet(conn *src.SpotifyConn, id uint) (*model.RuleSet, error) {
+	ruleSet, err := GetRuleSet(conn, id)
+	if err != nil {
+		return nil, err
+	}
+	if ruleSet.Builtin {
+		return nil, errs.Invalid("rule set %q is builtin and can't be changed", ruleSet.Name)
+	}
+	return ruleSet, nil
+}
+
+func CreateRuleSet(conn *src.SpotifyConn, req model.RuleSetRequest) (*model.RuleSet, error) {
+	if _, err := autoexclude.Compile(req.Rules); err != nil {
+		return nil, err
+	}
+
+	ruleSet := model.RuleSet{OwnerID: conn.UserID, Name: req.Name, Rules: newRules(req.Rules)}
+	err := src.GetDbConn().Db.Create(&ruleSet).Error
+	return &ruleSet, err
+}
+
+// UpdateRuleSet renames a rule set and replaces its rules.
+func UpdateRuleSet(conn *src.SpotifyConn, id uint, req model.RuleSetRequest) (*model.RuleSet, error) {
+	if _, err := autoexclude.Compile(req.Rules); err != nil {
+		return nil, err
+	}
+	ruleSet, err := getOwnRuleSet(conn, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ruleSet.Name, ruleSet.Rules = req.Name, newRules(req.Rules)
+	err = src.GetDbConn().Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("rule_set_id = ?", id).Delete(&model.ExclusionRule{}).Error; err != nil {
+			return err
+		}
+		return tx.Save(ruleSet).Error
+	})
+	return ruleSet, err
+}
+
+// DeleteRuleSet deletes a rule set and detaches it from every playlist.
+// What it excluded stays excluded.
+func DeleteRuleSet(conn *src.SpotifyConn, id uint) error {
+	ruleSet, err := getOwnRuleSet(conn, id)
+	if err != nil {
+		return err
+	}
+
+	db := src.GetDbConn().Db
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Table("playlist_rule_sets").Where("rule_set_id = ?", id).Delete(nil).Error; err != nil {
+			return err
+		}
+		return tx.Select(clause.Associations).Delete(ruleSet).Error
+	})
+}
+
+// newRules copies rules from a request, so they are created afresh.
+func newRules(rules []model.ExclusionRule) []model.ExclusionRule {
+	result := make([]model.ExclusionRule, len(rules))
+	for i, r := range rules {
+		result[i] = model.ExclusionRule{Field: r.Field, Match: r.Match, Pattern: r.Pattern, Languages: r.Languages}
+	}
+	return result
+}
+
+func GetPlaylistRuleSets(conn *src.SpotifyConn, playlistID spotify.ID) ([]model.RuleSet, error) {
+	playlist, err := getPlaylist(conn, playlistID)
+	if err != nil {
+		return nil, err
+	}
+
+	var ruleSets []model.RuleSet
+	err = src.GetDbConn().Db.Model(playlist).Preload("Rules").Order("builtin DESC, name, id").Association("RuleSets").Find(&ruleSets)
+	return ruleSets, err
+}
+
+// AttachRuleSet makes the rule set apply to artists and albums included in
+// the playlist from now on.
+func AttachRuleSet(conn *src.SpotifyConn, playlistID spotify.ID, ruleSetID uint) error {
+	playlist, err := getPlaylist(conn, playlistID)
+	if err != nil {
+		return err
+	}
+	ruleSet, err := GetRuleSet(conn, ruleSetID)
+	if err != nil {
+		return err
+	}
+
+	return src.GetDbConn().Db.Model(playlist).Omit("RuleSets.*").Association("RuleSets").Append(ruleSet)
+}
+
+// DetachRuleSet stops the rule set from applying to the playlist. What it
+// already excluded stays excluded.
+func DetachRuleSet(conn *src.SpotifyConn, playlistID spotify.ID, ruleSetID uint) error {
+	playlist, err := getPlaylist(conn, playlistID)
+	if err != nil {
+		return err
+	}
+	ruleSet, err := GetRuleSet(conn, ruleSetID)
+	if err != nil {
+		return err
+	}
+
+	return src.GetDbConn().Db.Model(playlist).Association("RuleSets").Delete(ruleSet)
+}
+
+// attachBuiltinRuleSets attaches the default builtin rule set to a new
+// playlist.
+func attachBuiltinRuleSets(db *gorm.DB, playlist *model.Playlist) error {
+	var builtin []model.RuleSet
+	if err := db.Where("builtin = ? AND name = ?", true, model.DefaultRuleSetName).Find(&builtin).Error; err != nil {
+		return err
+	}
+	if len(builtin) == 0 {
+		return nil
+	}
+	return db.Model(playlist).Omit("RuleSets.*").Association("RuleSets").Append(builtin)
+}
+
+// TestRuleSet shows what the rules would exclude when the artist is
+// included.
+func TestRuleSet(conn *src.SpotifyConn, req model.RuleSetTestRequest) (*model.RuleSetTestResponse, error) {
+	matcher, err := autoexclude.Compile(req.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err := normalizeReleaseTypes(req.ReleaseTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	albums, tracks, err := findAutoExclusions(conn, matcher, model.Artist, req.ArtistID, model.ArtistInclusion{ReleaseTypes: releases}.Releases())
+	if err != nil {
+		return nil, err
+	}
+	return &model.RuleSetTestResponse{Albums: albums, Tracks: tracks}, nil
+}
+
+// playlistMatcher compiles the rules of every rule set attached to the
+// playlist.
+func playlistMatcher(playlistID spotify.ID) (*autoexclude.Matcher, error) {
+	var rules []model.ExclusionRule
+	err := src.GetDbConn().Db.
+		Joins("JOIN playlist_rule_sets ON playlist_rule_sets.rule_set_id = exclusion_rules.rule_set_id").
+		Where("playlist_rule_sets.playlist_spotify_id = ?", playlistID).
+		Order("exclusion_rules.rule_set_id, exclusion_rules.id").
+		Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+	return autoexclude.Compile(rules)
+}
+
+// findAutoExclusions returns what the matcher excludes along with an
+// artist or album: the matching releases of an artist and the matching
+// tracks of its other releases, or the matching tracks of an album.
+func findAutoExclusions(conn *src.SpotifyConn, matcher *autoexclude.Matcher, itemType model.ItemType, id spotify.ID, releases []model.ReleaseType) ([]model.ExcludedItem, []model.ExcludedItem, error) {
+	albums, tracks := []model.ExcludedItem{}, []model.ExcludedItem{}
+	if matcher.Empty() {
+		return albums, tracks, nil
+	}
+
+	albumIDs := []spotify.ID{}
+	switch itemType {
+	case model.Artist:
+		artistAlbums, err := GetAlbumsFromArtistById(conn, id, releases)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, album := range artistAlbums {
+			if rule, ok := matcher.Album(album); ok {
+				albums = append(albums, model.ExcludedItem{SpotifyID: album.ID, Name: album.Name, Rule: rule})
+			} else {
+				albumIDs = append(albumIDs, album.ID)
+			}
+		}
+	case model.Album:
+		albumIDs = append(albumIDs, id)
+	default:
+		return albums, tracks, nil
+	}
+
+	albumTracks, err := fanout.FlatMap(conn.Ctx, fanout.Limit(), albumIDs, func(ctx context.Context, albumID spotify.ID) ([]spotify.SimpleTrack, error) {
+		return getTracksFromAlbumById(conn.WithContext(ctx), albumID)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, track := range albumTracks {
+		if rule, ok := matcher.Track(track); ok {
+			tracks = append(tracks, model.ExcludedItem{SpotifyID: track.ID, Name: track.Name, Rule: rule})
+		}
+	}
+	return albums, tracks, nil
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/errs"
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/aarhunt/spootify/src/utils"
+	"github.com/robfig/cron/v3"
+	"github.com/zmb3/spotify/v2"
+	"gorm.io/gorm"
+)
+
+// minScheduleInterval keeps schedules from republishing more often than
+// new releases could plausibly show up.
+const minScheduleInterval = 15 * time.Minute
+
+// scheduleCheckSpan is how far ahead the runs of a cron expression are
+// checked against minScheduleInterval.
+const scheduleCheckSpan = 7 * 24 * time.Hour
+
+// scheduleRunTimeout bounds a single run, from resolving the playlist to
+// the last edit on Spotify.
+const scheduleRunTimeout = 10 * time.Minute
+
+var (
+	scheduler     = cron.New()
+	lockScheduler = &sync.Mutex{}
+	scheduled     = map[spotify.ID]cron.EntryID{}
+
+	// runLocks holds a *sync.Mutex per playlist, so a run triggered by hand
+	// doesn't overlap a scheduled one of the same playlist
+	runLocks sync.Map
+)
+
+// StartScheduler registers every schedule that isn't paused and starts
+// running them in the background.
+func StartScheduler() error {
+	var schedules []model.Schedule
+	if err := src.GetDbConn().Db.Where("paused = ?", false).Find(&schedules).Error; err != nil {
+		return err
+	}
+	for _, s := range schedules {
+		if err := register(s); err != nil {
+			log.Printf("schedule of playlist %s not started: %v", s.PlaylistSpotifyID, err)
+		}
+	}
+	scheduler.Start()
+	return nil
+}
+
+// register (re)adds the cron entry of s, or only removes it if s is paused.
+func register(s model.Schedule) error {
+	lockScheduler.Lock()
+	defer lockScheduler.Unlock()
+
+	if id, ok := scheduled[s.PlaylistSpotifyID]; ok {
+		scheduler.Remove(id)
+		delete(scheduled, s.PlaylistSpotifyID)
+	}
+	if s.Paused {
+		return nil
+	}
+
+	spec, err := cron.ParseStandard(s.Spec)
+	if err != nil {
+		return err
+	}
+	playlistID := s.PlaylistSpotifyID
+	scheduled[playlistID] = scheduler.Schedule(spec, cron.FuncJob(func() {
+		if err := runScheduled(playlistID); err != nil {
+			log.Printf("scheduled publish of playlist %s: %v", playlistID, err)
+		}
+	}))
+	return nil
+}
+
+func unregister(playlistID spotify.ID) {
+	register(model.Schedule{PlaylistSpotifyID: playlistID, Paused: true})
+}
+
+// scheduleSpec turns a request into a cron spec, refusing specs that run
+// more often than minScheduleInterval.
+func scheduleSpec(req model.ScheduleRequest) (string, error) {
+	var spec string
+	switch {
+	case req.Cron != "" && req.Interval != "":
+		return "", errs.Invalid("a schedule takes either a cron expression or an interval, not both")
+	case req.Cron != "":
+		spec = req.Cron
+	case req.Interval != "":
+		if _, err := time.ParseDuration(req.Interval); err != nil {
+			return "", errs.Invalid("interval must be a duration like 6h, got %q", req.Interval)
+		}
+		spec = "@every " + req.Interval
+	default:
+		return "", errs.Invalid("a schedule needs a cron expression or an interval")
+	}
+
+	parsed, err := cron.ParseStandard(spec)
+	if err != nil {
+		return "", errs.Invalid("invalid cron expression %q: %v", spec, err)
+	}
+
+	// The gaps of a cron expression can be uneven, like those of
+	// "0,5 * * * *", so every gap in a week of runs is checked
+	first := parsed.Next(time.Now())
+	for run := first; !run.IsZero() && run.Before(first.Add(scheduleCheckSpan)); {
+		next := parsed.Next(run)
+		if !next.IsZero() && next.Sub(run) < minScheduleInterval {
+			return "", errs.Invalid("schedules can run at most every %s", minScheduleInterval)
+		}
+		run = next
+	}
+	return spec, nil
+}
+
+func GetSchedules(conn *src.SpotifyConn) ([]model.ScheduleResponse, error) {
+	var schedules []model.Schedule
+	err := src.GetDbConn().Db.Where("owner_id = ?", conn.UserID).Order("playlist_spotify_id").Find(&schedules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	playlists, err := playlistsByID(utils.Map(schedules, func(s model.Schedule) spotify.ID { return s.PlaylistSpotifyID }))
+	if err != nil {
+		return nil, err
+	}
+
+	responses := []model.ScheduleResponse{}
+	for _, s := range schedules {
+		responses = append(responses, scheduleResponse(s, playlists[s.PlaylistSpotifyID].Name))
+	}
+	return responses, nil
+}
+
+// getSchedule looks up the schedule of one of the user's playlists.
+func getSchedule(conn *src.SpotifyConn, playlistID spotify.ID) (*model.Playlist, *model.Schedule, error) {
+	playlist, err := getPlaylist(conn, playlistID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var schedule model.Schedule
+	err = src.GetDbConn().Db.Where("playlist_spotify_id = ?", playlistID).First(&schedule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return playlist, nil, errs.NotFound("schedule of playlist %s", playlistID)
+	}
+	return playlist, &schedule, err
+}
+
+// SetSchedule schedules a playlist to be republished, or changes when. A
+// paused schedule stays paused.
+func SetSchedule(conn *src.SpotifyConn, playlistID spotify.ID, req model.ScheduleRequest) (*model.ScheduleResponse, error) {
+	spec, err := scheduleSpec(req)
+	if err != nil {
+		return nil, err
+	}
+	playlist, schedule, err := getSchedule(conn, playlistID)
+	if errors.Is(err, errs.ErrNotFound) && playlist != nil {
+		schedule = &model.Schedule{PlaylistSpotifyID: playlistID}
+	} else if err != nil {
+		return nil, err
+	}
+
+	schedule.OwnerID = conn.UserID
+	schedule.Spec = spec
+	if err := src.GetDbConn().Db.Save(schedule).Error; err != nil {
+		return nil, err
+	}
+	if err := register(*schedule); err != nil {
+		return nil, err
+	}
+	res := scheduleResponse(*schedule, playlist.Name)
+	return &res, nil
+}
+
+func DeleteSchedule(conn *src.SpotifyConn, playlistID spotify.ID) error {
+	_, schedule, err := getSchedule(conn, playlistID)
+	if err != nil {
+		return err
+	}
+	if err := src.GetDbConn().Db.Delete(schedule).Error; err != nil {
+		return err
+	}
+	unregister(playlistID)
+	return nil
+}
+
+// PauseSchedule stops or resumes running a schedule. A paused schedule can
+// still be run by hand.
+func PauseSchedule(conn *src.SpotifyConn, playlistID spotify.ID, paused bool) (*model.ScheduleResponse, error) {
+	playlist, schedule, err := getSchedule(conn, playlistID)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.Paused = paused
+	if err := src.GetDbConn().Db.Model(schedule).Select("Paused").Updates(schedule).Error; err != nil {
+		return nil, err
+	}
+	if err := register(*schedule); err != nil {
+		return nil, err
+	}
+	res := scheduleResponse(*schedule, playlist.Name)
+	return &res, nil
+}
+
+// RunSchedule runs a schedule right away, paused or not.
+func RunSchedule(conn *src.SpotifyConn, playlistID spotify.ID) (*model.ScheduleResponse, error) {
+	playlist, schedule, err := getSchedule(conn, playlistID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runSchedule(conn, schedule); err != nil {
+		return nil, err
+	}
+	res := scheduleResponse(*schedule, playlist.Name)
+	return &res, nil
+}
+
+// runScheduled runs a schedule from the scheduler, as the owner of the
+// playlist.
+func runScheduled(playlistID spotify.ID) error {
+	var schedule model.Schedule
+	if err := src.GetDbConn().Db.Where("playlist_spotify_id = ?", playlistID).First(&schedule).Error; err != nil {
+		return err
+	}
+	return runSchedule(src.GetSpotifyConn(schedule.OwnerID), &schedule)
+}
+
+// runSchedule republishes the playlist of s if the tracks it resolves to
+// differ from those on Spotify, and records how the run went. The error is
+// that of recording it; a failed publish is recorded instead.
+func runSchedule(conn *src.SpotifyConn, s *model.Schedule) error {
+	lock, _ := runLocks.LoadOrStore(s.PlaylistSpotifyID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	status, err := republish(conn, s)
+	now := time.Now()
+	s.LastRunAt, s.LastStatus, s.LastError = &now, status, ""
+	if err != nil {
+		s.LastError = err.Error()
+	}
+	return src.GetDbConn().Db.Model(s).Select("LastRunAt", "LastStatus", "LastError").Updates(s).Error
+}
+
+func republish(conn *src.SpotifyConn, s *model.Schedule) (model.ScheduleStatus, error) {
+	if conn == nil {
+		return model.ScheduleFailed, errors.New("the owner of the playlist isn't connected to Spotify")
+	}
+	ctx, cancel := context.WithTimeout(conn.Ctx, scheduleRunTimeout)
+	defer cancel()
+	conn = conn.WithContext(ctx)
+
+	playlist, err := getPlaylist(conn, s.PlaylistSpotifyID)
+	if err != nil {
+		return model.ScheduleFailed, err
+	}
+	trackIDs, err := getTracksFromPlaylist(conn, *playlist)
+	if err != nil {
+		return model.ScheduleFailed, err
+	}
+
+	// The playlist may have been published by hand or edited on Spotify
+	// since the last run, so it's checked against what Spotify holds now
+	_, plan, err := planSync(conn, playlist.SpotifyID, trackIDs)
+	if err != nil {
+		return model.ScheduleFailed, err
+	}
+	if len(plan.Remove) == 0 && len(plan.Add) == 0 && len(plan.Moves) == 0 {
+		return model.ScheduleUnchanged, nil
+	}
+	if err := publishTracks(conn, playlist, trackIDs); err != nil {
+		return model.ScheduleFailed, err
+	}
+	return model.SchedulePublished, nil
+}
+
+func scheduleResponse(s model.Schedule, playlistName string) model.ScheduleResponse {
+	res := model.ScheduleResponse{
+		PlaylistSpotifyID: s.PlaylistSpotifyID,
+		PlaylistName:      playlistName,
+		Spec:              s.Spec,
+		Paused:            s.Paused,
+		LastRunAt:         s.LastRunAt,
+		LastStatus:        s.LastStatus,
+		LastError:         s.LastError,
+	}
+	if next := nextRun(s); !next.IsZero() {
+		res.NextRunAt = &next
+	}
+	return res
+}
+
+// nextRun returns when the scheduler runs s next, or when it would if it
+// isn't running yet. It's zero for a paused schedule.
+func nextRun(s model.Schedule) time.Time {
+	if s.Paused {
+		return time.Time{}
+	}
+
+	lockScheduler.Lock()
+	id, ok := scheduled[s.PlaylistSpotifyID]
+	lockScheduler.Unlock()
+	if ok {
+		if next := scheduler.Entry(id).Next; !next.IsZero() {
+			return next
+		}
+	}
+
+	spec, err := cron.ParseStandard(s.Spec)
+	if err != nil {
+		return time.Time{}
+	}
+	return spec.Next(time.Now())
+}
@@ -1,27 +1,18 @@
 package services
 
 import (
-	"log"
+	"context"
 	"slices"
 
 	"github.com/aarhunt/spootify/src"
+	"github.com/aarhunt/spootify/src/fanout"
 	"github.com/zmb3/spotify/v2"
 )
 
-func getTracks(ids []spotify.ID) []*spotify.FullTrack {
-	spotiConn := src.GetSpotifyConn()
-	ctx, client := spotiConn.Ctx, spotiConn.Client
+func getTracks(conn *src.SpotifyConn, ids []spotify.ID) ([]*spotify.FullTrack, error) {
+	chunks := slices.Collect(slices.Chunk(ids, 50))
 
-	chunks := slices.Chunk(ids, 50)
-	tracks := []*spotify.FullTrack{}
-
-	for chunk := range chunks {
-		res, err := client.GetTracks(ctx, chunk)
-		if err != nil {
-			log.Fatal(err)
-		}
-		tracks = append(tracks, res...)
-	}
-
-	return tracks
+	return fanout.FlatMap(conn.Ctx, fanout.Limit(), chunks, func(ctx context.Context, chunk []spotify.ID) ([]*spotify.FullTrack, error) {
+		return conn.Catalog.GetTracks(ctx, chunk)
+	})
 }
@@ -0,0 +1,111 @@
+package src
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sessionCookie = "spootify_session"
+	sessionTTL    = 30 * 24 * time.Hour
+	connKey       = "spotifyConn"
+)
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession starts a session for userID and returns the token the client
+// has to present, either as cookie or as bearer token.
+func CreateSession(userID string) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	session := model.Session{
+		ID:        hashToken(token),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(sessionTTL),
+	}
+	return token, GetDbConn().Db.Create(&session).Error
+}
+
+func lookupSession(token string) *model.Session {
+	var session model.Session
+	err := GetDbConn().Db.
+		Where("id = ? AND expires_at > ?", hashToken(token), time.Now()).
+		Limit(1).Find(&session).Error
+	if err != nil || session.UserID == "" {
+		return nil
+	}
+	return &session
+}
+
+// sessionToken reads the session token from the Authorization header or,
+// failing that, the session cookie.
+func sessionToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	token, _ := c.Cookie(sessionCookie)
+	return token
+}
+
+func setSessionCookie(c *gin.Context, token string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, token, maxAge, "/", "", os.Getenv("API_SCHEME") == "https", true)
+}
+
+// ConnFromRequest returns the Spotify connection of the caller's session. In
+// single-user setups started with UseCatalog, requests without a session act
+// as that user.
+func ConnFromRequest(c *gin.Context) *SpotifyConn {
+	if token := sessionToken(c); token != "" {
+		session := lookupSession(token)
+		if session == nil {
+			return nil
+		}
+		return GetSpotifyConn(session.UserID)
+	}
+
+	if user := getDefaultUser(); user != "" {
+		return GetSpotifyConn(user)
+	}
+	return nil
+}
+
+// RequireSession rejects requests without a connected Spotify user and makes
+// the user's connection available through Conn.
+func RequireSession(c *gin.Context) {
+	conn := ConnFromRequest(c)
+	if conn == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, model.ErrorResponse{Error: "Not authenticated", Code: model.CodeUnauthorized})
+		return
+	}
+	c.Set(connKey, conn)
+	c.Next()
+}
+
+// Conn returns the connection stored by RequireSession.
+func Conn(c *gin.Context) *SpotifyConn {
+	return c.MustGet(connKey).(*SpotifyConn)
+}
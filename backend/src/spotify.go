@@ -7,22 +7,40 @@ import (
     "os"
     "sync"
 
+    "github.com/aarhunt/spootify/src/catalog"
+    "github.com/aarhunt/spootify/src/model"
+    "github.com/aarhunt/spootify/src/transport"
     "github.com/gin-gonic/gin"
     "github.com/zmb3/spotify/v2"
     spotifyauth "github.com/zmb3/spotify/v2/auth"
+    "golang.org/x/oauth2"
 )
 
 var (
     lockSpotifyConn     = &sync.Mutex{}
-    spotifyConnInstance *SpotifyConn
+    spotifyConns        = map[string]*SpotifyConn{}
+    defaultUserID       string
     auth                *spotifyauth.Authenticator
-    state               = "abc123_random_string" 
+
+    // All users share one transport since Spotify rate limits the app as
+    // a whole
+    spotifyHTTP         = &http.Client{Transport: transport.New(http.DefaultTransport, transport.ConfigFromEnv())}
 )
 
 type SpotifyConn struct {
-    Ctx    context.Context
-    Client *spotify.Client
-    UserID string
+    Ctx     context.Context
+    Catalog catalog.Catalog
+    UserID  string
+    // Token is nil when connected to a catalog without OAuth
+    Token   oauth2.TokenSource
+    Scopes  []string
+}
+
+// WithContext returns a copy of the connection that makes its calls with ctx.
+func (conn *SpotifyConn) WithContext(ctx context.Context) *SpotifyConn {
+    copied := *conn
+    copied.Ctx = ctx
+    return &copied
 }
 
 func initSpotifyAuth() {
@@ -30,8 +48,9 @@ func initSpotifyAuth() {
         return
     }
 
-    if os.Getenv("SPOTIFY_ID") == "" || os.Getenv("SPOTIFY_SECRET") == "" {
-        log.Fatal("SPOTIFY_ID and SPOTIFY_SECRET must be set")
+    // SPOTIFY_SECRET is optional, logins use PKCE either way
+    if os.Getenv("SPOTIFY_ID") == "" {
+        log.Fatal("SPOTIFY_ID must be set")
     }
 
     redirectURI := os.Getenv("SPOTIFY_REDIRECT_URL")
@@ -49,54 +68,138 @@ func initSpotifyAuth() {
     )
 }
 
-func GetSpotifyConn() *SpotifyConn {
+// GetSpotifyConn returns the connection of userID, reconnecting with the
+// stored token if the user isn't connected since the last restart.
+func GetSpotifyConn(userID string) *SpotifyConn {
+    lockSpotifyConn.Lock()
+    defer lockSpotifyConn.Unlock()
+
+    if conn, ok := spotifyConns[userID]; ok {
+        return conn
+    }
+
+    conn := restoreSpotifyConn(userID)
+    if conn != nil {
+        spotifyConns[userID] = conn
+    }
+    return conn
+}
+
+// UseCatalog connects userID to the given catalog, bypassing the OAuth flow,
+// and lets requests without a session act as that user. Used to run against
+// catalog.Fake without a Spotify account.
+func UseCatalog(cat catalog.Catalog, userID string) {
+    setSpotifyConn(&SpotifyConn{
+        Ctx:     context.Background(),
+        Catalog: cat,
+        UserID:  userID,
+    })
+
+    lockSpotifyConn.Lock()
+    defer lockSpotifyConn.Unlock()
+    defaultUserID = userID
+}
+
+func getDefaultUser() string {
     lockSpotifyConn.Lock()
     defer lockSpotifyConn.Unlock()
-    return spotifyConnInstance
+    return defaultUserID
+}
+
+func setSpotifyConn(conn *SpotifyConn) {
+    lockSpotifyConn.Lock()
+    defer lockSpotifyConn.Unlock()
+    spotifyConns[conn.UserID] = conn
+}
+
+// newSpotifyConn builds a connection whose client refreshes the token when
+// it expires, and whose catalog lookups are cached in the database and
+// shared between concurrent callers.
+func newSpotifyConn(userID string, token *oauth2.Token, scopes []string) *SpotifyConn {
+    ctx := context.WithValue(context.Background(), oauth2.HTTPClient, spotifyHTTP)
+    source := &tokenSource{ctx: ctx, userID: userID, scopes: scopes, token: token}
+    client := spotify.New(oauth2.NewClient(ctx, source))
+
+    return &SpotifyConn{
+        Ctx:     ctx,
+        Catalog: catalog.NewCoalesced(catalog.NewCached(catalog.NewSpotify(client), GetDbConn().Db, catalog.CacheTTLFromEnv())),
+        UserID:  userID,
+        Token:   source,
+        Scopes:  scopes,
+    }
 }
 
 // GetAuthURLController godoc
 // @Summary      Get Spotify Authorization URL
-// @Description  Returns the URL the user needs to visit to authorize the app on Spotify.
+// @Description  Returns the URL the user needs to visit to authorize the app on Spotify. The URL carries a single-use state bound to this browser through a cookie, and a PKCE code challenge.
 // @Tags         auth
 // @Produce      json
 // @Success      200  {object}  map[string]string "url: https://accounts.spotify.com/..."
+// @Failure      500  {object}  model.ErrorResponse "code: internal"
 // @Router       /auth/url [get]
 func GetAuthURLController(c *gin.Context) {
     initSpotifyAuth()
-    url := auth.AuthURL(state)
+
+    state, binding, verifier, err := startLogin()
+    if err != nil {
+        log.Println("Failed to start login:", err)
+        c.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to start login", Code: model.CodeInternal})
+        return
+    }
+
+    c.SetSameSite(http.SameSiteLaxMode)
+    c.SetCookie(loginCookie, binding, int(loginTTL.Seconds()), "/", "", os.Getenv("API_SCHEME") == "https", true)
+
+    url := auth.AuthURL(state,
+        oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+        oauth2.SetAuthURLParam("code_challenge", codeChallenge(verifier)),
+    )
     c.JSON(http.StatusOK, gin.H{"url": url})
 }
 
 func CompleteAuthGin(c *gin.Context) {
     initSpotifyAuth() 
 
-    if c.Query("state") != state {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "State mismatch"})
+    state := c.Query("state")
+    binding, _ := c.Cookie(loginCookie)
+    verifier, ok := finishLogin(state, binding)
+    if !ok {
+        c.JSON(http.StatusBadRequest, model.ErrorResponse{Error: "State mismatch", Code: model.CodeInvalid})
         return
     }
+    c.SetCookie(loginCookie, "", -1, "/", "", os.Getenv("API_SCHEME") == "https", true)
 
-    token, err := auth.Token(c.Request.Context(), state, c.Request)
+    token, err := auth.Token(c.Request.Context(), state, c.Request, oauth2.SetAuthURLParam("code_verifier", verifier))
     if err != nil {
-        c.JSON(http.StatusForbidden, gin.H{"error": "Couldn't get token", "details": err.Error()})
         log.Println("Auth Error:", err)
+        c.JSON(http.StatusForbidden, model.ErrorResponse{Error: "Couldn't get token", Code: model.CodeAuthFailed})
         return
     }
 
-    client := spotify.New(auth.Client(c.Request.Context(), token))
+    ctx := context.WithValue(c.Request.Context(), oauth2.HTTPClient, spotifyHTTP)
+    client := spotify.New(auth.Client(ctx, token))
     user, err := client.CurrentUser(c.Request.Context())
     if err != nil {
-         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user info"})
+         log.Println("Failed to fetch user info:", err)
+         c.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to fetch user info", Code: model.CodeInternal})
          return
     }
 
-    lockSpotifyConn.Lock()
-    spotifyConnInstance = &SpotifyConn{
-        Ctx:    context.Background(),
-        Client: client,
-        UserID: user.ID,
+    scopes := tokenScopes(token)
+    if err := saveToken(user.ID, token, scopes); err != nil {
+        log.Println("Failed to persist token:", err)
+        c.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to store token", Code: model.CodeInternal})
+        return
     }
-    lockSpotifyConn.Unlock()
+    setSpotifyConn(newSpotifyConn(user.ID, token, scopes))
+
+    session, err := CreateSession(user.ID)
+    if err != nil {
+        log.Println("Failed to create session:", err)
+        c.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to create session", Code: model.CodeInternal})
+        return
+    }
+    setSessionCookie(c, session, int(sessionTTL.Seconds()))
 
     c.Data(http.StatusOK, "text/html", []byte(`
         <div style="font-family: sans-serif; text-align: center; margin-top: 50px;">
@@ -107,3 +210,44 @@ func CompleteAuthGin(c *gin.Context) {
     `))
 }
 
+
+// LogoutController godoc
+// @Summary      Log out
+// @Description  Ends the caller's Spotify connection: drops the connection, deletes the stored token and all sessions of the user.
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  map[string]string "message: Logged out"
+// @Failure      500  {object}  model.ErrorResponse "code: internal"
+// @Router       /auth/logout [post]
+func LogoutController(c *gin.Context) {
+    setSessionCookie(c, "", -1)
+
+    token := sessionToken(c)
+    if token == "" {
+        c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+        return
+    }
+
+    session := lookupSession(token)
+    if session == nil {
+        c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+        return
+    }
+
+    lockSpotifyConn.Lock()
+    delete(spotifyConns, session.UserID)
+    lockSpotifyConn.Unlock()
+
+    db := GetDbConn().Db
+    err := db.Where("user_id = ?", session.UserID).Delete(&model.SpotifyToken{}).Error
+    if err == nil {
+        err = db.Where("user_id = ?", session.UserID).Delete(&model.Session{}).Error
+    }
+    if err != nil {
+        log.Println("Failed to log out:", err)
+        c.JSON(http.StatusInternalServerError, model.ErrorResponse{Error: "Failed to log out", Code: model.CodeInternal})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
@@ -0,0 +1,149 @@
+package src
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aarhunt/spootify/src/model"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+func authRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/auth/url", GetAuthURLController)
+	router.GET("/callback", CompleteAuthGin)
+	router.POST("/auth/logout", LogoutController)
+	return router
+}
+
+// startAuth requests an authorization URL and returns its state and the
+// login cookie that came with it.
+func startAuth(t *testing.T, router *gin.Engine) (string, *http.Cookie) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/url", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("auth url: %d %s", w.Code, w.Body.String())
+	}
+
+	var body struct {
+		URL string `json:"url"`
+	}
+	decodeBody(t, w, &body)
+	authURL, err := url.Parse(body.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := authURL.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Errorf("auth url %s has no PKCE challenge", body.URL)
+	}
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == loginCookie {
+			return query.Get("state"), cookie
+		}
+	}
+	t.Fatal("no login cookie set")
+	return "", nil
+}
+
+func decodeBody(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body.String(), err)
+	}
+}
+
+func callback(router *gin.Engine, state string, cookie *http.Cookie) int {
+	req := httptest.NewRequest(http.MethodGet, "/callback?state="+url.QueryEscape(state), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestAuthStateIsBoundAndSingleUse(t *testing.T) {
+	t.Setenv("SPOTIFY_ID", "client")
+	router := authRouter()
+
+	first, firstCookie := startAuth(t, router)
+	second, secondCookie := startAuth(t, router)
+	if first == second {
+		t.Fatal("two logins got the same state")
+	}
+
+	if code := callback(router, first, secondCookie); code != http.StatusBadRequest {
+		t.Errorf("state with another browser's cookie got %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := callback(router, "abc123_random_string", firstCookie); code != http.StatusBadRequest {
+		t.Errorf("unknown state got %d, want %d", code, http.StatusBadRequest)
+	}
+
+	// The state checks pass, so the request fails on the missing code instead
+	if code := callback(router, second, secondCookie); code != http.StatusForbidden {
+		t.Errorf("valid state got %d, want %d", code, http.StatusForbidden)
+	}
+	if code := callback(router, second, secondCookie); code != http.StatusBadRequest {
+		t.Errorf("reused state got %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestLogoutRevokesConnection(t *testing.T) {
+	t.Setenv("TOKEN_ENCRYPTION_KEY", "test-key")
+	useTestDb(t)
+	router := authRouter()
+
+	token := &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)}
+	if err := saveToken("alice", token, nil); err != nil {
+		t.Fatal(err)
+	}
+	setSpotifyConn(newSpotifyConn("alice", token, nil))
+	session, err := CreateSession("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+session)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("logout: %d %s", w.Code, w.Body.String())
+	}
+
+	if lookupSession(session) != nil {
+		t.Error("session still valid after logout")
+	}
+	if GetSpotifyConn("alice") != nil {
+		t.Error("connection still available after logout")
+	}
+}
+
+func TestAuthFailuresUseErrorResponse(t *testing.T) {
+	t.Setenv("SPOTIFY_ID", "client")
+	router := authRouter()
+	state, cookie := startAuth(t, router)
+
+	// The state checks pass, so the token exchange fails on the missing code
+	req := httptest.NewRequest(http.MethodGet, "/callback?state="+url.QueryEscape(state), nil)
+	req.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var body map[string]string
+	decodeBody(t, w, &body)
+	if w.Code != http.StatusForbidden || body["code"] != model.CodeAuthFailed || body["details"] != "" {
+		t.Errorf("got %d %v, want a 403 with code %s and no details", w.Code, body, model.CodeAuthFailed)
+	}
+}
@@ -0,0 +1,462 @@
+// Package spotifytest provides an httptest stand-in for the Spotify Web API,
+// so a real *spotify.Client can be used without a Spotify account.
+package spotifytest
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/aarhunt/spootify/src/catalog"
+	"github.com/zmb3/spotify/v2"
+)
+
+//go:embed fixtures
+var fixtures embed.FS
+
+// Server serves the parts of the Web API used by the services from a
+// catalog.Fake. Playlists written through the API can be inspected on
+// Catalog.
+type Server struct {
+	*httptest.Server
+	Catalog *catalog.Fake
+	UserID  string
+}
+
+// NewServer starts a server loaded with the bundled fixtures.
+func NewServer() *Server {
+	fake := catalog.NewFake()
+	sub, _ := fs.Sub(fixtures, "fixtures")
+	if err := fake.LoadFixtures(sub); err != nil {
+		panic(fmt.Sprintf("spotifytest: loading fixtures: %v", err))
+	}
+	return NewServerWithCatalog(fake)
+}
+
+// NewServerWithCatalog starts a server backed by the given fake.
+func NewServerWithCatalog(fake *catalog.Fake) *Server {
+	s := &Server{Catalog: fake, UserID: "testuser"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/me", s.me)
+	mux.HandleFunc("GET /v1/search", s.search)
+	mux.HandleFunc("GET /v1/artists", s.artists)
+	mux.HandleFunc("GET /v1/artists/{id}", s.artist)
+	mux.HandleFunc("GET /v1/artists/{id}/albums", s.artistAlbums)
+	mux.HandleFunc("GET /v1/artists/{id}/top-tracks", s.artistTopTracks)
+	mux.HandleFunc("GET /v1/albums", s.albums)
+	mux.HandleFunc("GET /v1/albums/{id}", s.album)
+	mux.HandleFunc("GET /v1/albums/{id}/tracks", s.albumTracks)
+	mux.HandleFunc("GET /v1/tracks", s.tracks)
+	mux.HandleFunc("GET /v1/tracks/{id}", s.track)
+	mux.HandleFunc("POST /v1/users/{user}/playlists", s.createPlaylist)
+	mux.HandleFunc("PUT /v1/playlists/{id}", s.renamePlaylist)
+	mux.HandleFunc("DELETE /v1/playlists/{id}/followers", s.unfollowPlaylist)
+	mux.HandleFunc("GET /v1/playlists/{id}", s.playlist)
+	mux.HandleFunc("GET /v1/playlists/{id}/tracks", s.playlistTracks)
+	mux.HandleFunc("PUT /v1/playlists/{id}/tracks", s.replaceOrReorderTracks)
+	mux.HandleFunc("POST /v1/playlists/{id}/tracks", s.addTracks)
+	mux.HandleFunc("DELETE /v1/playlists/{id}/tracks", s.removeTracks)
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Client returns a spotify.Client that talks to this server.
+func (s *Server) Client() *spotify.Client {
+	return spotify.New(s.Server.Client(), spotify.WithBaseURL(s.URL+"/v1/"))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	spotErr := spotify.Error{Status: http.StatusInternalServerError, Message: err.Error()}
+	errors.As(err, &spotErr)
+	writeJSON(w, spotErr.Status, map[string]any{"error": spotErr})
+}
+
+func ids(r *http.Request) []spotify.ID {
+	result := []spotify.ID{}
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id != "" {
+			result = append(result, spotify.ID(id))
+		}
+	}
+	return result
+}
+
+func trackIDs(uris []string) []spotify.ID {
+	result := []spotify.ID{}
+	for _, uri := range uris {
+		if uri != "" {
+			result = append(result, spotify.ID(strings.TrimPrefix(uri, "spotify:track:")))
+		}
+	}
+	return result
+}
+
+type pageResponse struct {
+	Href     string `json:"href"`
+	Items    any    `json:"items"`
+	Limit    int    `json:"limit"`
+	Offset   int    `json:"offset"`
+	Total    int    `json:"total"`
+	Next     string `json:"next"`
+	Previous string `json:"previous"`
+}
+
+// page slices items according to the limit and offset query parameters,
+// filling in next and previous links the way the Web API does.
+func page[T any](s *Server, r *http.Request, items []T) pageResponse {
+	query := r.URL.Query()
+	limit, err := strconv.Atoi(query.Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	offset = max(0, min(offset, len(items)))
+	end := min(offset+limit, len(items))
+
+	link := func(o int) string {
+		q := r.URL.Query()
+		q.Set("offset", strconv.Itoa(o))
+		q.Set("limit", strconv.Itoa(limit))
+		return s.URL + r.URL.Path + "?" + q.Encode()
+	}
+
+	p := pageResponse{
+		Href:   s.URL + r.URL.RequestURI(),
+		Items:  items[offset:end],
+		Limit:  limit,
+		Offset: offset,
+		Total:  len(items),
+	}
+	if end < len(items) {
+		p.Next = link(end)
+	}
+	if offset > 0 {
+		p.Previous = link(max(0, offset-limit))
+	}
+	return p
+}
+
+func (s *Server) me(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"id": s.UserID, "display_name": s.UserID})
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	result := map[string]any{}
+	for _, t := range strings.Split(r.URL.Query().Get("type"), ",") {
+		switch t {
+		case "artist":
+			artists, _ := s.Catalog.SearchArtists(r.Context(), query, limit)
+			result["artists"] = page(s, r, artists)
+		case "album":
+			albums, _ := s.Catalog.SearchAlbums(r.Context(), query, limit)
+			result["albums"] = page(s, r, albums)
+		case "track":
+			tracks, _ := s.Catalog.SearchTracks(r.Context(), query, limit)
+			result["tracks"] = page(s, r, tracks)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) artists(w http.ResponseWriter, r *http.Request) {
+	artists, _ := s.Catalog.GetArtists(r.Context(), ids(r))
+	writeJSON(w, http.StatusOK, map[string]any{"artists": artists})
+}
+
+func (s *Server) artist(w http.ResponseWriter, r *http.Request) {
+	id := spotify.ID(r.PathValue("id"))
+	artists, _ := s.Catalog.GetArtists(r.Context(), []spotify.ID{id})
+	if len(artists) == 0 {
+		writeError(w, spotify.Error{Status: http.StatusNotFound, Message: "non existing id"})
+		return
+	}
+	writeJSON(w, http.StatusOK, artists[0])
+}
+
+func (s *Server) artistAlbums(w http.ResponseWriter, r *http.Request) {
+	var types []spotify.AlbumType
+	if groups := r.URL.Query().Get("include_groups"); groups != "" {
+		for _, g := range strings.Split(groups, ",") {
+			switch g {
+			case "album":
+				types = append(types, spotify.AlbumTypeAlbum)
+			case "single":
+				types = append(types, spotify.AlbumTypeSingle)
+			case "compilation":
+				types = append(types, spotify.AlbumTypeCompilation)
+			case "appears_on":
+				types = append(types, spotify.AlbumTypeAppearsOn)
+			}
+		}
+	}
+
+	albums, err := s.Catalog.GetArtistAlbums(r.Context(), spotify.ID(r.PathValue("id")), types)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page(s, r, albums))
+}
+
+func (s *Server) artistTopTracks(w http.ResponseWriter, r *http.Request) {
+	tracks, err := s.Catalog.GetArtistTopTracks(r.Context(), spotify.ID(r.PathValue("id")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tracks": tracks})
+}
+
+func (s *Server) albums(w http.ResponseWriter, r *http.Request) {
+	albums, _ := s.Catalog.GetAlbums(r.Context(), ids(r))
+	writeJSON(w, http.StatusOK, map[string]any{"albums": albums})
+}
+
+func (s *Server) album(w http.ResponseWriter, r *http.Request) {
+	id := spotify.ID(r.PathValue("id"))
+	albums, _ := s.Catalog.GetAlbums(r.Context(), []spotify.ID{id})
+	if len(albums) == 0 {
+		writeError(w, spotify.Error{Status: http.StatusNotFound, Message: "non existing id"})
+		return
+	}
+	writeJSON(w, http.StatusOK, albums[0])
+}
+
+func (s *Server) albumTracks(w http.ResponseWriter, r *http.Request) {
+	tracks, err := s.Catalog.GetAlbumTracks(r.Context(), spotify.ID(r.PathValue("id")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page(s, r, tracks))
+}
+
+func (s *Server) tracks(w http.ResponseWriter, r *http.Request) {
+	tracks, _ := s.Catalog.GetTracks(r.Context(), ids(r))
+	writeJSON(w, http.StatusOK, map[string]any{"tracks": tracks})
+}
+
+func (s *Server) track(w http.ResponseWriter, r *http.Request) {
+	id := spotify.ID(r.PathValue("id"))
+	tracks, _ := s.Catalog.GetTracks(r.Context(), []spotify.ID{id})
+	if len(tracks) == 0 {
+		writeError(w, spotify.Error{Status: http.StatusNotFound, Message: "non existing id"})
+		return
+	}
+	writeJSON(w, http.StatusOK, tracks[0])
+}
+
+func (s *Server) createPlaylist(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, spotify.Error{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	user := r.PathValue("user")
+	id, err := s.Catalog.CreatePlaylist(r.Context(), user, body.Name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"id":    id,
+		"name":  body.Name,
+		"owner": map[string]any{"id": user},
+		"uri":   "spotify:playlist:" + id,
+	})
+}
+
+func (s *Server) renamePlaylist(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, spotify.Error{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+
+	if err := s.Catalog.RenamePlaylist(r.Context(), spotify.ID(r.PathValue("id")), body.Name); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) unfollowPlaylist(w http.ResponseWriter, r *http.Request) {
+	if err := s.Catalog.UnfollowPlaylist(r.Context(), spotify.ID(r.PathValue("id"))); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// playlistItems returns the items of a playlist the way the Web API pages
+// them: track objects wrapped with their playlist metadata.
+func (s *Server) playlistItems(r *http.Request) (*catalog.PlaylistItems, []map[string]any, error) {
+	items, err := s.Catalog.GetPlaylistItems(r.Context(), spotify.ID(r.PathValue("id")))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := []spotify.ID{}
+	for _, uri := range items.URIs {
+		ids = append(ids, spotify.ID(strings.TrimPrefix(string(uri), "spotify:track:")))
+	}
+	known, _ := s.Catalog.GetTracks(r.Context(), ids)
+	byID := map[spotify.ID]spotify.FullTrack{}
+	for _, t := range known {
+		byID[t.ID] = *t
+	}
+
+	result := []map[string]any{}
+	for i, uri := range items.URIs {
+		if uri == "" {
+			result = append(result, map[string]any{"added_by": map[string]any{"id": s.UserID}, "is_local": false, "track": nil})
+			continue
+		}
+		track := byID[ids[i]]
+		track.ID, track.URI, track.Type = ids[i], uri, "track"
+		result = append(result, map[string]any{"added_by": map[string]any{"id": s.UserID}, "is_local": false, "track": track})
+	}
+	return items, result, nil
+}
+
+func (s *Server) playlist(w http.ResponseWriter, r *http.Request) {
+	items, tracks, err := s.playlistItems(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	fake, _ := s.Catalog.Playlist(spotify.ID(r.PathValue("id")))
+
+	// The first page of tracks is embedded, its links point to the tracks
+	// endpoint
+	tracksReq := r.Clone(r.Context())
+	tracksReq.URL.Path += "/tracks"
+	tracksReq.URL.RawQuery = "limit=100"
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":          r.PathValue("id"),
+		"name":        fake.Name,
+		"owner":       map[string]any{"id": fake.Owner},
+		"uri":         "spotify:playlist:" + r.PathValue("id"),
+		"snapshot_id": items.SnapshotID,
+		"tracks":      page(s, tracksReq, tracks),
+	})
+}
+
+func (s *Server) playlistTracks(w http.ResponseWriter, r *http.Request) {
+	_, tracks, err := s.playlistItems(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page(s, r, tracks))
+}
+
+// replaceOrReorderTracks serves both uses of PUT on the tracks of a
+// playlist: replacing them with a list of URIs, or moving a range of them.
+func (s *Server) replaceOrReorderTracks(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URIs         []string `json:"uris"`
+		RangeStart   *int     `json:"range_start"`
+		RangeLength  int      `json:"range_length"`
+		InsertBefore int      `json:"insert_before"`
+		SnapshotID   string   `json:"snapshot_id"`
+	}
+	if uris := r.URL.Query().Get("uris"); r.URL.Query().Has("uris") {
+		body.URIs = strings.Split(uris, ",")
+	} else if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, spotify.Error{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+	id := spotify.ID(r.PathValue("id"))
+
+	if body.RangeStart != nil {
+		snapshotID, err := s.Catalog.ReorderPlaylistItems(r.Context(), id, spotify.PlaylistReorderOptions{
+			RangeStart:   spotify.Numeric(*body.RangeStart),
+			RangeLength:  spotify.Numeric(body.RangeLength),
+			InsertBefore: spotify.Numeric(body.InsertBefore),
+			SnapshotID:   body.SnapshotID,
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"snapshot_id": snapshotID})
+		return
+	}
+
+	if err := s.Catalog.ReplacePlaylistTracks(r.Context(), id, trackIDs(body.URIs)...); err != nil {
+		writeError(w, err)
+		return
+	}
+	fake, _ := s.Catalog.Playlist(id)
+	writeJSON(w, http.StatusCreated, map[string]any{"snapshot_id": fake.SnapshotID})
+}
+
+func (s *Server) removeTracks(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Tracks     []spotify.TrackToRemove `json:"tracks"`
+		SnapshotID string                  `json:"snapshot_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, spotify.Error{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+	if len(body.Tracks) > 100 {
+		writeError(w, spotify.Error{Status: http.StatusBadRequest, Message: "too many tracks"})
+		return
+	}
+
+	snapshotID, err := s.Catalog.RemovePlaylistItems(r.Context(), spotify.ID(r.PathValue("id")), body.SnapshotID, body.Tracks...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"snapshot_id": snapshotID})
+}
+
+func (s *Server) addTracks(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URIs []string `json:"uris"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, spotify.Error{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+	if len(body.URIs) > 100 {
+		writeError(w, spotify.Error{Status: http.StatusBadRequest, Message: "too many tracks"})
+		return
+	}
+
+	snapshotID, err := s.Catalog.AddTracksToPlaylist(r.Context(), spotify.ID(r.PathValue("id")), trackIDs(body.URIs)...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"snapshot_id": snapshotID})
+}
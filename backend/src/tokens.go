@@ -0,0 +1,193 @@
+package src
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aarhunt/spootify/src/model"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm/clause"
+)
+
+// tokenSource hands out the user's access token, refreshing it through the
+// authenticator once it expires and persisting every refreshed token.
+type tokenSource struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	userID string
+	scopes []string
+	token  *oauth2.Token
+}
+
+func (s *tokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token.Valid() {
+		return s.token, nil
+	}
+
+	initSpotifyAuth()
+	token, err := auth.RefreshToken(s.ctx, s.token)
+	if err != nil {
+		return nil, err
+	}
+
+	s.token = token
+	if err := saveToken(s.userID, token, s.scopes); err != nil {
+		log.Println("Failed to persist refreshed token:", err)
+	}
+	return token, nil
+}
+
+// ErrNoTokenKey means tokens can't be persisted, so connections would be
+// lost on every restart.
+var ErrNoTokenKey = errors.New("TOKEN_ENCRYPTION_KEY must be set to persist Spotify tokens")
+
+// CheckTokenKey fails unless tokens can be persisted.
+func CheckTokenKey() error {
+	if _, ok := tokenKey(); !ok {
+		return ErrNoTokenKey
+	}
+	return nil
+}
+
+// tokenKey derives the AES key used to encrypt tokens at rest from
+// TOKEN_ENCRYPTION_KEY.
+func tokenKey() ([]byte, bool) {
+	secret := os.Getenv("TOKEN_ENCRYPTION_KEY")
+	if secret == "" {
+		return nil, false
+	}
+	key := sha256.Sum256([]byte(secret))
+	return key[:], true
+}
+
+func encryptToken(key []byte, token *oauth2.Token) ([]byte, error) {
+	plain, err := json.Marshal(token)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func decryptToken(key []byte, sealed []byte) (*oauth2.Token, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("stored token is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var token oauth2.Token
+	err = json.Unmarshal(plain, &token)
+	return &token, err
+}
+
+func saveToken(userID string, token *oauth2.Token, scopes []string) error {
+	key, ok := tokenKey()
+	if !ok {
+		return ErrNoTokenKey
+	}
+
+	sealed, err := encryptToken(key, token)
+	if err != nil {
+		return err
+	}
+
+	row := model.SpotifyToken{
+		UserID: userID,
+		Token:  sealed,
+		Expiry: token.Expiry,
+		Scopes: strings.Join(scopes, " "),
+	}
+	return GetDbConn().Db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		UpdateAll: true,
+	}).Create(&row).Error
+}
+
+// tokenScopes reads the granted scopes from a token response.
+func tokenScopes(token *oauth2.Token) []string {
+	scope, _ := token.Extra("scope").(string)
+	return strings.Fields(scope)
+}
+
+// RestoreSpotifyConns reconnects every user with a stored token, so
+// scheduled runs find their connection right after a restart.
+func RestoreSpotifyConns() error {
+	if _, ok := tokenKey(); !ok || os.Getenv("SPOTIFY_ID") == "" {
+		return nil
+	}
+
+	var rows []model.SpotifyToken
+	if err := GetDbConn().Db.Find(&rows).Error; err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if conn := restoreFromRow(row); conn != nil {
+			setSpotifyConn(conn)
+		}
+	}
+	return nil
+}
+
+// restoreSpotifyConn reconnects userID with their stored token, so a restart
+// doesn't require a new browser login.
+func restoreSpotifyConn(userID string) *SpotifyConn {
+	if _, ok := tokenKey(); !ok || os.Getenv("SPOTIFY_ID") == "" {
+		return nil
+	}
+
+	var row model.SpotifyToken
+	err := GetDbConn().Db.Where("user_id = ?", userID).Limit(1).Find(&row).Error
+	if err != nil || row.UserID == "" {
+		return nil
+	}
+	return restoreFromRow(row)
+}
+
+func restoreFromRow(row model.SpotifyToken) *SpotifyConn {
+	key, _ := tokenKey()
+	token, err := decryptToken(key, row.Token)
+	if err != nil {
+		log.Printf("Failed to decrypt stored token of %s: %v", row.UserID, err)
+		return nil
+	}
+
+	return newSpotifyConn(row.UserID, token, strings.Fields(row.Scopes))
+}
@@ -0,0 +1,98 @@
+package src
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aarhunt/spootify/src/model"
+	"golang.org/x/oauth2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDb switches to a fresh in-memory database and forgets all
+// connections.
+func useTestDb(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseDb(db)
+	spotifyConns = map[string]*SpotifyConn{}
+	return db
+}
+
+func TestTokenIsEncryptedAndRestored(t *testing.T) {
+	t.Setenv("TOKEN_ENCRYPTION_KEY", "test-key")
+	t.Setenv("SPOTIFY_ID", "client")
+
+	db := useTestDb(t)
+
+	token := &oauth2.Token{
+		AccessToken:  "access-secret",
+		RefreshToken: "refresh-secret",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(time.Hour).Round(time.Second),
+	}
+	if err := saveToken("alice", token, []string{"playlist-modify-private"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var row model.SpotifyToken
+	db.First(&row, "user_id = ?", "alice")
+	if bytes.Contains(row.Token, []byte("access-secret")) || bytes.Contains(row.Token, []byte("refresh-secret")) {
+		t.Error("token is stored in plain text")
+	}
+
+	conn := GetSpotifyConn("alice")
+	if conn == nil || conn.UserID != "alice" {
+		t.Fatalf("restored connection %+v, want user alice", conn)
+	}
+	restored, err := conn.Token.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.AccessToken != token.AccessToken || !restored.Expiry.Equal(token.Expiry) {
+		t.Errorf("restored token %+v, want %+v", restored, token)
+	}
+	if len(conn.Scopes) != 1 || conn.Scopes[0] != "playlist-modify-private" {
+		t.Errorf("restored scopes %v", conn.Scopes)
+	}
+}
+
+func TestTokenIsNotSavedWithoutKey(t *testing.T) {
+	t.Setenv("TOKEN_ENCRYPTION_KEY", "")
+	useTestDb(t)
+
+	token := &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)}
+	if err := saveToken("alice", token, nil); !errors.Is(err, ErrNoTokenKey) {
+		t.Errorf("got %v, want %v", err, ErrNoTokenKey)
+	}
+}
+
+func TestStoredConnectionsAreRestoredAtBoot(t *testing.T) {
+	t.Setenv("TOKEN_ENCRYPTION_KEY", "test-key")
+	t.Setenv("SPOTIFY_ID", "client")
+	useTestDb(t)
+
+	token := &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)}
+	for _, user := range []string{"alice", "bob"} {
+		if err := saveToken(user, token, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RestoreSpotifyConns(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := spotifyConns["alice"]; !ok || len(spotifyConns) != 2 {
+		t.Errorf("restored connections of %v, want alice and bob", slices.Collect(maps.Keys(spotifyConns)))
+	}
+}
@@ -0,0 +1,275 @@
+// Package transport provides the http.RoundTripper the Spotify client talks
+// through. It keeps the backend within Spotify's rate limits and stops it
+// from hammering the API while Spotify is down.
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aarhunt/spootify/src/errs"
+)
+
+// ErrCircuitOpen is returned without contacting Spotify while the circuit
+// breaker is open.
+var ErrCircuitOpen = fmt.Errorf("%w: circuit breaker open", errs.ErrUnavailable)
+
+type Config struct {
+	// MaxRetries is how often a rate limited or failed request is retried.
+	MaxRetries int
+	// BaseDelay and MaxDelay bound the backoff between retries of 5xx
+	// responses and network errors.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxRetryAfter is the longest Retry-After that is waited for. Longer
+	// ones are handed to the caller as a 429.
+	MaxRetryAfter time.Duration
+	// MaxConcurrent caps the requests in flight at once.
+	MaxConcurrent int
+	// After FailureThreshold consecutive failures the breaker opens and
+	// requests fail fast for Cooldown.
+	FailureThreshold int
+	Cooldown         time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxRetries:       4,
+		BaseDelay:        200 * time.Millisecond,
+		MaxDelay:         5 * time.Second,
+		MaxRetryAfter:    30 * time.Second,
+		MaxConcurrent:    8,
+		FailureThreshold: 5,
+		Cooldown:         30 * time.Second,
+	}
+}
+
+// ConfigFromEnv returns DefaultConfig with the limits overridden by
+// SPOTIFY_MAX_CONCURRENT_REQUESTS and SPOTIFY_MAX_RETRIES when set.
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if n, err := strconv.Atoi(os.Getenv("SPOTIFY_MAX_CONCURRENT_REQUESTS")); err == nil && n > 0 {
+		cfg.MaxConcurrent = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("SPOTIFY_MAX_RETRIES")); err == nil && n >= 0 {
+		cfg.MaxRetries = n
+	}
+	return cfg
+}
+
+type Transport struct {
+	base    http.RoundTripper
+	cfg     Config
+	slots   chan struct{}
+	breaker breaker
+}
+
+func New(base http.RoundTripper, cfg Config) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		base:  base,
+		cfg:   cfg,
+		slots: make(chan struct{}, max(cfg.MaxConcurrent, 1)),
+		breaker: breaker{
+			threshold: cfg.FailureThreshold,
+			cooldown:  cfg.Cooldown,
+		},
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		trial, ok := t.breaker.allow()
+		if !ok {
+			return nil, ErrCircuitOpen
+		}
+
+		res, err := t.send(req, attempt)
+
+		var wait time.Duration
+		retry := canRetry(req)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			// The caller gave up, that says nothing about Spotify
+			if trial {
+				t.breaker.release()
+			}
+			return nil, err
+		case err != nil:
+			// Spotify may have applied the request before it failed, so
+			// only requests that can be applied twice are sent again
+			t.breaker.failure()
+			wait = t.backoff(attempt)
+			retry = retry && idempotent(req)
+		case res.StatusCode == http.StatusTooManyRequests:
+			// Being rate limited means Spotify is up
+			t.breaker.success()
+			retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After"))
+			if !ok || retryAfter > t.cfg.MaxRetryAfter {
+				return res, nil
+			}
+			wait = retryAfter
+		case res.StatusCode >= 500:
+			t.breaker.failure()
+			wait = t.backoff(attempt)
+			retry = retry && idempotent(req)
+		default:
+			t.breaker.success()
+			return res, nil
+		}
+
+		if attempt >= t.cfg.MaxRetries || !retry {
+			return res, err
+		}
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send does a single attempt while holding one of the concurrency slots.
+func (t *Transport) send(req *http.Request, attempt int) (*http.Response, error) {
+	select {
+	case t.slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	defer func() { <-t.slots }()
+
+	if attempt > 0 && req.Body != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = body
+	}
+	return t.base.RoundTrip(req)
+}
+
+// backoff returns a random delay up to BaseDelay doubled per attempt,
+// capped at MaxDelay.
+func (t *Transport) backoff(attempt int) time.Duration {
+	ceiling := min(t.cfg.BaseDelay<<min(attempt, 16), t.cfg.MaxDelay)
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling)
+}
+
+// canRetry reports whether the request body can be sent again.
+func canRetry(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// idempotent reports whether sending the request twice has the same effect
+// as sending it once. Adding tracks to a playlist is a POST, and would add
+// them twice.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as a date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// breaker opens after threshold consecutive failures. Once the cooldown
+// has passed a single trial request is let through: its success closes the
+// breaker, its failure opens it again.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// allow tells whether a request may be sent, and whether it is the trial.
+func (b *breaker) allow() (trial bool, ok bool) {
+	if b.threshold <= 0 {
+		return false, true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return false, true
+	}
+	if b.trial || time.Now().Before(b.openUntil) {
+		return false, false
+	}
+	b.trial = true
+	return true, true
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trial = false
+}
+
+// release ends the trial without a verdict, when its caller gave up on it,
+// so the next request can be the trial. Only the trial request may call it.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trial = false
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,329 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aarhunt/spootify/src/errs"
+)
+
+func testConfig() Config {
+	return Config{
+		MaxRetries:       3,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         5 * time.Millisecond,
+		MaxRetryAfter:    time.Second,
+		MaxConcurrent:    4,
+		FailureThreshold: 10,
+		Cooldown:         time.Minute,
+	}
+}
+
+// serve answers each request with the next status of statuses, repeating
+// the last one, and counts the requests.
+func serve(t *testing.T, headers http.Header, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		status := statuses[min(n, len(statuses))-1]
+		for k, v := range headers {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func get(t *testing.T, client *http.Client, url string) (*http.Response, error) {
+	t.Helper()
+
+	res, err := client.Get(url)
+	if err == nil {
+		res.Body.Close()
+	}
+	return res, err
+}
+
+func TestRetriesServerErrors(t *testing.T) {
+	server, calls := serve(t, nil, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK)
+	client := &http.Client{Transport: New(nil, testConfig())}
+
+	res, err := get(t, client, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || calls.Load() != 3 {
+		t.Errorf("got %d after %d calls, want 200 after 3", res.StatusCode, calls.Load())
+	}
+}
+
+func TestGivesUpAfterMaxRetries(t *testing.T) {
+	server, calls := serve(t, nil, http.StatusInternalServerError)
+	client := &http.Client{Transport: New(nil, testConfig())}
+
+	res, err := get(t, client, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusInternalServerError || calls.Load() != 4 {
+		t.Errorf("got %d after %d calls, want 500 after 4", res.StatusCode, calls.Load())
+	}
+}
+
+func TestHonoursRetryAfter(t *testing.T) {
+	server, calls := serve(t, http.Header{"Retry-After": {"0"}}, http.StatusTooManyRequests, http.StatusOK)
+	client := &http.Client{Transport: New(nil, testConfig())}
+
+	res, err := get(t, client, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("got %d after %d calls, want 200 after 2", res.StatusCode, calls.Load())
+	}
+
+	// Waits beyond MaxRetryAfter are left to the caller
+	server, calls = serve(t, http.Header{"Retry-After": {"3600"}}, http.StatusTooManyRequests, http.StatusOK)
+	res, err = get(t, client, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusTooManyRequests || calls.Load() != 1 {
+		t.Errorf("got %d after %d calls, want 429 after 1", res.StatusCode, calls.Load())
+	}
+}
+
+func TestReplaysBodyOnRetry(t *testing.T) {
+	var bodies []string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := &http.Client{Transport: New(nil, testConfig())}
+
+	req, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader(`{"uris":[]}`))
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if len(bodies) != 2 || bodies[1] != `{"uris":[]}` {
+		t.Errorf("got bodies %q, want the body sent twice", bodies)
+	}
+}
+
+func TestRetriesPostOnlyWhenRateLimited(t *testing.T) {
+	client := &http.Client{Transport: New(nil, testConfig())}
+	post := func(url string) *http.Response {
+		res, err := client.Post(url, "application/json", strings.NewReader(`{"uris":[]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	// Spotify may have added the tracks before failing
+	server, calls := serve(t, nil, http.StatusBadGateway, http.StatusOK)
+	if res := post(server.URL); res.StatusCode != http.StatusBadGateway || calls.Load() != 1 {
+		t.Errorf("got %d after %d calls, want 502 after 1", res.StatusCode, calls.Load())
+	}
+
+	server, calls = serve(t, http.Header{"Retry-After": {"0"}}, http.StatusTooManyRequests, http.StatusOK)
+	if res := post(server.URL); res.StatusCode != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("got %d after %d calls, want 200 after 2", res.StatusCode, calls.Load())
+	}
+}
+
+func TestCapsConcurrentRequests(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := testConfig()
+	cfg.MaxConcurrent = 2
+	client := &http.Client{Transport: New(nil, cfg)}
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := get(t, client, server.URL); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak.Load() > 2 {
+		t.Errorf("%d requests in flight at once, want at most 2", peak.Load())
+	}
+}
+
+func TestCircuitBreakerFailsFast(t *testing.T) {
+	server, calls := serve(t, nil, http.StatusServiceUnavailable)
+
+	cfg := testConfig()
+	cfg.MaxRetries = 0
+	cfg.FailureThreshold = 2
+	cfg.Cooldown = 20 * time.Millisecond
+	client := &http.Client{Transport: New(nil, cfg)}
+
+	for range 2 {
+		if _, err := get(t, client, server.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := get(t, client, server.URL)
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, errs.ErrUnavailable) {
+		t.Fatalf("got %v, want %v", err, ErrCircuitOpen)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Spotify was called %d times, want 2", calls.Load())
+	}
+
+	// After the cooldown a trial request goes through again
+	time.Sleep(cfg.Cooldown)
+	if _, err := get(t, client, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Spotify was called %d times, want 3", calls.Load())
+	}
+}
+
+func TestCircuitBreakerReleasesCancelledTrial(t *testing.T) {
+	block := make(chan struct{})
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			// The trial request, hanging until its caller gives up
+			<-block
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(block) })
+
+	cfg := testConfig()
+	cfg.MaxRetries = 0
+	cfg.FailureThreshold = 1
+	cfg.Cooldown = 20 * time.Millisecond
+	client := &http.Client{Transport: New(nil, cfg)}
+
+	if _, err := get(t, client, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(cfg.Cooldown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The cancelled trial settled nothing, so the next request is the trial
+	if _, err := get(t, client, server.URL); err != nil {
+		t.Fatalf("got %v, want the request to go through", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Spotify was called %d times, want 3", calls.Load())
+	}
+}
+
+func TestCircuitBreakerKeepsTrialWhenOtherRequestIsCancelled(t *testing.T) {
+	block := make(chan struct{})
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(block) })
+
+	cfg := testConfig()
+	cfg.MaxRetries = 0
+	cfg.FailureThreshold = 1
+	cfg.Cooldown = 20 * time.Millisecond
+	client := &http.Client{Transport: New(nil, cfg)}
+
+	// A request sent before the breaker opened, still waiting
+	slowCtx, cancelSlow := context.WithCancel(context.Background())
+	slowDone := make(chan struct{})
+	go func() {
+		defer close(slowDone)
+		req, _ := http.NewRequestWithContext(slowCtx, http.MethodGet, server.URL+"/slow", nil)
+		client.Do(req)
+	}()
+	for calls.Load() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := get(t, client, server.URL+"/fail"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(cfg.Cooldown)
+
+	// The trial request
+	trialCtx, cancelTrial := context.WithCancel(context.Background())
+	defer cancelTrial()
+	go func() {
+		req, _ := http.NewRequestWithContext(trialCtx, http.MethodGet, server.URL+"/trial", nil)
+		client.Do(req)
+	}()
+	for calls.Load() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancelSlow()
+	<-slowDone
+
+	// The trial is still running, so the breaker stays closed to others
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, want %v", err, ErrCircuitOpen)
+	}
+}
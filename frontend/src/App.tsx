@@ -17,6 +17,8 @@ function App() {
 
     client.setConfig({
         baseUrl: import.meta.env.VITE_API_URL,
+        // Sends the session cookie set by the Spotify callback
+        credentials: 'include',
     });
 
     useEffect(() => {